@@ -0,0 +1,183 @@
+// Package authz decides what a user may do with a note. Handlers ask an
+// Authorizer instead of comparing owner IDs and collaborator rows
+// themselves, so every endpoint applies the same rules and reports denials
+// the same way.
+package authz
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"layer-api/types"
+	"layer-api/utils"
+	"net/http"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionView                Action = "view"
+	ActionComment             Action = "comment"
+	ActionEdit                Action = "edit"
+	ActionManageCollaborators Action = "manage_collaborators"
+	ActionViewAudit           Action = "view_audit"
+	ActionArchive             Action = "archive"
+	ActionShare               Action = "share"
+	ActionTransfer            Action = "transfer"
+	ActionMove                Action = "move"
+)
+
+var (
+	// ErrNotFound is returned when the note does not exist or the user has
+	// no access to it at all; the two are indistinguishable to callers.
+	ErrNotFound = errors.New("note not found")
+	// ErrForbidden is returned when the user can see the note but the
+	// action needs more than their role allows.
+	ErrForbidden = errors.New("insufficient permissions for this note")
+)
+
+// minRole is the least collaborator role that grants each action. Actions
+// missing from the map are reserved for the owner.
+var minRole = map[Action]types.CollaboratorRole{
+	ActionView:                types.RoleViewer,
+	ActionComment:             types.RoleCommenter,
+	ActionEdit:                types.RoleEditor,
+	ActionManageCollaborators: types.RoleManager,
+	ActionViewAudit:           types.RoleManager,
+}
+
+var ownerActions = map[Action]bool{
+	ActionArchive:  true,
+	ActionShare:    true,
+	ActionTransfer: true,
+	ActionMove:     true,
+}
+
+// Access describes how a user relates to a note: either its owner or a
+// collaborator holding Role, directly or through a workspace. ExpiresAt is
+// set when the access comes from a time-limited grant.
+type Access struct {
+	Owner     bool
+	Role      types.CollaboratorRole
+	ExpiresAt *time.Time
+}
+
+// OwnerRank places the owner above every collaborator role.
+var OwnerRank = types.RoleManager.Rank() + 1
+
+func (a Access) Rank() int {
+	if a.Owner {
+		return OwnerRank
+	}
+	return a.Role.Rank()
+}
+
+// now is the clock Can checks grant expiry against.
+var now = time.Now
+
+// Can reports whether the access level permits action. A time-limited
+// grant that has lapsed permits nothing, even if it was loaded before it
+// expired.
+func (a Access) Can(action Action) bool {
+	if a.Owner {
+		return ownerActions[action] || minRole[action] != ""
+	}
+	if a.ExpiresAt != nil && !a.ExpiresAt.After(now()) {
+		return false
+	}
+	required, ok := minRole[action]
+	if !ok {
+		return false
+	}
+	return a.Role.Valid() && a.Role.Rank() >= required.Rank()
+}
+
+type Authorizer struct {
+	notes   types.NoteStore
+	collabs types.CollaboratorStore
+}
+
+func New(notes types.NoteStore, collabs types.CollaboratorStore) *Authorizer {
+	return &Authorizer{
+		notes:   notes,
+		collabs: collabs,
+	}
+}
+
+// Access loads the note and the user's access to it. Results are memoised
+// in the request cache when ctx carries one.
+func (a *Authorizer) Access(ctx context.Context, noteID, userID int) (*types.Note, Access, error) {
+	c := cacheFrom(ctx)
+	if c != nil {
+		if d, ok := c.get(noteID, userID); ok {
+			return d.note, d.access, d.err
+		}
+	}
+
+	n, access, err := a.resolve(noteID, userID)
+	if c != nil && (err == nil || errors.Is(err, ErrNotFound)) {
+		c.put(noteID, userID, decision{note: n, access: access, err: err})
+	}
+
+	return n, access, err
+}
+
+func (a *Authorizer) resolve(noteID, userID int) (*types.Note, Access, error) {
+	n, err := a.notes.GetNoteByID(noteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, Access{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Access{}, err
+	}
+
+	if n.OwnerID == userID {
+		return n, Access{Owner: true}, nil
+	}
+
+	role, expiresAt, err := a.collabs.GetEffectiveRole(noteID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, Access{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Access{}, err
+	}
+
+	return n, Access{Role: role, ExpiresAt: expiresAt}, nil
+}
+
+// Authorize returns the note when the user may perform action on it,
+// ErrNotFound when they cannot see it and ErrForbidden when they can see it
+// but lack the required role.
+func (a *Authorizer) Authorize(ctx context.Context, noteID, userID int, action Action) (*types.Note, Access, error) {
+	n, access, err := a.Access(ctx, noteID, userID)
+	if err != nil {
+		return nil, access, err
+	}
+	if !access.Can(action) {
+		return nil, access, ErrForbidden
+	}
+	return n, access, nil
+}
+
+// Invalidate drops any cached decision for the pair, for handlers that
+// change access part-way through a request.
+func Invalidate(ctx context.Context, noteID, userID int) {
+	if c := cacheFrom(ctx); c != nil {
+		c.delete(noteID, userID)
+	}
+}
+
+// WriteError maps authorization errors onto responses: 404 for notes the
+// user cannot see, 403 for insufficient roles.
+func WriteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		utils.WriteError(w, http.StatusNotFound, ErrNotFound)
+	case errors.Is(err, ErrForbidden):
+		utils.WriteError(w, http.StatusForbidden, ErrForbidden)
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+	}
+}
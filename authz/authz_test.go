@@ -0,0 +1,289 @@
+package authz
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"layer-api/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var allActions = []Action{
+	ActionView,
+	ActionComment,
+	ActionEdit,
+	ActionManageCollaborators,
+	ActionViewAudit,
+	ActionArchive,
+	ActionShare,
+	ActionTransfer,
+	ActionMove,
+}
+
+func TestAccessCan(t *testing.T) {
+	// Each row lists the actions the access level may perform; every other
+	// action must be refused.
+	tests := []struct {
+		name    string
+		access  Access
+		allowed []Action
+	}{
+		{
+			name:    "owner",
+			access:  Access{Owner: true},
+			allowed: allActions,
+		},
+		{
+			name:    "manager",
+			access:  Access{Role: types.RoleManager},
+			allowed: []Action{ActionView, ActionComment, ActionEdit, ActionManageCollaborators, ActionViewAudit},
+		},
+		{
+			name:    "editor",
+			access:  Access{Role: types.RoleEditor},
+			allowed: []Action{ActionView, ActionComment, ActionEdit},
+		},
+		{
+			name:    "commenter",
+			access:  Access{Role: types.RoleCommenter},
+			allowed: []Action{ActionView, ActionComment},
+		},
+		{
+			name:    "viewer",
+			access:  Access{Role: types.RoleViewer},
+			allowed: []Action{ActionView},
+		},
+		{
+			name:   "unknown role",
+			access: Access{Role: types.CollaboratorRole("admin")},
+		},
+		{
+			name:   "no access",
+			access: Access{},
+		},
+	}
+
+	for _, tt := range tests {
+		allowed := make(map[Action]bool)
+		for _, action := range tt.allowed {
+			allowed[action] = true
+		}
+
+		for _, action := range allActions {
+			if got := tt.access.Can(action); got != allowed[action] {
+				t.Errorf("%s.Can(%s) = %v, want %v", tt.name, action, got, allowed[action])
+			}
+		}
+	}
+}
+
+func TestAccessCanUnknownAction(t *testing.T) {
+	for _, access := range []Access{{Owner: true}, {Role: types.RoleManager}} {
+		if access.Can(Action("delete_everything")) {
+			t.Errorf("%+v may perform an unknown action", access)
+		}
+	}
+}
+
+func TestAccessCanExpiry(t *testing.T) {
+	fixed := time.Date(2025, 12, 20, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return fixed }
+	t.Cleanup(func() { now = time.Now })
+
+	past := fixed.Add(-time.Second)
+	exact := fixed
+	future := fixed.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		want      bool
+	}{
+		{"permanent", nil, true},
+		{"expires later", &future, true},
+		{"expires now", &exact, false},
+		{"expired", &past, false},
+	}
+
+	for _, tt := range tests {
+		access := Access{Role: types.RoleManager, ExpiresAt: tt.expiresAt}
+		for _, action := range []Action{ActionView, ActionEdit, ActionManageCollaborators} {
+			if got := access.Can(action); got != tt.want {
+				t.Errorf("%s grant: Can(%s) = %v, want %v", tt.name, action, got, tt.want)
+			}
+		}
+	}
+
+	// Owners never hold a time-limited grant.
+	owner := Access{Owner: true, ExpiresAt: &past}
+	if !owner.Can(ActionEdit) {
+		t.Error("owner lost access through an expiry")
+	}
+}
+
+func TestAccessRank(t *testing.T) {
+	if got := (Access{Owner: true}).Rank(); got <= types.RoleManager.Rank() {
+		t.Errorf("owner rank %d is not above manager", got)
+	}
+	if got := (Access{Role: types.RoleEditor}).Rank(); got != types.RoleEditor.Rank() {
+		t.Errorf("editor rank = %d", got)
+	}
+}
+
+type fakeNotes struct {
+	types.NoteStore
+	notes map[int]*types.Note
+	err   error
+	calls int
+}
+
+func (f *fakeNotes) GetNoteByID(id int) (*types.Note, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	n, ok := f.notes[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return n, nil
+}
+
+type grant struct {
+	role      types.CollaboratorRole
+	expiresAt *time.Time
+}
+
+type fakeCollabs struct {
+	types.CollaboratorStore
+	roles map[[2]int]grant
+	err   error
+}
+
+func (f *fakeCollabs) GetEffectiveRole(noteID, userID int) (types.CollaboratorRole, *time.Time, error) {
+	if f.err != nil {
+		return "", nil, f.err
+	}
+	g, ok := f.roles[[2]int{noteID, userID}]
+	if !ok {
+		return "", nil, sql.ErrNoRows
+	}
+	return g.role, g.expiresAt, nil
+}
+
+const (
+	ownerID  = 1
+	viewerID = 2
+	editorID = 3
+	outsider = 4
+	noteID   = 10
+)
+
+func newTestAuthorizer() (*Authorizer, *fakeNotes, *fakeCollabs) {
+	notes := &fakeNotes{notes: map[int]*types.Note{
+		noteID: {ID: noteID, OwnerID: ownerID},
+	}}
+	collabs := &fakeCollabs{roles: map[[2]int]grant{
+		{noteID, viewerID}: {role: types.RoleViewer},
+		{noteID, editorID}: {role: types.RoleEditor},
+	}}
+	return New(notes, collabs), notes, collabs
+}
+
+func TestAuthorize(t *testing.T) {
+	a, _, _ := newTestAuthorizer()
+
+	tests := []struct {
+		name    string
+		noteID  int
+		userID  int
+		action  Action
+		wantErr error
+	}{
+		{"owner archives", noteID, ownerID, ActionArchive, nil},
+		{"owner moves", noteID, ownerID, ActionMove, nil},
+		{"editor edits", noteID, editorID, ActionEdit, nil},
+		{"editor cannot share", noteID, editorID, ActionShare, ErrForbidden},
+		{"viewer views", noteID, viewerID, ActionView, nil},
+		{"viewer cannot edit", noteID, viewerID, ActionEdit, ErrForbidden},
+		{"viewer cannot move", noteID, viewerID, ActionMove, ErrForbidden},
+		{"outsider cannot see", noteID, outsider, ActionView, ErrNotFound},
+		{"missing note", 99, ownerID, ActionView, ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		n, _, err := a.Authorize(context.Background(), tt.noteID, tt.userID, tt.action)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == nil && (n == nil || n.ID != tt.noteID) {
+			t.Errorf("%s: note = %+v", tt.name, n)
+		}
+		if tt.wantErr != nil && n != nil {
+			t.Errorf("%s: denied request returned note %+v", tt.name, n)
+		}
+	}
+}
+
+func TestAuthorizeStoreErrors(t *testing.T) {
+	boom := errors.New("database is down")
+
+	a, notes, _ := newTestAuthorizer()
+	notes.err = boom
+	if _, _, err := a.Authorize(context.Background(), noteID, ownerID, ActionView); !errors.Is(err, boom) {
+		t.Errorf("note store error: err = %v", err)
+	}
+
+	a, _, collabs := newTestAuthorizer()
+	collabs.err = boom
+	_, _, err := a.Authorize(context.Background(), noteID, viewerID, ActionView)
+	if !errors.Is(err, boom) || errors.Is(err, ErrNotFound) || errors.Is(err, ErrForbidden) {
+		t.Errorf("collaborator store error: err = %v", err)
+	}
+}
+
+func TestAccessIsCachedPerRequest(t *testing.T) {
+	a, notes, _ := newTestAuthorizer()
+	ctx := WithCache(context.Background())
+
+	for range 3 {
+		if _, _, err := a.Authorize(ctx, noteID, editorID, ActionEdit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if notes.calls != 1 {
+		t.Errorf("note loaded %d times, want 1", notes.calls)
+	}
+
+	Invalidate(ctx, noteID, editorID)
+	if _, _, err := a.Authorize(ctx, noteID, editorID, ActionEdit); err != nil {
+		t.Fatal(err)
+	}
+	if notes.calls != 2 {
+		t.Errorf("note loaded %d times after invalidation, want 2", notes.calls)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{ErrNotFound, http.StatusNotFound},
+		{ErrForbidden, http.StatusForbidden},
+		{errors.Join(errors.New("context"), ErrForbidden), http.StatusForbidden},
+		{errors.New("database is down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		WriteError(rec, tt.err)
+		if rec.Code != tt.want {
+			t.Errorf("WriteError(%v) status = %d, want %d", tt.err, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package authz
+
+import (
+	"context"
+	"layer-api/types"
+	"net/http"
+	"sync"
+)
+
+type cacheKey struct{}
+
+type pair struct {
+	noteID int
+	userID int
+}
+
+type decision struct {
+	note   *types.Note
+	access Access
+	err    error
+}
+
+type cache struct {
+	mu      sync.Mutex
+	entries map[pair]decision
+}
+
+// WithCache returns a context whose authorization decisions are memoised
+// until the context is discarded.
+func WithCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheKey{}, &cache{entries: make(map[pair]decision)})
+}
+
+// Middleware gives each request its own decision cache.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithCache(r.Context())))
+	})
+}
+
+func cacheFrom(ctx context.Context) *cache {
+	c, _ := ctx.Value(cacheKey{}).(*cache)
+	return c
+}
+
+func (c *cache) get(noteID, userID int) (decision, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.entries[pair{noteID, userID}]
+	return d, ok
+}
+
+func (c *cache) put(noteID, userID int, d decision) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[pair{noteID, userID}] = d
+}
+
+func (c *cache) delete(noteID, userID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, pair{noteID, userID})
+}
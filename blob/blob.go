@@ -0,0 +1,24 @@
+package blob
+
+import (
+	"fmt"
+	"layer-api/configs"
+	"layer-api/types"
+)
+
+func NewFromConfig(cfg configs.Config) (types.BlobStore, error) {
+	switch cfg.BlobBackend {
+	case "", "local":
+		return NewLocalStore(cfg.BlobLocalDir)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", cfg.BlobBackend)
+	}
+}
@@ -2,13 +2,28 @@ package api
 
 import (
 	"database/sql"
+	"layer-api/authz"
+	"layer-api/blob"
+	"layer-api/configs"
+	"layer-api/mail"
+	"layer-api/oidc"
+	"layer-api/services/attachment"
 	"layer-api/services/collab"
+	"layer-api/services/export"
+	"layer-api/services/folder"
+	"layer-api/services/importer"
 	"layer-api/services/note"
+	"layer-api/services/notification"
 	"layer-api/services/realtime"
+	"layer-api/services/share"
+	"layer-api/services/tag"
 	"layer-api/services/user"
+	"layer-api/services/workspace"
 	"layer-api/utils"
+	"layer-api/verification"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -30,23 +45,97 @@ func (s *APIServer) Run() error {
 	router.Use(utils.CORSMiddleware)
 
 	subrouter := router.PathPrefix("/api/v1").Subrouter()
+	subrouter.Use(authz.Middleware)
+
+	mailer, err := mail.NewFromConfig(configs.Envs)
+	if err != nil {
+		return err
+	}
+
+	providers, err := oidc.NewFromConfig(configs.Envs)
+	if err != nil {
+		return err
+	}
 
 	userStore := user.NewStore(s.db)
-	userHandler := user.NewHandler(userStore)
+	userHandler := user.NewHandler(
+		userStore,
+		userStore,
+		userStore,
+		userStore,
+		userStore,
+		userStore,
+		mailer,
+		configs.Envs.AppURL,
+		providers,
+		configs.Envs.OIDCRedirectURL,
+	)
 	userHandler.RegisterRoutes(subrouter)
 
+	verified, err := verification.NewPolicy(userStore, configs.Envs.UnverifiedRestrictions)
+	if err != nil {
+		return err
+	}
+
+	go user.RunRevocationSync(userStore, 15*time.Second)
+
 	noteStore := note.NewStore(s.db)
-	noteHandler := note.NewHandler(noteStore)
+	folderStore := folder.NewStore(s.db)
+	collabStore := collab.NewStore(s.db)
+	workspaceStore := workspace.NewStore(s.db)
+	authorizer := authz.New(noteStore, collabStore)
+	noteHandler := note.NewHandler(noteStore, folderStore, workspaceStore, authorizer)
 	noteHandler.RegisterRoutes(subrouter)
 
-	collabStore := collab.NewStore(s.db)
-	collabHandler := collab.NewHandler(collabStore, noteStore)
+	folderHandler := folder.NewHandler(folderStore, noteStore, userStore, authorizer, verified)
+	folderHandler.RegisterRoutes(subrouter)
+
+	collabHandler := collab.NewHandler(collabStore, collabStore, collabStore, collabStore, collabStore, userStore, authorizer, verified)
 	collabHandler.RegisterRoutes(subrouter)
 
+	notificationStore := notification.NewStore(s.db)
+	notificationHandler := notification.NewHandler(notificationStore)
+	notificationHandler.RegisterRoutes(subrouter)
+
+	go collab.RunGrantSweeper(collabStore, notificationStore, time.Minute)
+
+	workspaceHandler := workspace.NewHandler(workspaceStore, noteStore, userStore, authorizer, verified)
+	workspaceHandler.RegisterRoutes(subrouter)
+
+	shareStore := share.NewStore(s.db)
+	shareHandler := share.NewHandler(shareStore, noteStore, authorizer, verified)
+	shareHandler.RegisterRoutes(subrouter)
+
+	tagStore := tag.NewStore(s.db)
+	tagHandler := tag.NewHandler(tagStore, authorizer)
+	tagHandler.RegisterRoutes(subrouter)
+
+	exportHandler := export.NewHandler(noteStore, tagStore, collabStore, folderStore, userStore, authorizer)
+	exportHandler.RegisterRoutes(subrouter)
+
+	importStore := importer.NewStore(s.db)
+	importHandler := importer.NewHandler(importStore)
+	importHandler.RegisterRoutes(subrouter)
+
+	go importer.RunJobSweeper(importStore, time.Minute)
+
+	blobStore, err := blob.NewFromConfig(configs.Envs)
+	if err != nil {
+		return err
+	}
+
+	attachmentStore := attachment.NewStore(s.db)
+	thumbnailWorker := attachment.NewThumbnailWorker(attachmentStore, blobStore)
+	attachmentHandler := attachment.NewHandler(attachmentStore, blobStore, authorizer, thumbnailWorker, configs.Envs.MaxAttachmentSize)
+	attachmentHandler.RegisterRoutes(subrouter)
+
+	go attachment.RunBlobCleaner(attachmentStore, blobStore, time.Minute)
+	go thumbnailWorker.Run(10 * time.Second)
+
 	hub := realtime.NewHub()
 	go hub.Run()
 
-	realtimeHandler := realtime.NewHandler(hub, noteStore, collabStore)
+	realtimeHandler := realtime.NewHandler(hub, noteStore, authorizer)
 	realtimeHandler.RegisterRoutes(subrouter)
 
 	log.Println("Listening on", s.addr)
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS note_tags (
+    note_id BIGINT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (note_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_note_tags_tag_id ON note_tags (tag_id);
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE notes DROP COLUMN IF EXISTS folder_id;
+
+DROP TABLE IF EXISTS folders;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS folders (
+    id BIGSERIAL PRIMARY KEY,
+    owner_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    parent_id BIGINT REFERENCES folders (id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_folders_owner_id ON folders (owner_id);
+CREATE INDEX IF NOT EXISTS idx_folders_parent_id ON folders (parent_id);
+
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS folder_id BIGINT REFERENCES folders (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notes_folder_id ON notes (folder_id);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS folder_collaborators;
\ No newline at end of file
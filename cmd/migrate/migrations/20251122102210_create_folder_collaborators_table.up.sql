@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS folder_collaborators (
+    id BIGSERIAL PRIMARY KEY,
+    folder_id BIGINT NOT NULL REFERENCES folders (id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    can_edit BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_folder_collaborators_unique ON folder_collaborators (folder_id, user_id);
\ No newline at end of file
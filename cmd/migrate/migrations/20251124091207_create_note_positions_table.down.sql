@@ -0,0 +1 @@
+DROP TABLE IF EXISTS note_positions;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS note_positions (
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    note_id BIGINT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    is_pinned BOOLEAN NOT NULL DEFAULT FALSE,
+    position TEXT COLLATE "C",
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, note_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_note_positions_order ON note_positions (user_id, is_pinned DESC, position);
\ No newline at end of file
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS trg_attachments_blob_deletion ON attachments;
+
+DROP FUNCTION IF EXISTS enqueue_attachment_blob_deletion;
+
+DROP TABLE IF EXISTS blob_deletions;
+
+DROP TABLE IF EXISTS attachments;
\ No newline at end of file
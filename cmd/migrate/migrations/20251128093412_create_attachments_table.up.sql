@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS attachments (
+    id BIGSERIAL PRIMARY KEY,
+    note_id BIGINT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    uploader_id BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    filename TEXT NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    storage_key TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_note_id ON attachments (note_id);
+
+CREATE TABLE IF NOT EXISTS blob_deletions (
+    id BIGSERIAL PRIMARY KEY,
+    storage_key TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE OR REPLACE FUNCTION enqueue_attachment_blob_deletion() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO blob_deletions (storage_key) VALUES (OLD.storage_key);
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_attachments_blob_deletion
+AFTER DELETE ON attachments
+FOR EACH ROW EXECUTE FUNCTION enqueue_attachment_blob_deletion();
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS trg_attachment_variants_blob_deletion ON attachment_variants;
+
+DROP TABLE IF EXISTS attachment_variants;
+
+ALTER TABLE attachments DROP COLUMN IF EXISTS thumbnail_status;
\ No newline at end of file
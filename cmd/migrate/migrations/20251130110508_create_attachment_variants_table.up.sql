@@ -0,0 +1,21 @@
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS thumbnail_status VARCHAR(20) NOT NULL DEFAULT 'none';
+
+CREATE INDEX IF NOT EXISTS idx_attachments_thumbnail_pending ON attachments (id) WHERE thumbnail_status = 'pending';
+
+CREATE TABLE IF NOT EXISTS attachment_variants (
+    id BIGSERIAL PRIMARY KEY,
+    attachment_id BIGINT NOT NULL REFERENCES attachments (id) ON DELETE CASCADE,
+    variant VARCHAR(20) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attachment_variants_unique ON attachment_variants (attachment_id, variant);
+
+CREATE TRIGGER trg_attachment_variants_blob_deletion
+AFTER DELETE ON attachment_variants
+FOR EACH ROW EXECUTE FUNCTION enqueue_attachment_blob_deletion();
\ No newline at end of file
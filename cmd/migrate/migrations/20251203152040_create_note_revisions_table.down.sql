@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS trg_notes_revision_update ON notes;
+
+DROP TRIGGER IF EXISTS trg_notes_revision_insert ON notes;
+
+DROP FUNCTION IF EXISTS record_note_revision;
+
+DROP TABLE IF EXISTS note_revisions;
\ No newline at end of file
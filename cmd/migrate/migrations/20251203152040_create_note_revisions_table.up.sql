@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS note_revisions (
+    note_id BIGINT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    version BIGINT NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (note_id, version)
+);
+
+INSERT INTO note_revisions (note_id, version, title, content)
+SELECT id, version, title, content FROM notes
+ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION record_note_revision() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO note_revisions (note_id, version, title, content)
+    VALUES (NEW.id, NEW.version, NEW.title, NEW.content)
+    ON CONFLICT (note_id, version) DO NOTHING;
+
+    DELETE FROM note_revisions
+    WHERE note_id = NEW.id
+      AND version <= NEW.version - 500;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_notes_revision_insert
+AFTER INSERT ON notes
+FOR EACH ROW EXECUTE FUNCTION record_note_revision();
+
+CREATE TRIGGER trg_notes_revision_update
+AFTER UPDATE ON notes
+FOR EACH ROW
+WHEN (OLD.title IS DISTINCT FROM NEW.title OR OLD.content IS DISTINCT FROM NEW.content)
+EXECUTE FUNCTION record_note_revision();
\ No newline at end of file
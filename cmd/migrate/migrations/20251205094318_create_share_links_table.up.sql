@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS share_links (
+    id BIGSERIAL PRIMARY KEY,
+    note_id BIGINT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    created_by BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    password_hash TEXT,
+    expires_at TIMESTAMPTZ,
+    view_count BIGINT NOT NULL DEFAULT 0,
+    last_viewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_note_id ON share_links (note_id);
\ No newline at end of file
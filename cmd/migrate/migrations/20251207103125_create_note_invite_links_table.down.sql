@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS note_invite_redemptions;
+DROP TABLE IF EXISTS note_invite_links;
\ No newline at end of file
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS note_invite_links (
+    id BIGSERIAL PRIMARY KEY,
+    note_id BIGINT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    created_by BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    can_edit BOOLEAN NOT NULL DEFAULT TRUE,
+    max_uses INTEGER CHECK (max_uses > 0),
+    use_count INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_note_invite_links_note_id ON note_invite_links (note_id);
+
+CREATE TABLE IF NOT EXISTS note_invite_redemptions (
+    link_id BIGINT NOT NULL REFERENCES note_invite_links (id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redeemed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (link_id, user_id)
+);
\ No newline at end of file
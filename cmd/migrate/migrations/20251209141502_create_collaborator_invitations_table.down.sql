@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS trg_users_claim_collaborator_invitations ON users;
+DROP FUNCTION IF EXISTS claim_collaborator_invitations();
+DROP TABLE IF EXISTS collaborator_invitations;
\ No newline at end of file
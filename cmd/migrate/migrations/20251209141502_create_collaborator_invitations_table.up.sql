@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS collaborator_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    note_id BIGINT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    inviter_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    invitee_id BIGINT REFERENCES users (id) ON DELETE CASCADE,
+    invitee_email VARCHAR(255),
+    can_edit BOOLEAN NOT NULL DEFAULT TRUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    responded_at TIMESTAMPTZ,
+    CHECK (invitee_id IS NOT NULL OR invitee_email IS NOT NULL),
+    CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_collaborator_invitations_pending_user
+    ON collaborator_invitations (note_id, invitee_id)
+    WHERE status = 'pending' AND invitee_id IS NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_collaborator_invitations_pending_email
+    ON collaborator_invitations (note_id, LOWER(invitee_email))
+    WHERE status = 'pending' AND invitee_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_collaborator_invitations_invitee
+    ON collaborator_invitations (invitee_id, status);
+
+CREATE INDEX IF NOT EXISTS idx_collaborator_invitations_email
+    ON collaborator_invitations (LOWER(invitee_email))
+    WHERE invitee_id IS NULL;
+
+CREATE OR REPLACE FUNCTION claim_collaborator_invitations() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE collaborator_invitations
+    SET invitee_id = NEW.id
+    WHERE invitee_id IS NULL
+      AND status = 'pending'
+      AND LOWER(invitee_email) = LOWER(NEW.email);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_users_claim_collaborator_invitations
+AFTER INSERT ON users
+FOR EACH ROW EXECUTE FUNCTION claim_collaborator_invitations();
\ No newline at end of file
@@ -0,0 +1,17 @@
+ALTER TABLE collaborator_invitations ADD COLUMN IF NOT EXISTS can_edit BOOLEAN NOT NULL DEFAULT TRUE;
+UPDATE collaborator_invitations SET can_edit = role IN ('editor', 'manager');
+ALTER TABLE collaborator_invitations DROP COLUMN IF EXISTS role;
+
+ALTER TABLE note_invite_links ADD COLUMN IF NOT EXISTS can_edit BOOLEAN NOT NULL DEFAULT TRUE;
+UPDATE note_invite_links SET can_edit = role IN ('editor', 'manager');
+ALTER TABLE note_invite_links DROP COLUMN IF EXISTS role;
+
+ALTER TABLE folder_collaborators ADD COLUMN IF NOT EXISTS can_edit BOOLEAN NOT NULL DEFAULT TRUE;
+UPDATE folder_collaborators SET can_edit = role IN ('editor', 'manager');
+ALTER TABLE folder_collaborators DROP COLUMN IF EXISTS role;
+
+ALTER TABLE note_collaborators ADD COLUMN IF NOT EXISTS can_edit BOOLEAN NOT NULL DEFAULT TRUE;
+UPDATE note_collaborators SET can_edit = role IN ('editor', 'manager');
+ALTER TABLE note_collaborators DROP COLUMN IF EXISTS role;
+
+DROP FUNCTION IF EXISTS collaborator_role_rank(TEXT);
\ No newline at end of file
@@ -0,0 +1,33 @@
+CREATE OR REPLACE FUNCTION collaborator_role_rank(role TEXT) RETURNS INT AS $$
+    SELECT CASE role
+        WHEN 'viewer' THEN 1
+        WHEN 'commenter' THEN 2
+        WHEN 'editor' THEN 3
+        WHEN 'manager' THEN 4
+        ELSE 0
+    END;
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE note_collaborators
+    ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'editor'
+    CHECK (role IN ('viewer', 'commenter', 'editor', 'manager'));
+UPDATE note_collaborators SET role = CASE WHEN can_edit THEN 'editor' ELSE 'viewer' END;
+ALTER TABLE note_collaborators DROP COLUMN IF EXISTS can_edit;
+
+ALTER TABLE folder_collaborators
+    ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'editor'
+    CHECK (role IN ('viewer', 'commenter', 'editor', 'manager'));
+UPDATE folder_collaborators SET role = CASE WHEN can_edit THEN 'editor' ELSE 'viewer' END;
+ALTER TABLE folder_collaborators DROP COLUMN IF EXISTS can_edit;
+
+ALTER TABLE note_invite_links
+    ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'editor'
+    CHECK (role IN ('viewer', 'commenter', 'editor', 'manager'));
+UPDATE note_invite_links SET role = CASE WHEN can_edit THEN 'editor' ELSE 'viewer' END;
+ALTER TABLE note_invite_links DROP COLUMN IF EXISTS can_edit;
+
+ALTER TABLE collaborator_invitations
+    ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'editor'
+    CHECK (role IN ('viewer', 'commenter', 'editor', 'manager'));
+UPDATE collaborator_invitations SET role = CASE WHEN can_edit THEN 'editor' ELSE 'viewer' END;
+ALTER TABLE collaborator_invitations DROP COLUMN IF EXISTS can_edit;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS note_audit_log;
+DROP TABLE IF EXISTS note_ownership_transfers;
\ No newline at end of file
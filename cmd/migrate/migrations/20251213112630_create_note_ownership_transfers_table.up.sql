@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS note_ownership_transfers (
+    id BIGSERIAL PRIMARY KEY,
+    note_id BIGINT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    from_user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    to_user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    keep_access BOOLEAN NOT NULL DEFAULT TRUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    responded_at TIMESTAMPTZ,
+    CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_note_ownership_transfers_pending
+    ON note_ownership_transfers (note_id)
+    WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_note_ownership_transfers_to_user
+    ON note_ownership_transfers (to_user_id, status);
+
+CREATE TABLE IF NOT EXISTS note_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    note_id BIGINT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    actor_id BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    action VARCHAR(50) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_note_audit_log_note_id ON note_audit_log (note_id, created_at DESC);
\ No newline at end of file
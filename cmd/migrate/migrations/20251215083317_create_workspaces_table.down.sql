@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS trg_users_claim_workspace_invitations ON users;
+DROP FUNCTION IF EXISTS claim_workspace_invitations();
+DROP FUNCTION IF EXISTS note_workspace_role(BIGINT, BIGINT);
+DROP INDEX IF EXISTS idx_notes_workspace_id;
+ALTER TABLE notes DROP COLUMN IF EXISTS workspace_role;
+ALTER TABLE notes DROP COLUMN IF EXISTS workspace_id;
+DROP TABLE IF EXISTS workspace_invitations;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
\ No newline at end of file
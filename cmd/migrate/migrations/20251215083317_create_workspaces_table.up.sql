@@ -0,0 +1,81 @@
+CREATE TABLE IF NOT EXISTS workspaces (
+    id BIGSERIAL PRIMARY KEY,
+    owner_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    default_role VARCHAR(20) NOT NULL DEFAULT 'editor',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (default_role IN ('none', 'viewer', 'commenter', 'editor', 'manager'))
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id BIGINT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'member',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id),
+    CHECK (role IN ('owner', 'admin', 'member', 'viewer'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_members_user_id ON workspace_members (user_id);
+
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id BIGINT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    inviter_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    invitee_id BIGINT REFERENCES users (id) ON DELETE CASCADE,
+    invitee_email VARCHAR(255),
+    role VARCHAR(20) NOT NULL DEFAULT 'member',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    responded_at TIMESTAMPTZ,
+    CHECK (invitee_id IS NOT NULL OR invitee_email IS NOT NULL),
+    CHECK (role IN ('admin', 'member', 'viewer')),
+    CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workspace_invitations_pending_user
+    ON workspace_invitations (workspace_id, invitee_id)
+    WHERE status = 'pending' AND invitee_id IS NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workspace_invitations_pending_email
+    ON workspace_invitations (workspace_id, LOWER(invitee_email))
+    WHERE status = 'pending' AND invitee_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_workspace_invitations_invitee
+    ON workspace_invitations (invitee_id, status);
+
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS workspace_id BIGINT REFERENCES workspaces (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS workspace_role VARCHAR(20)
+    CHECK (workspace_role IN ('none', 'viewer', 'commenter', 'editor', 'manager'));
+
+CREATE INDEX IF NOT EXISTS idx_notes_workspace_id ON notes (workspace_id);
+
+CREATE OR REPLACE FUNCTION note_workspace_role(p_note_id BIGINT, p_user_id BIGINT) RETURNS TEXT AS $$
+    SELECT CASE
+        WHEN wm.role IN ('owner', 'admin') THEN 'manager'
+        WHEN COALESCE(n.workspace_role, w.default_role) = 'none' THEN NULL
+        WHEN wm.role = 'viewer' THEN 'viewer'
+        ELSE COALESCE(n.workspace_role, w.default_role)
+    END
+    FROM notes n
+    JOIN workspaces w ON w.id = n.workspace_id
+    JOIN workspace_members wm ON wm.workspace_id = w.id AND wm.user_id = p_user_id
+    WHERE n.id = p_note_id;
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION claim_workspace_invitations() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE workspace_invitations
+    SET invitee_id = NEW.id
+    WHERE invitee_id IS NULL
+      AND status = 'pending'
+      AND LOWER(invitee_email) = LOWER(NEW.email);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_users_claim_workspace_invitations
+AFTER INSERT ON users
+FOR EACH ROW EXECUTE FUNCTION claim_workspace_invitations();
\ No newline at end of file
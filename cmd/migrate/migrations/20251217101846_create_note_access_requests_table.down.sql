@@ -0,0 +1 @@
+DROP TABLE IF EXISTS note_access_requests;
\ No newline at end of file
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS note_access_requests (
+    id BIGSERIAL PRIMARY KEY,
+    note_id BIGINT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    requester_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'viewer',
+    message TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    reviewer_id BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    responded_at TIMESTAMPTZ,
+    CHECK (role IN ('viewer', 'commenter', 'editor', 'manager')),
+    CHECK (status IN ('pending', 'approved', 'denied', 'cancelled'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_note_access_requests_pending
+    ON note_access_requests (note_id, requester_id)
+    WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_note_access_requests_requester
+    ON note_access_requests (requester_id, created_at DESC);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS notifications;
+DROP INDEX IF EXISTS idx_note_collaborators_expires_at;
+ALTER TABLE note_collaborators DROP COLUMN IF EXISTS expires_at;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE note_collaborators
+    DROP COLUMN IF EXISTS last_active_at,
+    DROP COLUMN IF EXISTS added_by;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE note_collaborators
+    ADD COLUMN IF NOT EXISTS added_by BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS last_active_at TIMESTAMPTZ;
@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS trg_users_claim_collaborator_invitations ON users;
+DROP TRIGGER IF EXISTS trg_users_claim_workspace_invitations ON users;
+
+CREATE TRIGGER trg_users_claim_collaborator_invitations
+AFTER INSERT ON users
+FOR EACH ROW EXECUTE FUNCTION claim_collaborator_invitations();
+
+CREATE TRIGGER trg_users_claim_workspace_invitations
+AFTER INSERT ON users
+FOR EACH ROW EXECUTE FUNCTION claim_workspace_invitations();
@@ -0,0 +1,56 @@
+-- Email invitations used to be claimed by whoever registered the address.
+-- Claim them only once the address is verified, at sign-up for providers
+-- that vouch for it or later through the verification link.
+DROP TRIGGER IF EXISTS trg_users_claim_collaborator_invitations ON users;
+DROP TRIGGER IF EXISTS trg_users_claim_workspace_invitations ON users;
+
+CREATE OR REPLACE FUNCTION claim_collaborator_invitations() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE collaborator_invitations
+    SET invitee_id = NEW.id
+    WHERE invitee_id IS NULL
+      AND status = 'pending'
+      AND LOWER(invitee_email) = LOWER(NEW.email);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION claim_workspace_invitations() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE workspace_invitations
+    SET invitee_id = NEW.id
+    WHERE invitee_id IS NULL
+      AND status = 'pending'
+      AND LOWER(invitee_email) = LOWER(NEW.email);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_users_claim_collaborator_invitations
+AFTER INSERT OR UPDATE OF email_verified_at ON users
+FOR EACH ROW
+WHEN (NEW.email_verified_at IS NOT NULL)
+EXECUTE FUNCTION claim_collaborator_invitations();
+
+CREATE TRIGGER trg_users_claim_workspace_invitations
+AFTER INSERT OR UPDATE OF email_verified_at ON users
+FOR EACH ROW
+WHEN (NEW.email_verified_at IS NOT NULL)
+EXECUTE FUNCTION claim_workspace_invitations();
+
+-- Release pending email invitations already claimed by unverified accounts.
+UPDATE collaborator_invitations i
+SET invitee_id = NULL
+FROM users u
+WHERE u.id = i.invitee_id
+  AND i.status = 'pending'
+  AND i.invitee_email IS NOT NULL
+  AND u.email_verified_at IS NULL;
+
+UPDATE workspace_invitations i
+SET invitee_id = NULL
+FROM users u
+WHERE u.id = i.invitee_id
+  AND i.status = 'pending'
+  AND i.invitee_email IS NOT NULL
+  AND u.email_verified_at IS NULL;
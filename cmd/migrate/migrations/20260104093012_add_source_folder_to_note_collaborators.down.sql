@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_note_collaborators_source_folder;
+ALTER TABLE note_collaborators DROP COLUMN IF EXISTS source_folder_id;
@@ -0,0 +1,35 @@
+-- Grants copied from a folder share record the folder they came from, so
+-- unsharing or moving only ever touches those rows. NULL marks a direct grant.
+ALTER TABLE note_collaborators
+    ADD COLUMN IF NOT EXISTS source_folder_id BIGINT REFERENCES folders (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_note_collaborators_source_folder
+    ON note_collaborators (source_folder_id)
+    WHERE source_folder_id IS NOT NULL;
+
+-- Existing rows that match what their folders grant and have no expiry are
+-- taken to be folder-derived when the owner added them, or when they predate
+-- added_by and so record nobody.
+WITH RECURSIVE chain AS (
+    SELECT n.id AS note_id, n.owner_id, n.folder_id
+    FROM notes n
+    WHERE n.folder_id IS NOT NULL
+    UNION ALL
+    SELECT c.note_id, c.owner_id, f.parent_id
+    FROM chain c
+    JOIN folders f ON f.id = c.folder_id
+    WHERE f.parent_id IS NOT NULL
+), granted AS (
+    SELECT DISTINCT ON (c.note_id, fc.user_id) c.note_id, fc.user_id, fc.role, fc.folder_id, c.owner_id
+    FROM chain c
+    JOIN folder_collaborators fc ON fc.folder_id = c.folder_id
+    ORDER BY c.note_id, fc.user_id, collaborator_role_rank(fc.role) DESC, fc.folder_id
+)
+UPDATE note_collaborators nc
+SET source_folder_id = g.folder_id
+FROM granted g
+WHERE nc.note_id = g.note_id
+  AND nc.user_id = g.user_id
+  AND nc.role = g.role
+  AND nc.expires_at IS NULL
+  AND (nc.added_by IS NULL OR nc.added_by = g.owner_id);
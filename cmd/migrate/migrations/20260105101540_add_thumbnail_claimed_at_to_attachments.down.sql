@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_attachments_thumbnail_processing;
+ALTER TABLE attachments DROP COLUMN IF EXISTS thumbnail_claimed_at;
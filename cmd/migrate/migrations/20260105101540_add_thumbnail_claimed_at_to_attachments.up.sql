@@ -0,0 +1,9 @@
+-- Claims carry a timestamp so thumbnails left 'processing' by a stopped
+-- instance can be picked up again.
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS thumbnail_claimed_at TIMESTAMPTZ;
+
+UPDATE attachments SET thumbnail_claimed_at = NOW() WHERE thumbnail_status = 'processing';
+
+CREATE INDEX IF NOT EXISTS idx_attachments_thumbnail_processing
+    ON attachments (thumbnail_claimed_at)
+    WHERE thumbnail_status = 'processing';
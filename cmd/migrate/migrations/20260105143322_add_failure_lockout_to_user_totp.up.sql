@@ -0,0 +1,5 @@
+-- Wrong second-factor codes are counted per user, across challenges and
+-- instances, and every few of them lock the second step for a while.
+ALTER TABLE user_totp
+    ADD COLUMN IF NOT EXISTS failed_attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
@@ -3,6 +3,8 @@ package configs
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -16,6 +18,40 @@ type Config struct {
 	DBPort     string
 	DBName     string
 	JWTSecret  string
+
+	BlobBackend       string
+	BlobLocalDir      string
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKey       string
+	S3SecretKey       string
+	MaxAttachmentSize int64
+
+	AppURL        string
+	MailBackend   string
+	MailOutboxDir string
+	MailFrom      string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
+
+	UnverifiedRestrictions string
+
+	OIDCRedirectURL string
+	OIDCProviders   []OIDCProviderConfig
+}
+
+// OIDCProviderConfig describes one identity provider. Each name listed in
+// OIDC_PROVIDERS is configured through OIDC_<NAME>_* variables.
+type OIDCProviderConfig struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
 }
 
 var Envs Config
@@ -36,5 +72,70 @@ func init() {
 		DBPort:     os.Getenv("DB_PORT"),
 		DBName:     os.Getenv("DB_NAME"),
 		JWTSecret:  os.Getenv("JWT_SECRET"),
+
+		BlobBackend:       getEnv("BLOB_BACKEND", "local"),
+		BlobLocalDir:      getEnv("BLOB_LOCAL_DIR", "data/blobs"),
+		S3Endpoint:        os.Getenv("S3_ENDPOINT"),
+		S3Region:          getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:          os.Getenv("S3_BUCKET"),
+		S3AccessKey:       os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:       os.Getenv("S3_SECRET_KEY"),
+		MaxAttachmentSize: getEnvInt("MAX_ATTACHMENT_SIZE", 25<<20),
+
+		AppURL:        getEnv("APP_URL", "http://localhost:3000"),
+		MailBackend:   getEnv("MAIL_BACKEND", "outbox"),
+		MailOutboxDir: getEnv("MAIL_OUTBOX_DIR", "data/outbox"),
+		MailFrom:      getEnv("MAIL_FROM", "Layer <no-reply@localhost>"),
+		SMTPHost:      os.Getenv("SMTP_HOST"),
+		SMTPPort:      getEnv("SMTP_PORT", "587"),
+		SMTPUsername:  os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:  os.Getenv("SMTP_PASSWORD"),
+
+		UnverifiedRestrictions: getEnv("UNVERIFIED_RESTRICTIONS", "invite,share"),
+
+		OIDCRedirectURL: getEnv("OIDC_REDIRECT_URL", "http://localhost:3000/auth/callback"),
+		OIDCProviders:   loadOIDCProviders(),
+	}
+}
+
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			DisplayName:  getEnv(prefix+"DISPLAY_NAME", name),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+		})
+	}
+	return providers
+}
+
+func getEnv(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int64) int64 {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		log.Printf("Warning: invalid %s=%q, using %d", key, v, fallback)
+		return fallback
 	}
+	return i
 }
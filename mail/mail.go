@@ -0,0 +1,24 @@
+package mail
+
+import (
+	"fmt"
+	"layer-api/configs"
+	"layer-api/types"
+)
+
+func NewFromConfig(cfg configs.Config) (types.Mailer, error) {
+	switch cfg.MailBackend {
+	case "", "outbox":
+		return NewOutbox(cfg.MailOutboxDir)
+	case "smtp":
+		return NewSMTPMailer(SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q", cfg.MailBackend)
+	}
+}
@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"fmt"
+	"layer-api/types"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Outbox is a Mailer for development and tests. Messages are logged and,
+// when a directory is configured, written there as .eml files instead of
+// being delivered.
+type Outbox struct {
+	dir string
+	seq atomic.Int64
+}
+
+func NewOutbox(dir string) (*Outbox, error) {
+	if dir == "" {
+		return &Outbox{}, nil
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0o750); err != nil {
+		return nil, err
+	}
+	return &Outbox{dir: abs}, nil
+}
+
+func (o *Outbox) Send(msg types.EmailMessage) error {
+	log.Printf("mail: to=%s subject=%q", msg.To, msg.Subject)
+	if o.dir == "" {
+		log.Printf("mail: body:\n%s", msg.Body)
+		return nil
+	}
+
+	name := fmt.Sprintf("%s-%04d-%s.eml",
+		time.Now().UTC().Format("20060102T150405"),
+		o.seq.Add(1)%10000,
+		sanitize(msg.To),
+	)
+	return os.WriteFile(filepath.Join(o.dir, name), formatMessage("outbox@localhost", msg), 0o640)
+}
+
+func sanitize(addr string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, addr)
+}
@@ -0,0 +1,247 @@
+// Package oidc is a small OpenID Connect relying party: discovery, the
+// authorization code flow with PKCE and ID token validation against the
+// provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"layer-api/configs"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryTTL is how long provider metadata and signing keys are reused
+// before being fetched again.
+const discoveryTTL = time.Hour
+
+type Provider struct {
+	Name        string
+	DisplayName string
+
+	issuer       string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	client       *http.Client
+
+	mu        sync.Mutex
+	meta      *metadata
+	fetchedAt time.Time
+	keys      *keySet
+}
+
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// NewFromConfig builds the configured providers keyed by name. Discovery
+// happens lazily, so an unreachable provider does not stop the server.
+func NewFromConfig(cfg configs.Config) (map[string]*Provider, error) {
+	providers := make(map[string]*Provider, len(cfg.OIDCProviders))
+	for _, pc := range cfg.OIDCProviders {
+		if pc.Issuer == "" || pc.ClientID == "" {
+			return nil, fmt.Errorf("oidc provider %q needs an issuer and client ID", pc.Name)
+		}
+		if _, dup := providers[pc.Name]; dup {
+			return nil, fmt.Errorf("oidc provider %q is configured twice", pc.Name)
+		}
+
+		providers[pc.Name] = &Provider{
+			Name:         pc.Name,
+			DisplayName:  pc.DisplayName,
+			issuer:       strings.TrimRight(pc.Issuer, "/"),
+			clientID:     pc.ClientID,
+			clientSecret: pc.ClientSecret,
+			scopes:       pc.Scopes,
+			client:       &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+	return providers, nil
+}
+
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil && time.Since(p.fetchedAt) < discoveryTTL {
+		return p.meta, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", p.Name, err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("oidc discovery for %s: issuer mismatch %q", p.Name, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery for %s: incomplete provider metadata", p.Name)
+	}
+
+	if p.meta == nil || p.meta.JWKSURI != meta.JWKSURI {
+		p.keys = newKeySet(meta.JWKSURI, p.getJSON)
+	}
+	p.meta = &meta
+	p.fetchedAt = time.Now()
+	return p.meta, nil
+}
+
+// AuthCodeURL returns where to send the browser to sign in. state and nonce
+// are echoed back; codeChallenge comes from NewPKCE.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURI, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("scope", strings.Join(p.scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and verifies the ID token that
+// comes back against nonce.
+func (p *Provider) Exchange(ctx context.Context, redirectURI, code, codeVerifier, nonce string) (*Claims, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", codeVerifier)
+
+	basic := p.clientSecret != "" && supportsBasicAuth(meta.TokenAuthMethods)
+	if !basic {
+		form.Set("client_id", p.clientID)
+		if p.clientSecret != "" {
+			form.Set("client_secret", p.clientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("oidc token response from %s: %w", p.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, &ExchangeError{Code: token.Error, Description: token.ErrorDescription, Status: resp.StatusCode}
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("oidc token response from %s has no id_token", p.Name)
+	}
+
+	return p.verifyIDToken(ctx, meta, token.IDToken, nonce)
+}
+
+// ExchangeError is a rejection from the token endpoint, usually because
+// the code was already used or has expired.
+type ExchangeError struct {
+	Code        string
+	Description string
+	Status      int
+}
+
+func (e *ExchangeError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oidc token exchange failed: %s (%s)", e.Code, e.Description)
+	}
+	return fmt.Sprintf("oidc token exchange failed: %s (status %d)", e.Code, e.Status)
+}
+
+func supportsBasicAuth(methods []string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if m == "client_secret_basic" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// NewPKCE returns a code verifier and its S256 challenge.
+func NewPKCE() (string, string, error) {
+	verifier, err := RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func RandomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,623 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"layer-api/configs"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "layer-web"
+	testClientSecret = "s3cret"
+	testRedirectURI  = "https://app.test/auth/callback"
+)
+
+var (
+	keysOnce sync.Once
+	testKeys [2]*rsa.PrivateKey
+)
+
+// rsaKeys generates two signing keys once for the whole package.
+func rsaKeys(t *testing.T) (*rsa.PrivateKey, *rsa.PrivateKey) {
+	t.Helper()
+
+	keysOnce.Do(func() {
+		for i := range testKeys {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				panic(err)
+			}
+			testKeys[i] = key
+		}
+	})
+	return testKeys[0], testKeys[1]
+}
+
+// fakeIdP is an httptest identity provider serving discovery, a JWKS whose
+// keys can be rotated, and a token endpoint that hands out whatever ID token
+// the test queued for a code.
+type fakeIdP struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu             sync.Mutex
+	issuer         string
+	authMethods    []string
+	jwks           map[string]*rsa.PublicKey
+	codes          map[string]string
+	challenges     map[string]string
+	discoveryHits  int
+	jwksHits       int
+	lastTokenForm  url.Values
+	lastTokenBasic [2]string
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+
+	idp := &fakeIdP{
+		t:          t,
+		jwks:       make(map[string]*rsa.PublicKey),
+		codes:      make(map[string]string),
+		challenges: make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.handleDiscovery)
+	mux.HandleFunc("/jwks", idp.handleJWKS)
+	mux.HandleFunc("/token", idp.handleToken)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+
+	idp.issuer = idp.srv.URL
+	return idp
+}
+
+func (idp *fakeIdP) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	idp.discoveryHits++
+	json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                idp.issuer,
+		"authorization_endpoint":                idp.srv.URL + "/authorize",
+		"token_endpoint":                        idp.srv.URL + "/token",
+		"jwks_uri":                              idp.srv.URL + "/jwks",
+		"token_endpoint_auth_methods_supported": idp.authMethods,
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (idp *fakeIdP) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	idp.jwksHits++
+	keys := []map[string]string{
+		// Encryption keys and unsupported types are skipped, not fatal.
+		{"kid": "enc", "kty": "RSA", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{"kid": "oct", "kty": "oct"},
+	}
+	for kid, pub := range idp.jwks {
+		keys = append(keys, map[string]string{
+			"kid": kid,
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+}
+
+func (idp *fakeIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idp.lastTokenForm = r.PostForm
+	user, pass, _ := r.BasicAuth()
+	idp.lastTokenBasic = [2]string{user, pass}
+
+	code := r.PostForm.Get("code")
+	idToken, ok := idp.codes[code]
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenges[code] {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":             "invalid_grant",
+			"error_description": "code is invalid or expired",
+		})
+		return
+	}
+	delete(idp.codes, code)
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "at",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (idp *fakeIdP) publish(kid string, key *rsa.PrivateKey) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.jwks[kid] = &key.PublicKey
+}
+
+func (idp *fakeIdP) retire(kid string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	delete(idp.jwks, kid)
+}
+
+// issue queues idToken for code, to be redeemed with the verifier behind
+// challenge.
+func (idp *fakeIdP) issue(code, challenge, idToken string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.codes[code] = idToken
+	idp.challenges[code] = challenge
+}
+
+func (idp *fakeIdP) hits() (int, int) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	return idp.discoveryHits, idp.jwksHits
+}
+
+// claims returns a valid claim set for the fake provider.
+func (idp *fakeIdP) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            idp.issuer,
+		"sub":            "user-123",
+		"aud":            testClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          "ada@example.com",
+		"email_verified": "true",
+		"name":           "Ada",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return raw
+}
+
+func newTestProvider(t *testing.T, issuer, secret string) *Provider {
+	t.Helper()
+
+	providers, err := NewFromConfig(configs.Config{
+		OIDCProviders: []configs.OIDCProviderConfig{{
+			Name:         "test",
+			DisplayName:  "Test IdP",
+			Issuer:       issuer + "/",
+			ClientID:     testClientID,
+			ClientSecret: secret,
+			Scopes:       []string{"openid", "email"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewFromConfig: %v", err)
+	}
+	return providers["test"]
+}
+
+func TestNewFromConfig(t *testing.T) {
+	cases := []struct {
+		name      string
+		providers []configs.OIDCProviderConfig
+	}{
+		{"missing issuer", []configs.OIDCProviderConfig{{Name: "a", ClientID: "c"}}},
+		{"missing client", []configs.OIDCProviderConfig{{Name: "a", Issuer: "https://idp.test"}}},
+		{"duplicate", []configs.OIDCProviderConfig{
+			{Name: "a", Issuer: "https://idp.test", ClientID: "c"},
+			{Name: "a", Issuer: "https://other.test", ClientID: "c"},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewFromConfig(configs.Config{OIDCProviders: tc.providers}); err == nil {
+				t.Fatal("invalid configuration accepted")
+			}
+		})
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := newTestProvider(t, idp.issuer, testClientSecret)
+	ctx := context.Background()
+
+	_, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+
+	raw, err := p.AuthCodeURL(ctx, testRedirectURI, "st", "nn", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parsing auth URL: %v", err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != idp.srv.URL+"/authorize" {
+		t.Fatalf("auth endpoint = %q", got)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURI,
+		"scope":                 "openid email",
+		"state":                 "st",
+		"nonce":                 "nn",
+		"code_challenge":        challenge,
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if got := u.Query().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+
+	if _, err := p.AuthCodeURL(ctx, testRedirectURI, "st2", "nn2", challenge); err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if discovery, _ := idp.hits(); discovery != 1 {
+		t.Fatalf("discovery fetched %d times, want 1 while cached", discovery)
+	}
+
+	p.mu.Lock()
+	p.fetchedAt = time.Now().Add(-discoveryTTL - time.Second)
+	p.mu.Unlock()
+	if _, err := p.AuthCodeURL(ctx, testRedirectURI, "st3", "nn3", challenge); err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if discovery, _ := idp.hits(); discovery != 2 {
+		t.Fatalf("discovery fetched %d times, want a refetch after the TTL", discovery)
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.issuer = "https://impostor.test"
+	p := newTestProvider(t, idp.srv.URL, testClientSecret)
+
+	_, err := p.AuthCodeURL(context.Background(), testRedirectURI, "s", "n", "c")
+	if err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Fatalf("AuthCodeURL = %v, want an issuer mismatch", err)
+	}
+}
+
+func TestDiscoveryUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	p := newTestProvider(t, srv.URL, testClientSecret)
+
+	if _, err := p.AuthCodeURL(context.Background(), testRedirectURI, "s", "n", "c"); err == nil {
+		t.Fatal("AuthCodeURL succeeded without provider metadata")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	key, _ := rsaKeys(t)
+	idp := newFakeIdP(t)
+	idp.publish("k1", key)
+	ctx := context.Background()
+
+	t.Run("client secret basic", func(t *testing.T) {
+		p := newTestProvider(t, idp.issuer, testClientSecret)
+		verifier, challenge, err := NewPKCE()
+		if err != nil {
+			t.Fatalf("NewPKCE: %v", err)
+		}
+		idp.issue("code-1", challenge, sign(t, jwt.SigningMethodRS256, key, "k1", idp.claims("nonce-1")))
+
+		claims, err := p.Exchange(ctx, testRedirectURI, "code-1", verifier, "nonce-1")
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+		if claims.Subject != "user-123" || claims.Email != "ada@example.com" || !claims.IsEmailVerified() {
+			t.Fatalf("claims = %+v", claims)
+		}
+
+		idp.mu.Lock()
+		form, basic := idp.lastTokenForm, idp.lastTokenBasic
+		idp.mu.Unlock()
+		if basic != [2]string{testClientID, testClientSecret} {
+			t.Fatalf("basic auth = %v", basic)
+		}
+		if form.Get("client_secret") != "" {
+			t.Fatal("client secret sent in the form alongside basic auth")
+		}
+		if form.Get("grant_type") != "authorization_code" || form.Get("redirect_uri") != testRedirectURI {
+			t.Fatalf("token form = %v", form)
+		}
+
+		// Codes are single use.
+		_, err = p.Exchange(ctx, testRedirectURI, "code-1", verifier, "nonce-1")
+		var exErr *ExchangeError
+		if !errors.As(err, &exErr) || exErr.Code != "invalid_grant" || exErr.Status != http.StatusBadRequest {
+			t.Fatalf("second Exchange = %v, want an invalid_grant ExchangeError", err)
+		}
+	})
+
+	t.Run("client secret post", func(t *testing.T) {
+		idp.mu.Lock()
+		idp.authMethods = []string{"client_secret_post"}
+		idp.mu.Unlock()
+		defer func() {
+			idp.mu.Lock()
+			idp.authMethods = nil
+			idp.mu.Unlock()
+		}()
+
+		p := newTestProvider(t, idp.issuer, testClientSecret)
+		verifier, challenge, _ := NewPKCE()
+		idp.issue("code-2", challenge, sign(t, jwt.SigningMethodRS256, key, "k1", idp.claims("nonce-2")))
+
+		if _, err := p.Exchange(ctx, testRedirectURI, "code-2", verifier, "nonce-2"); err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+
+		idp.mu.Lock()
+		form, basic := idp.lastTokenForm, idp.lastTokenBasic
+		idp.mu.Unlock()
+		if basic[0] != "" {
+			t.Fatal("basic auth used although the provider only takes client_secret_post")
+		}
+		if form.Get("client_id") != testClientID || form.Get("client_secret") != testClientSecret {
+			t.Fatalf("token form = %v", form)
+		}
+	})
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		p := newTestProvider(t, idp.issuer, testClientSecret)
+		_, challenge, _ := NewPKCE()
+		other, _, _ := NewPKCE()
+		idp.issue("code-3", challenge, sign(t, jwt.SigningMethodRS256, key, "k1", idp.claims("nonce-3")))
+
+		var exErr *ExchangeError
+		if _, err := p.Exchange(ctx, testRedirectURI, "code-3", other, "nonce-3"); !errors.As(err, &exErr) {
+			t.Fatalf("Exchange with the wrong verifier = %v, want an ExchangeError", err)
+		}
+	})
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key, other := rsaKeys(t)
+	idp := newFakeIdP(t)
+	idp.publish("k1", key)
+	p := newTestProvider(t, idp.issuer, testClientSecret)
+	ctx := context.Background()
+
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+
+	with := func(changes map[string]any) jwt.MapClaims {
+		c := idp.claims("nonce")
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	now := time.Now()
+
+	cases := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr bool
+	}{
+		{"valid", sign(t, jwt.SigningMethodRS256, key, "k1", with(nil)), "nonce", false},
+		{"valid PS256", sign(t, jwt.SigningMethodPS256, key, "k1", with(nil)), "nonce", false},
+		{"audience list with azp", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"aud": []string{testClientID, "other"}, "azp": testClientID,
+		})), "nonce", false},
+		{"single audience with matching azp", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"azp": testClientID,
+		})), "nonce", false},
+		{"expiry within leeway", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"exp": now.Add(-30 * time.Second).Unix(),
+		})), "nonce", false},
+		{"no kid with a single key", sign(t, jwt.SigningMethodRS256, key, "", with(nil)), "nonce", false},
+
+		{"wrong issuer", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"iss": "https://impostor.test",
+		})), "nonce", true},
+		{"wrong audience", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"aud": "someone-else",
+		})), "nonce", true},
+		{"audience list without azp", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"aud": []string{testClientID, "other"},
+		})), "nonce", true},
+		{"audience list with foreign azp", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"aud": []string{testClientID, "other"}, "azp": "other",
+		})), "nonce", true},
+		{"single audience with foreign azp", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"azp": "other",
+		})), "nonce", true},
+		{"nonce mismatch", sign(t, jwt.SigningMethodRS256, key, "k1", with(nil)), "another", true},
+		{"empty expected nonce", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"nonce": "",
+		})), "", true},
+		{"expired", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"exp": now.Add(-5 * time.Minute).Unix(),
+		})), "nonce", true},
+		{"missing expiry", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"exp": nil,
+		})), "nonce", true},
+		{"issued in the future", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"iat": now.Add(10 * time.Minute).Unix(),
+		})), "nonce", true},
+		{"missing subject", sign(t, jwt.SigningMethodRS256, key, "k1", with(map[string]any{
+			"sub": nil,
+		})), "nonce", true},
+		{"signed by another key", sign(t, jwt.SigningMethodRS256, other, "k1", with(nil)), "nonce", true},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, other, "k9", with(nil)), "nonce", true},
+		{"symmetric algorithm", sign(t, jwt.SigningMethodHS256, []byte(testClientSecret), "k1", with(nil)), "nonce", true},
+		{"unsigned", sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "k1", with(nil)), "nonce", true},
+		{"malformed", "not.a.jwt", "nonce", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := p.verifyIDToken(ctx, meta, tc.token, tc.nonce)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("token accepted: %+v", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyIDToken: %v", err)
+			}
+			if claims.Subject != "user-123" {
+				t.Fatalf("subject = %q", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldKey, newKey := rsaKeys(t)
+	idp := newFakeIdP(t)
+	idp.publish("old", oldKey)
+	p := newTestProvider(t, idp.issuer, testClientSecret)
+	ctx := context.Background()
+
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+	verify := func(key *rsa.PrivateKey, kid string) error {
+		_, err := p.verifyIDToken(ctx, meta, sign(t, jwt.SigningMethodRS256, key, kid, idp.claims("n")), "n")
+		return err
+	}
+
+	if err := verify(oldKey, "old"); err != nil {
+		t.Fatalf("token under the original key: %v", err)
+	}
+	if err := verify(oldKey, "old"); err != nil {
+		t.Fatalf("token under the original key: %v", err)
+	}
+	if _, jwks := idp.hits(); jwks != 1 {
+		t.Fatalf("jwks fetched %d times, want 1 while the key is cached", jwks)
+	}
+
+	idp.publish("new", newKey)
+	idp.retire("old")
+
+	// An unknown kid right after a fetch does not hammer the provider.
+	if err := verify(newKey, "new"); err == nil {
+		t.Fatal("rotated key accepted before a refetch was allowed")
+	}
+	if _, jwks := idp.hits(); jwks != 1 {
+		t.Fatalf("jwks fetched %d times, want the refetch throttled", jwks)
+	}
+
+	p.keys.mu.Lock()
+	p.keys.fetchedAt = time.Now().Add(-2 * time.Minute)
+	p.keys.mu.Unlock()
+
+	if err := verify(newKey, "new"); err != nil {
+		t.Fatalf("token under the rotated key: %v", err)
+	}
+	if _, jwks := idp.hits(); jwks != 2 {
+		t.Fatalf("jwks fetched %d times, want one refetch for the new kid", jwks)
+	}
+
+	if err := verify(oldKey, "old"); err == nil {
+		t.Fatal("token under a retired key accepted after the refetch")
+	}
+
+	// Once the cache is older than the TTL, even known keys are refetched.
+	idp.publish("old", oldKey)
+	p.keys.mu.Lock()
+	p.keys.fetchedAt = time.Now().Add(-discoveryTTL - time.Second)
+	p.keys.mu.Unlock()
+	if err := verify(oldKey, "old"); err != nil {
+		t.Fatalf("token under a republished key: %v", err)
+	}
+	if _, jwks := idp.hits(); jwks != 3 {
+		t.Fatalf("jwks fetched %d times, want a refetch after the TTL", jwks)
+	}
+}
+
+func TestFlexBool(t *testing.T) {
+	cases := map[string]bool{
+		`true`:    true,
+		`false`:   false,
+		`"true"`:  true,
+		`"false"`: false,
+		`"yes"`:   false,
+		`1`:       false,
+		`null`:    false,
+	}
+	for input, want := range cases {
+		var b flexBool
+		if err := json.Unmarshal([]byte(input), &b); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", input, err)
+		}
+		if bool(b) != want {
+			t.Errorf("Unmarshal(%s) = %v, want %v", input, b, want)
+		}
+	}
+}
+
+func TestNewPKCE(t *testing.T) {
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	if len(verifier) < 43 {
+		t.Fatalf("verifier %q is shorter than RFC 7636 allows", verifier)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if challenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Fatal("challenge is not the S256 of the verifier")
+	}
+
+	again, _, _ := NewPKCE()
+	if again == verifier {
+		t.Fatal("NewPKCE returned the same verifier twice")
+	}
+}
@@ -0,0 +1,53 @@
+package attachment
+
+import (
+	"layer-api/types"
+	"log"
+	"time"
+)
+
+// RunBlobCleaner deletes blobs whose attachment rows are gone. Rows are
+// queued by a database trigger, so notes purged through any path (folder
+// cascades, account deletion) release their storage too.
+func RunBlobCleaner(store types.AttachmentStore, blobs types.BlobStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cleanBlobs(store, blobs)
+		<-ticker.C
+	}
+}
+
+func cleanBlobs(store types.AttachmentStore, blobs types.BlobStore) {
+	for {
+		pending, err := store.ListPendingBlobDeletions(100)
+		if err != nil {
+			log.Println("blob cleaner error:", err)
+			return
+		}
+		if len(pending) == 0 {
+			return
+		}
+
+		failed := 0
+		for _, d := range pending {
+			if err := blobs.Delete(d.StorageKey); err != nil {
+				log.Println("blob cleaner delete error:", err)
+				failed++
+				if err := store.FailBlobDeletion(d.ID); err != nil {
+					log.Println("blob cleaner error:", err)
+				}
+				continue
+			}
+			if err := store.CompleteBlobDeletion(d.ID); err != nil {
+				log.Println("blob cleaner error:", err)
+				return
+			}
+		}
+
+		if failed > 0 || len(pending) < 100 {
+			return
+		}
+	}
+}
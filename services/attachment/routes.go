@@ -0,0 +1,404 @@
+package attachment
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"layer-api/authz"
+	"layer-api/types"
+	"layer-api/utils"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store      types.AttachmentStore
+	blobs      types.BlobStore
+	authz      *authz.Authorizer
+	thumbnails *ThumbnailWorker
+	maxSize    int64
+}
+
+func NewHandler(
+	store types.AttachmentStore,
+	blobs types.BlobStore,
+	authorizer *authz.Authorizer,
+	thumbnails *ThumbnailWorker,
+	maxSize int64,
+) *Handler {
+	return &Handler{
+		store:      store,
+		blobs:      blobs,
+		authz:      authorizer,
+		thumbnails: thumbnails,
+		maxSize:    maxSize,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.Handle("/notes/{id}/attachments", utils.AuthMiddleware(http.HandlerFunc(h.handleUpload))).Methods("POST")
+	router.Handle("/notes/{id}/attachments", utils.AuthMiddleware(http.HandlerFunc(h.handleList))).Methods("GET")
+	router.Handle("/attachments/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleDownload))).Methods("GET", "HEAD")
+	router.Handle("/attachments/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleDelete))).Methods("DELETE")
+}
+
+func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.checkAccess(r, noteID, userID, true); err != nil {
+		writeAccessError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxSize+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("expected multipart upload"))
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("missing file"))
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid or too large upload"))
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		a, err := h.storeUpload(part, noteID, userID)
+		part.Close()
+		if err != nil {
+			if errors.Is(err, errTooLarge) {
+				utils.WriteError(w, http.StatusRequestEntityTooLarge, err)
+				return
+			}
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusCreated, a)
+		return
+	}
+}
+
+var errTooLarge = errors.New("attachment is too large")
+
+func (h *Handler) storeUpload(part *multipart.Part, noteID, userID int) (*types.Attachment, error) {
+	filename := sanitizeFilename(part.FileName())
+
+	tmp, err := os.CreateTemp("", "layer-attachment-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), io.LimitReader(part, h.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > h.maxSize {
+		return nil, errTooLarge
+	}
+
+	head := make([]byte, 512)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	contentType := http.DetectContentType(head[:n])
+	if contentType == "application/octet-stream" || strings.HasPrefix(contentType, "text/plain") {
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); byExt != "" {
+			contentType = byExt
+		}
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	key, err := newStorageKey(noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.blobs.Put(key, tmp, size, contentType); err != nil {
+		return nil, err
+	}
+
+	a := types.Attachment{
+		NoteID:      noteID,
+		UploaderID:  &userID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		Checksum:    hex.EncodeToString(hasher.Sum(nil)),
+		StorageKey:  key,
+	}
+	if supportsThumbnails(contentType) {
+		a.ThumbnailStatus = types.ThumbnailStatusPending
+	}
+
+	id, err := h.store.CreateAttachment(a)
+	if err != nil {
+		_ = h.blobs.Delete(key)
+		return nil, err
+	}
+
+	if a.ThumbnailStatus == types.ThumbnailStatusPending && h.thumbnails != nil {
+		h.thumbnails.Notify()
+	}
+
+	return h.store.GetAttachmentByID(id)
+}
+
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.checkAccess(r, noteID, userID, false); err != nil {
+		writeAccessError(w, err)
+		return
+	}
+
+	attachments, err := h.store.ListAttachmentsByNote(noteID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for i := range attachments {
+		if attachments[i].ThumbnailStatus != types.ThumbnailStatusReady {
+			continue
+		}
+		variants, err := h.store.ListAttachmentVariants(attachments[i].ID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		attachments[i].Variants = variants
+	}
+
+	utils.WriteJSON(w, http.StatusOK, attachments)
+}
+
+func (h *Handler) handleDownload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	a, err := h.store.GetAttachmentByID(id)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	if err := h.checkAccess(r, a.NoteID, userID, false); err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	storageKey, contentType, filename := a.StorageKey, a.ContentType, a.Filename
+	disposition := "attachment"
+	if r.URL.Query().Get("inline") == "true" {
+		disposition = "inline"
+	}
+
+	if variant := r.URL.Query().Get("variant"); variant != "" && variant != "original" {
+		if !isVariant(variant) {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("unknown variant"))
+			return
+		}
+
+		v, err := h.store.GetAttachmentVariant(a.ID, variant)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				utils.WriteError(w, http.StatusNotFound, fmt.Errorf("variant not available (thumbnail status: %s)", a.ThumbnailStatus))
+				return
+			}
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		storageKey, contentType = v.StorageKey, v.ContentType
+		base := strings.TrimSuffix(a.Filename, filepath.Ext(a.Filename))
+		ext := ".png"
+		if contentType == "image/jpeg" {
+			ext = ".jpg"
+		}
+		filename = base + "-" + variant + ext
+		disposition = "inline"
+	}
+
+	obj, err := h.blobs.Open(storageKey)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("attachment content not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer obj.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	if storageKey == a.StorageKey {
+		w.Header().Set("ETag", `"`+a.Checksum+`"`)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+
+	http.ServeContent(w, r, filename, a.CreatedAt, obj)
+}
+
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	a, err := h.store.GetAttachmentByID(id)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	if err := h.checkAccess(r, a.NoteID, userID, true); err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	if err := h.store.DeleteAttachment(id); err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	if err := h.blobs.Delete(a.StorageKey); err != nil {
+		log.Println("attachment blob delete error:", err)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "attachment deleted"})
+}
+
+func (h *Handler) checkAccess(r *http.Request, noteID, userID int, write bool) error {
+	action := authz.ActionView
+	if write {
+		action = authz.ActionEdit
+	}
+
+	_, _, err := h.authz.Authorize(r.Context(), noteID, userID, action)
+	return err
+}
+
+func writeAccessError(w http.ResponseWriter, err error) {
+	authz.WriteError(w, err)
+}
+
+func writeAttachmentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, authz.ErrNotFound):
+		utils.WriteError(w, http.StatusNotFound, errors.New("attachment not found"))
+	case errors.Is(err, authz.ErrForbidden):
+		utils.WriteError(w, http.StatusForbidden, err)
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	if runes := []rune(name); len(runes) > 200 {
+		name = string(runes[:200])
+	}
+	return name
+}
+
+func newStorageKey(noteID int) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("notes/%d/%s", noteID, hex.EncodeToString(buf)), nil
+}
+
+func parseID(r *http.Request) (int, error) {
+	raw, ok := mux.Vars(r)["id"]
+	if !ok || raw == "" {
+		return 0, fmt.Errorf("missing id")
+	}
+
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid id")
+	}
+
+	return id, nil
+}
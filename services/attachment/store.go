@@ -0,0 +1,296 @@
+package attachment
+
+import (
+	"database/sql"
+	"layer-api/types"
+	"time"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateAttachment(a types.Attachment) (int, error) {
+	var id int
+
+	err := s.db.QueryRow(
+		`INSERT INTO attachments (note_id, uploader_id, filename, content_type, size, checksum, storage_key, thumbnail_status)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE(NULLIF($8, ''), 'none'))
+         RETURNING id`,
+		a.NoteID,
+		a.UploaderID,
+		a.Filename,
+		a.ContentType,
+		a.Size,
+		a.Checksum,
+		a.StorageKey,
+		a.ThumbnailStatus,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetAttachmentByID(id int) (*types.Attachment, error) {
+	row := s.db.QueryRow(
+		`SELECT id, note_id, uploader_id, filename, content_type, size, checksum, storage_key, thumbnail_status, created_at
+         FROM attachments
+         WHERE id = $1
+         LIMIT 1`,
+		id,
+	)
+
+	var a types.Attachment
+	err := row.Scan(
+		&a.ID,
+		&a.NoteID,
+		&a.UploaderID,
+		&a.Filename,
+		&a.ContentType,
+		&a.Size,
+		&a.Checksum,
+		&a.StorageKey,
+		&a.ThumbnailStatus,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *Store) ListAttachmentsByNote(noteID int) ([]types.Attachment, error) {
+	rows, err := s.db.Query(
+		`SELECT id, note_id, uploader_id, filename, content_type, size, checksum, storage_key, thumbnail_status, created_at
+         FROM attachments
+         WHERE note_id = $1
+         ORDER BY created_at ASC`,
+		noteID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []types.Attachment
+
+	for rows.Next() {
+		var a types.Attachment
+		if err := rows.Scan(
+			&a.ID,
+			&a.NoteID,
+			&a.UploaderID,
+			&a.Filename,
+			&a.ContentType,
+			&a.Size,
+			&a.Checksum,
+			&a.StorageKey,
+			&a.ThumbnailStatus,
+			&a.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *Store) DeleteAttachment(id int) error {
+	res, err := s.db.Exec(`DELETE FROM attachments WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ClaimPendingThumbnail takes the oldest pending thumbnail, or one whose
+// claim is older than staleAfter because the instance working on it stopped.
+func (s *Store) ClaimPendingThumbnail(staleAfter time.Duration) (*types.Attachment, error) {
+	row := s.db.QueryRow(
+		`UPDATE attachments SET thumbnail_status = 'processing', thumbnail_claimed_at = NOW()
+         WHERE id = (
+             SELECT id FROM attachments
+             WHERE thumbnail_status = 'pending'
+                OR (thumbnail_status = 'processing'
+                    AND thumbnail_claimed_at < NOW() - make_interval(secs => $1))
+             ORDER BY id ASC
+             LIMIT 1
+             FOR UPDATE SKIP LOCKED
+         )
+         RETURNING id, note_id, uploader_id, filename, content_type, size, checksum, storage_key, thumbnail_status, created_at`,
+		staleAfter.Seconds(),
+	)
+
+	var a types.Attachment
+	err := row.Scan(
+		&a.ID,
+		&a.NoteID,
+		&a.UploaderID,
+		&a.Filename,
+		&a.ContentType,
+		&a.Size,
+		&a.Checksum,
+		&a.StorageKey,
+		&a.ThumbnailStatus,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *Store) SetThumbnailStatus(id int, status string) error {
+	_, err := s.db.Exec(`UPDATE attachments SET thumbnail_status = $1 WHERE id = $2`, status, id)
+	return err
+}
+
+func (s *Store) CreateAttachmentVariant(v types.AttachmentVariant) error {
+	_, err := s.db.Exec(
+		`INSERT INTO attachment_variants (attachment_id, variant, content_type, width, height, size, storage_key)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)
+         ON CONFLICT (attachment_id, variant) DO NOTHING`,
+		v.AttachmentID,
+		v.Variant,
+		v.ContentType,
+		v.Width,
+		v.Height,
+		v.Size,
+		v.StorageKey,
+	)
+	return err
+}
+
+func (s *Store) ListAttachmentVariants(attachmentID int) ([]types.AttachmentVariant, error) {
+	rows, err := s.db.Query(
+		`SELECT id, attachment_id, variant, content_type, width, height, size, storage_key, created_at
+         FROM attachment_variants
+         WHERE attachment_id = $1
+         ORDER BY width ASC`,
+		attachmentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []types.AttachmentVariant
+
+	for rows.Next() {
+		var v types.AttachmentVariant
+		if err := rows.Scan(
+			&v.ID,
+			&v.AttachmentID,
+			&v.Variant,
+			&v.ContentType,
+			&v.Width,
+			&v.Height,
+			&v.Size,
+			&v.StorageKey,
+			&v.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *Store) GetAttachmentVariant(attachmentID int, variant string) (*types.AttachmentVariant, error) {
+	row := s.db.QueryRow(
+		`SELECT id, attachment_id, variant, content_type, width, height, size, storage_key, created_at
+         FROM attachment_variants
+         WHERE attachment_id = $1
+           AND variant = $2
+         LIMIT 1`,
+		attachmentID,
+		variant,
+	)
+
+	var v types.AttachmentVariant
+	err := row.Scan(
+		&v.ID,
+		&v.AttachmentID,
+		&v.Variant,
+		&v.ContentType,
+		&v.Width,
+		&v.Height,
+		&v.Size,
+		&v.StorageKey,
+		&v.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+func (s *Store) ListPendingBlobDeletions(limit int) ([]types.BlobDeletion, error) {
+	rows, err := s.db.Query(
+		`SELECT id, storage_key, attempts
+         FROM blob_deletions
+         WHERE attempts < 10
+         ORDER BY id ASC
+         LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []types.BlobDeletion
+
+	for rows.Next() {
+		var d types.BlobDeletion
+		if err := rows.Scan(&d.ID, &d.StorageKey, &d.Attempts); err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *Store) CompleteBlobDeletion(id int) error {
+	_, err := s.db.Exec(`DELETE FROM blob_deletions WHERE id = $1`, id)
+	return err
+}
+
+func (s *Store) FailBlobDeletion(id int) error {
+	_, err := s.db.Exec(`UPDATE blob_deletions SET attempts = attempts + 1 WHERE id = $1`, id)
+	return err
+}
@@ -0,0 +1,126 @@
+package attachment
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"layer-api/types"
+	"log"
+	"time"
+)
+
+// thumbnailClaimTimeout is how long a claimed thumbnail may stay processing
+// before another worker assumes its instance stopped and takes it over.
+const thumbnailClaimTimeout = 10 * time.Minute
+
+// ThumbnailWorker generates resized previews for image attachments. Work is
+// claimed from the attachments table, so pending thumbnails survive restarts
+// and several API instances can share the queue.
+type ThumbnailWorker struct {
+	store types.AttachmentStore
+	blobs types.BlobStore
+	wake  chan struct{}
+}
+
+func NewThumbnailWorker(store types.AttachmentStore, blobs types.BlobStore) *ThumbnailWorker {
+	return &ThumbnailWorker{
+		store: store,
+		blobs: blobs,
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+func (w *ThumbnailWorker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *ThumbnailWorker) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for w.processNext() {
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+func (w *ThumbnailWorker) processNext() bool {
+	a, err := w.store.ClaimPendingThumbnail(thumbnailClaimTimeout)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("thumbnail worker error:", err)
+		}
+		return false
+	}
+
+	status := types.ThumbnailStatusReady
+	if err := w.generate(a); err != nil {
+		log.Printf("thumbnail worker: attachment %d: %v", a.ID, err)
+		status = types.ThumbnailStatusFailed
+	}
+
+	if err := w.store.SetThumbnailStatus(a.ID, status); err != nil {
+		log.Println("thumbnail worker error:", err)
+	}
+
+	return true
+}
+
+func (w *ThumbnailWorker) generate(a *types.Attachment) error {
+	obj, err := w.blobs.Open(a.StorageKey)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		return err
+	}
+
+	img, format, err := decodeImage(data)
+	if err != nil {
+		return err
+	}
+	src := toRGBA(img)
+
+	for _, size := range thumbnailSizes {
+		thumb := resize(src, size.Max)
+
+		var buf bytes.Buffer
+		contentType, err := encodeThumbnail(&buf, thumb, format)
+		if err != nil {
+			return err
+		}
+
+		key := fmt.Sprintf("%s_%s", a.StorageKey, size.Name)
+		size64 := int64(buf.Len())
+		if err := w.blobs.Put(key, &buf, size64, contentType); err != nil {
+			return err
+		}
+
+		if err := w.store.CreateAttachmentVariant(types.AttachmentVariant{
+			AttachmentID: a.ID,
+			Variant:      size.Name,
+			ContentType:  contentType,
+			Width:        thumb.Bounds().Dx(),
+			Height:       thumb.Bounds().Dy(),
+			Size:         size64,
+			StorageKey:   key,
+		}); err != nil {
+			_ = w.blobs.Delete(key)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,268 @@
+package collab
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"layer-api/authz"
+	"layer-api/types"
+	"layer-api/utils"
+	"net/http"
+)
+
+// HandleLeaveNote removes the caller's own collaborator record. Access that
+// comes from a workspace has to be given up by leaving the workspace.
+func (h *Handler) HandleLeaveNote(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, access, ok := h.authorize(w, r, noteID, userID, authz.ActionView)
+	if !ok {
+		return
+	}
+	if access.Owner {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("owner cannot leave their own note; transfer ownership first"))
+		return
+	}
+
+	if _, err := h.collabStore.GetCollaborator(noteID, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("access comes from a workspace; leave the workspace instead"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.collabStore.RemoveCollaborator(noteID, userID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	authz.Invalidate(r.Context(), noteID, userID)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "left note"})
+}
+
+func (h *Handler) HandleRequestAccess(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.RequestAccessPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	role := payload.Role
+	if role == "" {
+		role = types.RoleViewer
+	}
+
+	// Users who can already see the note may only ask for a higher role.
+	_, access, err := h.authz.Access(r.Context(), noteID, userID)
+	if err != nil && !errors.Is(err, authz.ErrNotFound) {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err == nil && access.Rank() >= role.Rank() {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("you already have this level of access"))
+		return
+	}
+
+	id, err := h.accessRequestStore.CreateAccessRequest(types.AccessRequest{
+		NoteID:      noteID,
+		RequesterID: userID,
+		Role:        role,
+		Message:     payload.Message,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("note not found"))
+		case errors.Is(err, errAccessRequestExists):
+			utils.WriteError(w, http.StatusConflict, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	req, err := h.accessRequestStore.GetAccessRequestByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, req)
+}
+
+func (h *Handler) HandleListAccessRequests(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, _, ok := h.requireManager(w, r, noteID, actorID); !ok {
+		return
+	}
+
+	requests, err := h.accessRequestStore.ListNoteAccessRequests(noteID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, requests)
+}
+
+func (h *Handler) HandleApproveAccessRequest(w http.ResponseWriter, r *http.Request) {
+	h.resolveAccessRequest(w, r, true)
+}
+
+func (h *Handler) HandleDenyAccessRequest(w http.ResponseWriter, r *http.Request) {
+	h.resolveAccessRequest(w, r, false)
+}
+
+// resolveAccessRequest lets a manager approve or deny a pending request.
+// Approvers may grant a different role than the one asked for, but never
+// one at or above their own.
+func (h *Handler) resolveAccessRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	requestID, err := parseID(r, "requestId")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, actorRank, ok := h.requireManager(w, r, noteID, actorID)
+	if !ok {
+		return
+	}
+
+	var payload types.ReviewAccessRequestPayload
+	if r.ContentLength != 0 {
+		if err := utils.ParseJSON(r, &payload); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := utils.Validate.Struct(payload); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	req, err := h.accessRequestStore.GetAccessRequestByID(requestID)
+	if err == nil && (req.NoteID != noteID || req.Status != types.AccessRequestPending) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("access request not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	role := req.Role
+	if payload.Role != "" {
+		role = payload.Role
+	}
+	if approve && role.Rank() >= actorRank {
+		utils.WriteError(w, http.StatusForbidden, errRoleTooHigh)
+		return
+	}
+
+	resolved, err := h.accessRequestStore.ResolveAccessRequest(noteID, requestID, actorID, approve, role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("access request not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, resolved)
+}
+
+func (h *Handler) HandleListMyAccessRequests(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	requests, err := h.accessRequestStore.ListUserAccessRequests(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, requests)
+}
+
+func (h *Handler) HandleCancelAccessRequest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	requestID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.accessRequestStore.CancelAccessRequest(requestID, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("access request not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "access request cancelled"})
+}
@@ -0,0 +1,237 @@
+package collab
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"layer-api/types"
+	"layer-api/utils"
+	"net/http"
+	"strings"
+)
+
+func (h *Handler) HandleInviteCollaborator(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	note, actorRank, ok := h.requireManager(w, r, noteID, actorID)
+	if !ok {
+		return
+	}
+
+	var payload types.InviteCollaboratorPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if (payload.Username == "") == (payload.Email == "") {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("provide exactly one of username or email"))
+		return
+	}
+
+	role := defaultRole(payload.Role)
+	if role.Rank() >= actorRank {
+		utils.WriteError(w, http.StatusForbidden, errRoleTooHigh)
+		return
+	}
+
+	inv := types.CollaboratorInvitation{
+		NoteID:    noteID,
+		InviterID: actorID,
+		Role:      role,
+	}
+
+	var invitee *types.User
+	if payload.Username != "" {
+		invitee, err = h.userStore.GetUserByUsername(payload.Username)
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user not found"))
+			return
+		}
+	} else {
+		email := strings.TrimSpace(payload.Email)
+		inv.InviteeEmail = strings.ToLower(email)
+		invitee, err = h.userStore.GetUserByEmail(email)
+		if errors.Is(err, sql.ErrNoRows) && email != inv.InviteeEmail {
+			invitee, err = h.userStore.GetUserByEmail(inv.InviteeEmail)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			invitee, err = nil, nil
+		}
+		// Until the account proves it owns the address, the invitation is
+		// held for the address and claimed on verification.
+		if err == nil && invitee != nil && invitee.EmailVerifiedAt == nil {
+			invitee = nil
+		}
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if invitee != nil {
+		if invitee.ID == note.OwnerID {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("owner cannot be a collaborator"))
+			return
+		}
+
+		exists, err := h.collabStore.IsCollaborator(noteID, invitee.ID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if exists {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user is already a collaborator"))
+			return
+		}
+
+		inv.InviteeID = &invitee.ID
+	}
+
+	id, err := h.invitationStore.CreateInvitation(inv)
+	if err != nil {
+		if errors.Is(err, errInvitationExists) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.invitationStore.GetInvitationByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) HandleListNoteInvitations(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, _, ok := h.requireManager(w, r, noteID, actorID); !ok {
+		return
+	}
+
+	invitations, err := h.invitationStore.ListNoteInvitations(noteID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, invitations)
+}
+
+func (h *Handler) HandleCancelInvitation(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	invitationID, err := parseID(r, "invitationId")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, _, ok := h.requireManager(w, r, noteID, actorID); !ok {
+		return
+	}
+
+	if err := h.invitationStore.CancelInvitation(noteID, invitationID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("invitation not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "invitation cancelled"})
+}
+
+func (h *Handler) HandleListMyInvitations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	invitations, err := h.invitationStore.ListUserInvitations(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, invitations)
+}
+
+func (h *Handler) HandleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	h.respondToInvitation(w, r, true)
+}
+
+func (h *Handler) HandleDeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	h.respondToInvitation(w, r, false)
+}
+
+func (h *Handler) respondToInvitation(w http.ResponseWriter, r *http.Request, accept bool) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	invitationID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	inv, err := h.invitationStore.RespondToInvitation(invitationID, userID, accept)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("invitation not found"))
+			return
+		}
+		if errors.Is(err, errInvitationUnverified) {
+			utils.WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, inv)
+}
@@ -0,0 +1,182 @@
+package collab
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"layer-api/types"
+	"layer-api/utils"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) HandleCreateInviteLink(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, actorRank, ok := h.requireManager(w, r, noteID, actorID)
+	if !ok {
+		return
+	}
+
+	var payload types.CreateInviteLinkPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("expiresAt must be in the future"))
+		return
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	role := defaultRole(payload.Role)
+	if role.Rank() >= actorRank {
+		utils.WriteError(w, http.StatusForbidden, errRoleTooHigh)
+		return
+	}
+
+	id, err := h.inviteStore.CreateInviteLink(types.InviteLink{
+		NoteID:    noteID,
+		CreatedBy: actorID,
+		Token:     token,
+		Role:      role,
+		MaxUses:   payload.MaxUses,
+		ExpiresAt: payload.ExpiresAt,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	link, err := h.inviteStore.GetInviteLinkByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, link)
+}
+
+func (h *Handler) HandleListInviteLinks(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, _, ok := h.requireManager(w, r, noteID, actorID); !ok {
+		return
+	}
+
+	links, err := h.inviteStore.ListInviteLinks(noteID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, links)
+}
+
+func (h *Handler) HandleRevokeInviteLink(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	linkID, err := parseID(r, "linkId")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, _, ok := h.requireManager(w, r, noteID, actorID); !ok {
+		return
+	}
+
+	if err := h.inviteStore.RevokeInviteLink(noteID, linkID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errInviteNotFound)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "invite link revoked"})
+}
+
+func (h *Handler) HandleRedeemInviteLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	link, err := h.inviteStore.RedeemInviteLink(mux.Vars(r)["token"], userID)
+	switch {
+	case err == nil:
+		utils.WriteJSON(w, http.StatusOK, map[string]any{
+			"message": "collaborator added",
+			"noteId":  link.NoteID,
+			"role":    link.Role,
+		})
+	case errors.Is(err, errAlreadyCollaborator):
+		utils.WriteJSON(w, http.StatusOK, map[string]any{
+			"message": "already a collaborator",
+			"noteId":  link.NoteID,
+		})
+	case errors.Is(err, errInviteNotFound):
+		utils.WriteError(w, http.StatusNotFound, err)
+	case errors.Is(err, errInviteExpired), errors.Is(err, errInviteExhausted):
+		utils.WriteError(w, http.StatusGone, err)
+	case errors.Is(err, errInviteOwnNote):
+		utils.WriteError(w, http.StatusBadRequest, err)
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func newInviteToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
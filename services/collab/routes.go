@@ -4,43 +4,171 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"layer-api/authz"
 	"layer-api/types"
 	"layer-api/utils"
+	"layer-api/verification"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type Handler struct {
-	collabStore types.CollaboratorStore
-	noteStore   types.NoteStore
+	collabStore        types.CollaboratorStore
+	inviteStore        types.InviteLinkStore
+	invitationStore    types.InvitationStore
+	transferStore      types.TransferStore
+	accessRequestStore types.AccessRequestStore
+	userStore          types.UserStore
+	authz              *authz.Authorizer
+	verified           *verification.Policy
 }
 
-func NewHandler(collabStore types.CollaboratorStore, noteStore types.NoteStore) *Handler {
+func NewHandler(
+	collabStore types.CollaboratorStore,
+	inviteStore types.InviteLinkStore,
+	invitationStore types.InvitationStore,
+	transferStore types.TransferStore,
+	accessRequestStore types.AccessRequestStore,
+	userStore types.UserStore,
+	authorizer *authz.Authorizer,
+	verified *verification.Policy,
+) *Handler {
 	return &Handler{
-		collabStore: collabStore,
-		noteStore:   noteStore,
+		collabStore:        collabStore,
+		inviteStore:        inviteStore,
+		invitationStore:    invitationStore,
+		transferStore:      transferStore,
+		accessRequestStore: accessRequestStore,
+		userStore:          userStore,
+		authz:              authorizer,
+		verified:           verified,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.Handle("/notes/{id}/collaborators",
-		utils.AuthMiddleware(http.HandlerFunc(h.HandleAddCollaborator)),
+		utils.AuthMiddleware(h.verified.Require(verification.RestrictInvite, http.HandlerFunc(h.HandleAddCollaborator))),
 	).Methods("POST")
 
 	router.Handle("/notes/{id}/collaborators",
 		utils.AuthMiddleware(http.HandlerFunc(h.HandleListCollaborators)),
 	).Methods("GET")
 
+	router.Handle("/notes/{id}/collaborators/{userId}",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleUpdateCollaborator)),
+	).Methods("PATCH")
+
 	router.Handle("/notes/{id}/collaborators/{userId}",
 		utils.AuthMiddleware(http.HandlerFunc(h.HandleRemoveCollaborator)),
 	).Methods("DELETE")
+
+	router.Handle("/notes/{id}/collaborators/{userId}/extend",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleExtendCollaborator)),
+	).Methods("POST")
+
+	router.Handle("/notes/{id}/invite-links",
+		utils.AuthMiddleware(h.verified.Require(verification.RestrictInvite, http.HandlerFunc(h.HandleCreateInviteLink))),
+	).Methods("POST")
+
+	router.Handle("/notes/{id}/invite-links",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleListInviteLinks)),
+	).Methods("GET")
+
+	router.Handle("/notes/{id}/invite-links/{linkId}",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleRevokeInviteLink)),
+	).Methods("DELETE")
+
+	router.Handle("/notes/{id}/invitations",
+		utils.AuthMiddleware(h.verified.Require(verification.RestrictInvite, http.HandlerFunc(h.HandleInviteCollaborator))),
+	).Methods("POST")
+
+	router.Handle("/notes/{id}/invitations",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleListNoteInvitations)),
+	).Methods("GET")
+
+	router.Handle("/notes/{id}/invitations/{invitationId}",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleCancelInvitation)),
+	).Methods("DELETE")
+
+	router.Handle("/invitations",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleListMyInvitations)),
+	).Methods("GET")
+
+	router.Handle("/invitations/{id}/accept",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleAcceptInvitation)),
+	).Methods("POST")
+
+	router.Handle("/invitations/{id}/decline",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleDeclineInvitation)),
+	).Methods("POST")
+
+	router.Handle("/notes/{id}/transfer",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleProposeTransfer)),
+	).Methods("POST")
+
+	router.Handle("/notes/{id}/transfer",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleGetTransfer)),
+	).Methods("GET")
+
+	router.Handle("/notes/{id}/transfer",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleCancelTransfer)),
+	).Methods("DELETE")
+
+	router.Handle("/notes/{id}/audit",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleListAudit)),
+	).Methods("GET")
+
+	router.Handle("/transfers",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleListIncomingTransfers)),
+	).Methods("GET")
+
+	router.Handle("/transfers/{id}/accept",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleAcceptTransfer)),
+	).Methods("POST")
+
+	router.Handle("/transfers/{id}/decline",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleDeclineTransfer)),
+	).Methods("POST")
+
+	router.Handle("/notes/{id}/leave",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleLeaveNote)),
+	).Methods("POST")
+
+	router.Handle("/notes/{id}/access-requests",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleRequestAccess)),
+	).Methods("POST")
+
+	router.Handle("/notes/{id}/access-requests",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleListAccessRequests)),
+	).Methods("GET")
+
+	router.Handle("/notes/{id}/access-requests/{requestId}/approve",
+		utils.AuthMiddleware(h.verified.Require(verification.RestrictInvite, http.HandlerFunc(h.HandleApproveAccessRequest))),
+	).Methods("POST")
+
+	router.Handle("/notes/{id}/access-requests/{requestId}/deny",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleDenyAccessRequest)),
+	).Methods("POST")
+
+	router.Handle("/access-requests",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleListMyAccessRequests)),
+	).Methods("GET")
+
+	router.Handle("/access-requests/{id}",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleCancelAccessRequest)),
+	).Methods("DELETE")
+
+	router.Handle("/invite-links/{token}/redeem",
+		utils.AuthMiddleware(http.HandlerFunc(h.HandleRedeemInviteLink)),
+	).Methods("POST")
 }
 
 func (h *Handler) HandleAddCollaborator(w http.ResponseWriter, r *http.Request) {
-	ownerID, ok := utils.GetUserIDFromContext(r.Context())
-	if !ok || ownerID <= 0 {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
 		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
 		return
 	}
@@ -51,18 +179,8 @@ func (h *Handler) HandleAddCollaborator(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	note, err := h.noteStore.GetNoteByID(noteID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("note not found"))
-			return
-		}
-		utils.WriteError(w, http.StatusInternalServerError, err)
-		return
-	}
-
-	if note.OwnerID != ownerID {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only owner can manage collaborators"))
+	note, actorRank, ok := h.requireManager(w, r, noteID, actorID)
+	if !ok {
 		return
 	}
 
@@ -76,11 +194,17 @@ func (h *Handler) HandleAddCollaborator(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if payload.UserID == ownerID {
+	if payload.UserID == note.OwnerID {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("owner cannot be a collaborator"))
 		return
 	}
 
+	role := defaultRole(payload.Role)
+	if role.Rank() >= actorRank {
+		utils.WriteError(w, http.StatusForbidden, errRoleTooHigh)
+		return
+	}
+
 	exists, err := h.collabStore.IsCollaborator(noteID, payload.UserID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
@@ -91,22 +215,26 @@ func (h *Handler) HandleAddCollaborator(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	canEdit := true
-	if payload.CanEdit != nil {
-		canEdit = *payload.CanEdit
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("expiresAt must be in the future"))
+		return
 	}
 
-	if err := h.collabStore.AddCollaborator(noteID, payload.UserID, canEdit); err != nil {
+	if err := h.collabStore.AddCollaborator(noteID, payload.UserID, actorID, role, payload.ExpiresAt); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "collaborator added"})
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"message":   "collaborator added",
+		"role":      role,
+		"expiresAt": payload.ExpiresAt,
+	})
 }
 
 func (h *Handler) HandleListCollaborators(w http.ResponseWriter, r *http.Request) {
-	ownerID, ok := utils.GetUserIDFromContext(r.Context())
-	if !ok || ownerID <= 0 {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
 		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
 		return
 	}
@@ -117,33 +245,104 @@ func (h *Handler) HandleListCollaborators(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	note, err := h.noteStore.GetNoteByID(noteID)
+	_, access, ok := h.authorize(w, r, noteID, actorID, authz.ActionView)
+	if !ok {
+		return
+	}
+
+	limit := utils.AtoiSafe(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset := utils.AtoiSafe(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, total, err := h.collabStore.ListCollaboratorEntries(noteID, limit, offset)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("note not found"))
-			return
-		}
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	if note.OwnerID != ownerID {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only owner can view collaborators"))
+	// Email addresses are only shown to those who manage sharing, and to
+	// each collaborator for their own entry.
+	if !access.Can(authz.ActionManageCollaborators) {
+		for i := range entries {
+			if entries[i].UserID != actorID {
+				entries[i].Email = ""
+			}
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CollaboratorPage{
+		Collaborators: entries,
+		Total:         total,
+		Limit:         limit,
+		Offset:        offset,
+	})
+}
+
+func (h *Handler) HandleUpdateCollaborator(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
 		return
 	}
 
-	collabs, err := h.collabStore.ListCollaborators(noteID)
+	noteID, err := parseID(r, "id")
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	targetUserID, err := parseID(r, "userId")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, actorRank, ok := h.requireManager(w, r, noteID, actorID)
+	if !ok {
+		return
+	}
+
+	var payload types.UpdateCollaboratorPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	target, ok := h.requireTarget(w, noteID, targetUserID, actorRank)
+	if !ok {
+		return
+	}
+
+	if payload.Role.Rank() >= actorRank {
+		utils.WriteError(w, http.StatusForbidden, errRoleTooHigh)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, collabs)
+	if target.Role != payload.Role {
+		if err := h.collabStore.UpdateCollaboratorRole(noteID, targetUserID, payload.Role); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		target.Role = payload.Role
+	}
+
+	utils.WriteJSON(w, http.StatusOK, target)
 }
 
-func (h *Handler) HandleRemoveCollaborator(w http.ResponseWriter, r *http.Request) {
-	ownerID, ok := utils.GetUserIDFromContext(r.Context())
-	if !ok || ownerID <= 0 {
+// HandleExtendCollaborator pushes back the expiry of a time-limited grant.
+// Grants can only be extended while they are still live.
+func (h *Handler) HandleExtendCollaborator(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
 		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
 		return
 	}
@@ -154,39 +353,80 @@ func (h *Handler) HandleRemoveCollaborator(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	note, err := h.noteStore.GetNoteByID(noteID)
+	targetUserID, err := parseID(r, "userId")
 	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, actorRank, ok := h.requireManager(w, r, noteID, actorID)
+	if !ok {
+		return
+	}
+
+	var payload types.ExtendCollaboratorPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	target, ok := h.requireTarget(w, noteID, targetUserID, actorRank)
+	if !ok {
+		return
+	}
+
+	if target.ExpiresAt == nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("grant does not expire"))
+		return
+	}
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(*target.ExpiresAt) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("expiresAt must be later than the current expiry"))
+		return
+	}
+
+	if err := h.collabStore.ExtendCollaborator(noteID, targetUserID, payload.ExpiresAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("note not found"))
+			utils.WriteError(w, http.StatusGone, fmt.Errorf("grant has already expired"))
 			return
 		}
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+	target.ExpiresAt = payload.ExpiresAt
 
-	if note.OwnerID != ownerID {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only owner can remove collaborators"))
+	utils.WriteJSON(w, http.StatusOK, target)
+}
+
+func (h *Handler) HandleRemoveCollaborator(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
 		return
 	}
 
-	targetUserID, err := parseID(r, "userId")
+	noteID, err := parseID(r, "id")
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	if targetUserID == ownerID {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("owner cannot remove themselves"))
+	note, actorRank, ok := h.requireManager(w, r, noteID, actorID)
+	if !ok {
 		return
 	}
 
-	exists, err := h.collabStore.IsCollaborator(noteID, targetUserID)
+	targetUserID, err := parseID(r, "userId")
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
-	if !exists {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user is not a collaborator"))
+
+	if targetUserID == note.OwnerID {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("owner cannot remove themselves"))
+		return
+	}
+
+	if _, ok := h.requireTarget(w, noteID, targetUserID, actorRank); !ok {
 		return
 	}
 
@@ -198,6 +438,55 @@ func (h *Handler) HandleRemoveCollaborator(w http.ResponseWriter, r *http.Reques
 	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "collaborator removed"})
 }
 
+var errRoleTooHigh = errors.New("cannot manage roles at or above your own level")
+
+// requireManager authorizes the caller to administer collaborators and
+// returns their rank on the note. On failure it writes the response and ok
+// is false.
+func (h *Handler) requireManager(w http.ResponseWriter, r *http.Request, noteID, userID int) (*types.Note, int, bool) {
+	note, access, ok := h.authorize(w, r, noteID, userID, authz.ActionManageCollaborators)
+	if !ok {
+		return nil, 0, false
+	}
+	return note, access.Rank(), true
+}
+
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, noteID, userID int, action authz.Action) (*types.Note, authz.Access, bool) {
+	note, access, err := h.authz.Authorize(r.Context(), noteID, userID, action)
+	if err != nil {
+		authz.WriteError(w, err)
+		return nil, access, false
+	}
+	return note, access, true
+}
+
+// requireTarget loads an existing collaborator that the caller outranks.
+func (h *Handler) requireTarget(w http.ResponseWriter, noteID, userID, actorRank int) (*types.NoteCollaborator, bool) {
+	target, err := h.collabStore.GetCollaborator(noteID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user is not a collaborator"))
+			return nil, false
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if target.Role.Rank() >= actorRank {
+		utils.WriteError(w, http.StatusForbidden, errRoleTooHigh)
+		return nil, false
+	}
+
+	return target, true
+}
+
+func defaultRole(role types.CollaboratorRole) types.CollaboratorRole {
+	if role == "" {
+		return types.RoleEditor
+	}
+	return role
+}
+
 func parseID(r *http.Request, key string) (int, error) {
 	vars := mux.Vars(r)
 	raw, ok := vars[key]
@@ -2,7 +2,24 @@ package collab
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"layer-api/types"
+	"time"
+)
+
+var (
+	errInviteNotFound       = errors.New("invite link not found")
+	errInviteExpired        = errors.New("invite link has expired")
+	errInviteExhausted      = errors.New("invite link has no uses left")
+	errInviteOwnNote        = errors.New("owner cannot redeem an invite to their own note")
+	errAlreadyCollaborator  = errors.New("user is already a collaborator")
+	errInvitationExists     = errors.New("user already has a pending invitation")
+	errInvitationUnverified = errors.New("verify your email address to accept this invitation")
+	errTransferExists       = errors.New("note already has a pending ownership transfer")
+	errTransferRecipient    = errors.New("ownership can only be transferred to a collaborator")
+	errTransferStale        = errors.New("note ownership changed since the transfer was proposed")
+	errAccessRequestExists  = errors.New("an access request for this note is already pending")
 )
 
 type Store struct {
@@ -13,19 +30,75 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) AddCollaborator(noteID, userID int, canEdit bool) error {
+// AddCollaborator grants role on a note, until expiresAt when it is set.
+func (s *Store) AddCollaborator(noteID, userID, addedBy int, role types.CollaboratorRole, expiresAt *time.Time) error {
 	_, err := s.db.Exec(
-		`INSERT INTO note_collaborators (note_id, user_id, can_edit)
-         VALUES ($1, $2, $3)
+		`INSERT INTO note_collaborators (note_id, user_id, role, expires_at, added_by)
+         VALUES ($1, $2, $3, $4, $5)
          ON CONFLICT (note_id, user_id)
-         DO UPDATE SET can_edit = EXCLUDED.can_edit`,
+         DO UPDATE SET role = EXCLUDED.role, expires_at = EXCLUDED.expires_at, added_by = EXCLUDED.added_by, source_folder_id = NULL`,
 		noteID,
 		userID,
-		canEdit,
+		role,
+		expiresAt,
+		addedBy,
 	)
 	return err
 }
 
+// ExtendCollaborator moves the expiry of a grant that has not lapsed yet.
+// Lapsed or missing grants yield sql.ErrNoRows.
+func (s *Store) ExtendCollaborator(noteID, userID int, expiresAt *time.Time) error {
+	res, err := s.db.Exec(
+		`UPDATE note_collaborators
+         SET expires_at = $3
+         WHERE note_id = $1
+           AND user_id = $2
+           AND (expires_at IS NULL OR expires_at > NOW())`,
+		noteID,
+		userID,
+		expiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *Store) UpdateCollaboratorRole(noteID, userID int, role types.CollaboratorRole) error {
+	res, err := s.db.Exec(
+		`UPDATE note_collaborators
+         SET role = $3
+         WHERE note_id = $1
+           AND user_id = $2`,
+		noteID,
+		userID,
+		role,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 func (s *Store) RemoveCollaborator(noteID, userID int) error {
 	_, err := s.db.Exec(
 		`DELETE FROM note_collaborators
@@ -39,9 +112,10 @@ func (s *Store) RemoveCollaborator(noteID, userID int) error {
 
 func (s *Store) ListCollaborators(noteID int) ([]types.NoteCollaborator, error) {
 	rows, err := s.db.Query(
-		`SELECT id, note_id, user_id, can_edit, created_at
+		`SELECT id, note_id, user_id, role, expires_at, created_at
          FROM note_collaborators
          WHERE note_id = $1
+           AND (expires_at IS NULL OR expires_at > NOW())
          ORDER BY created_at ASC`,
 		noteID,
 	)
@@ -58,7 +132,8 @@ func (s *Store) ListCollaborators(noteID int) ([]types.NoteCollaborator, error)
 			&c.ID,
 			&c.NoteID,
 			&c.UserID,
-			&c.CanEdit,
+			&c.Role,
+			&c.ExpiresAt,
 			&c.CreatedAt,
 		); err != nil {
 			return nil, err
@@ -73,6 +148,73 @@ func (s *Store) ListCollaborators(noteID int) ([]types.NoteCollaborator, error)
 	return result, nil
 }
 
+// ListCollaboratorEntries returns one page of a note's live collaborators
+// with their profiles, plus the total number of collaborators.
+func (s *Store) ListCollaboratorEntries(noteID, limit, offset int) ([]types.CollaboratorEntry, int, error) {
+	rows, err := s.db.Query(
+		`SELECT c.user_id, u.username, u.email, c.role, c.added_by, COALESCE(a.username, ''),
+                c.created_at, c.expires_at, c.last_active_at, COUNT(*) OVER ()
+         FROM note_collaborators c
+         JOIN users u ON u.id = c.user_id
+         LEFT JOIN users a ON a.id = c.added_by
+         WHERE c.note_id = $1
+           AND (c.expires_at IS NULL OR c.expires_at > NOW())
+         ORDER BY c.created_at ASC, c.id ASC
+         LIMIT $2 OFFSET $3`,
+		noteID,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []types.CollaboratorEntry{}
+	total := 0
+	for rows.Next() {
+		var e types.CollaboratorEntry
+		var addedBy sql.NullInt64
+		if err := rows.Scan(
+			&e.UserID,
+			&e.Username,
+			&e.Email,
+			&e.Role,
+			&addedBy,
+			&e.AddedByUsername,
+			&e.AddedAt,
+			&e.ExpiresAt,
+			&e.LastActiveAt,
+			&total,
+		); err != nil {
+			return nil, 0, err
+		}
+		if addedBy.Valid {
+			id := int(addedBy.Int64)
+			e.AddedBy = &id
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// Past the last page the window count is unavailable.
+	if len(entries) == 0 && offset > 0 {
+		err := s.db.QueryRow(
+			`SELECT COUNT(*) FROM note_collaborators
+             WHERE note_id = $1
+               AND (expires_at IS NULL OR expires_at > NOW())`,
+			noteID,
+		).Scan(&total)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return entries, total, nil
+}
+
 func (s *Store) IsCollaborator(noteID, userID int) (bool, error) {
 	var exists bool
 	err := s.db.QueryRow(
@@ -81,6 +223,7 @@ func (s *Store) IsCollaborator(noteID, userID int) (bool, error) {
              FROM note_collaborators
              WHERE note_id = $1
                AND user_id = $2
+               AND (expires_at IS NULL OR expires_at > NOW())
          )`,
 		noteID,
 		userID,
@@ -90,3 +233,1111 @@ func (s *Store) IsCollaborator(noteID, userID int) (bool, error) {
 	}
 	return exists, nil
 }
+
+func (s *Store) GetCollaborator(noteID, userID int) (*types.NoteCollaborator, error) {
+	row := s.db.QueryRow(
+		`SELECT id, note_id, user_id, role, expires_at, created_at
+         FROM note_collaborators
+         WHERE note_id = $1
+           AND user_id = $2
+           AND (expires_at IS NULL OR expires_at > NOW())
+         LIMIT 1`,
+		noteID,
+		userID,
+	)
+
+	var c types.NoteCollaborator
+	err := row.Scan(
+		&c.ID,
+		&c.NoteID,
+		&c.UserID,
+		&c.Role,
+		&c.ExpiresAt,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// GetEffectiveRole returns the role userID holds on a note they do not own.
+// A live direct collaborator row takes precedence over access inherited from
+// the note's workspace, and its expiry is returned alongside; with neither,
+// sql.ErrNoRows is returned.
+func (s *Store) GetEffectiveRole(noteID, userID int) (types.CollaboratorRole, *time.Time, error) {
+	var role sql.NullString
+	var expiresAt *time.Time
+	err := s.db.QueryRow(
+		`SELECT COALESCE(c.role, note_workspace_role($1, $2)), c.expires_at
+         FROM (SELECT 1) AS one
+         LEFT JOIN note_collaborators c
+           ON c.note_id = $1
+          AND c.user_id = $2
+          AND (c.expires_at IS NULL OR c.expires_at > NOW())`,
+		noteID,
+		userID,
+	).Scan(&role, &expiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	if !role.Valid {
+		return "", nil, sql.ErrNoRows
+	}
+
+	return types.CollaboratorRole(role.String), expiresAt, nil
+}
+
+// SweepExpiredGrants deletes every lapsed time-limited grant, records each in
+// the note's audit log and returns them so their owners can be notified.
+func (s *Store) SweepExpiredGrants() ([]types.ExpiredGrant, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`WITH expired AS (
+             DELETE FROM note_collaborators
+             WHERE expires_at <= NOW()
+             RETURNING note_id, user_id, role, expires_at
+         )
+         SELECT e.note_id, n.title, n.owner_id, e.user_id, u.username, e.role, e.expires_at
+         FROM expired e
+         JOIN notes n ON n.id = e.note_id
+         JOIN users u ON u.id = e.user_id
+         ORDER BY e.expires_at ASC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []types.ExpiredGrant{}
+	for rows.Next() {
+		var g types.ExpiredGrant
+		if err := rows.Scan(&g.NoteID, &g.NoteTitle, &g.OwnerID, &g.UserID, &g.Username, &g.Role, &g.ExpiredAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, g := range grants {
+		if err := recordAudit(tx, g.NoteID, g.OwnerID, "collaborator_expired", map[string]any{
+			"userId":    g.UserID,
+			"role":      g.Role,
+			"expiredAt": g.ExpiredAt,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+const inviteLinkColumns = `id, note_id, created_by, token, role, max_uses, use_count, expires_at, revoked_at, created_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInviteLink(row scanner) (*types.InviteLink, error) {
+	var l types.InviteLink
+	var maxUses sql.NullInt64
+	err := row.Scan(
+		&l.ID,
+		&l.NoteID,
+		&l.CreatedBy,
+		&l.Token,
+		&l.Role,
+		&maxUses,
+		&l.UseCount,
+		&l.ExpiresAt,
+		&l.RevokedAt,
+		&l.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if maxUses.Valid {
+		n := int(maxUses.Int64)
+		l.MaxUses = &n
+	}
+	l.Redemptions = []types.InviteRedemption{}
+
+	return &l, nil
+}
+
+func (s *Store) CreateInviteLink(link types.InviteLink) (int, error) {
+	var id int
+
+	err := s.db.QueryRow(
+		`INSERT INTO note_invite_links (note_id, created_by, token, role, max_uses, expires_at)
+         VALUES ($1, $2, $3, $4, $5, $6)
+         RETURNING id`,
+		link.NoteID,
+		link.CreatedBy,
+		link.Token,
+		link.Role,
+		link.MaxUses,
+		link.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetInviteLinkByID(id int) (*types.InviteLink, error) {
+	return scanInviteLink(s.db.QueryRow(
+		`SELECT `+inviteLinkColumns+` FROM note_invite_links WHERE id = $1`,
+		id,
+	))
+}
+
+func (s *Store) ListInviteLinks(noteID int) ([]types.InviteLink, error) {
+	rows, err := s.db.Query(
+		`SELECT `+inviteLinkColumns+` FROM note_invite_links
+         WHERE note_id = $1
+         ORDER BY created_at DESC, id DESC`,
+		noteID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []types.InviteLink{}
+	index := make(map[int]int)
+	for rows.Next() {
+		l, err := scanInviteLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[l.ID] = len(links)
+		links = append(links, *l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	redemptions, err := s.db.Query(
+		`SELECT r.link_id, r.user_id, u.username, r.redeemed_at
+         FROM note_invite_redemptions r
+         JOIN note_invite_links l ON l.id = r.link_id
+         JOIN users u ON u.id = r.user_id
+         WHERE l.note_id = $1
+         ORDER BY r.redeemed_at ASC`,
+		noteID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer redemptions.Close()
+
+	for redemptions.Next() {
+		var linkID int
+		var r types.InviteRedemption
+		if err := redemptions.Scan(&linkID, &r.UserID, &r.Username, &r.RedeemedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := index[linkID]; ok {
+			links[i].Redemptions = append(links[i].Redemptions, r)
+		}
+	}
+
+	return links, redemptions.Err()
+}
+
+func (s *Store) RevokeInviteLink(noteID, id int) error {
+	res, err := s.db.Exec(
+		`UPDATE note_invite_links
+         SET revoked_at = NOW()
+         WHERE id = $1
+           AND note_id = $2
+           AND revoked_at IS NULL`,
+		id,
+		noteID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RedeemInviteLink adds userID as a collaborator on the link's note. The link
+// row is locked for the duration so concurrent redemptions cannot exceed its
+// use limit. A user who already collaborates on the note does not consume a
+// use; the link is returned alongside errAlreadyCollaborator.
+func (s *Store) RedeemInviteLink(token string, userID int) (*types.InviteLink, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	link, err := scanInviteLink(tx.QueryRow(
+		`SELECT `+inviteLinkColumns+` FROM note_invite_links WHERE token = $1 FOR UPDATE`,
+		token,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errInviteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if link.RevokedAt != nil {
+		return nil, errInviteNotFound
+	}
+
+	var expired bool
+	var ownerID int
+	err = tx.QueryRow(
+		`SELECT n.owner_id, COALESCE($2::timestamptz <= NOW(), FALSE)
+         FROM notes n
+         WHERE n.id = $1`,
+		link.NoteID,
+		link.ExpiresAt,
+	).Scan(&ownerID, &expired)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errInviteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if expired {
+		return nil, errInviteExpired
+	}
+	if ownerID == userID {
+		return nil, errInviteOwnNote
+	}
+
+	var exists bool
+	err = tx.QueryRow(
+		`SELECT EXISTS (
+             SELECT 1 FROM note_collaborators
+             WHERE note_id = $1 AND user_id = $2
+               AND (expires_at IS NULL OR expires_at > NOW())
+         )`,
+		link.NoteID,
+		userID,
+	).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return link, errAlreadyCollaborator
+	}
+
+	if link.MaxUses != nil && link.UseCount >= *link.MaxUses {
+		return nil, errInviteExhausted
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO note_collaborators (note_id, user_id, role, added_by)
+         VALUES ($1, $2, $3, $4)
+         ON CONFLICT (note_id, user_id)
+         DO UPDATE SET role = EXCLUDED.role, expires_at = NULL, added_by = EXCLUDED.added_by, source_folder_id = NULL`,
+		link.NoteID,
+		userID,
+		link.Role,
+		link.CreatedBy,
+	); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO note_invite_redemptions (link_id, user_id)
+         VALUES ($1, $2)
+         ON CONFLICT (link_id, user_id)
+         DO UPDATE SET redeemed_at = NOW()`,
+		link.ID,
+		userID,
+	); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE note_invite_links SET use_count = use_count + 1 WHERE id = $1`,
+		link.ID,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	link.UseCount++
+	return link, nil
+}
+
+const invitationSelect = `SELECT i.id, i.note_id, n.title, i.inviter_id, inviter.username,
+	i.invitee_id, COALESCE(invitee.username, ''), COALESCE(i.invitee_email, ''),
+	i.role, i.status, i.created_at, i.responded_at
+	FROM collaborator_invitations i
+	JOIN notes n ON n.id = i.note_id
+	JOIN users inviter ON inviter.id = i.inviter_id
+	LEFT JOIN users invitee ON invitee.id = i.invitee_id`
+
+func scanInvitation(row scanner) (*types.CollaboratorInvitation, error) {
+	var inv types.CollaboratorInvitation
+	var inviteeID sql.NullInt64
+	err := row.Scan(
+		&inv.ID,
+		&inv.NoteID,
+		&inv.NoteTitle,
+		&inv.InviterID,
+		&inv.InviterUsername,
+		&inviteeID,
+		&inv.InviteeUsername,
+		&inv.InviteeEmail,
+		&inv.Role,
+		&inv.Status,
+		&inv.CreatedAt,
+		&inv.RespondedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if inviteeID.Valid {
+		id := int(inviteeID.Int64)
+		inv.InviteeID = &id
+	}
+
+	return &inv, nil
+}
+
+func (s *Store) queryInvitations(query string, args ...any) ([]types.CollaboratorInvitation, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []types.CollaboratorInvitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+// CreateInvitation records a pending invitation. Only one pending invitation
+// may exist per note and invitee; a duplicate yields errInvitationExists.
+func (s *Store) CreateInvitation(inv types.CollaboratorInvitation) (int, error) {
+	var email sql.NullString
+	if inv.InviteeEmail != "" {
+		email = sql.NullString{String: inv.InviteeEmail, Valid: true}
+	}
+
+	var id int
+	err := s.db.QueryRow(
+		`INSERT INTO collaborator_invitations (note_id, inviter_id, invitee_id, invitee_email, role)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT DO NOTHING
+         RETURNING id`,
+		inv.NoteID,
+		inv.InviterID,
+		inv.InviteeID,
+		email,
+		inv.Role,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errInvitationExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetInvitationByID(id int) (*types.CollaboratorInvitation, error) {
+	return scanInvitation(s.db.QueryRow(invitationSelect+` WHERE i.id = $1`, id))
+}
+
+func (s *Store) ListNoteInvitations(noteID int) ([]types.CollaboratorInvitation, error) {
+	return s.queryInvitations(
+		invitationSelect+` WHERE i.note_id = $1 AND i.status = 'pending'
+         ORDER BY i.created_at DESC, i.id DESC`,
+		noteID,
+	)
+}
+
+func (s *Store) ListUserInvitations(userID int) ([]types.CollaboratorInvitation, error) {
+	return s.queryInvitations(
+		invitationSelect+` WHERE i.invitee_id = $1 AND i.status = 'pending'
+         ORDER BY i.created_at DESC, i.id DESC`,
+		userID,
+	)
+}
+
+func (s *Store) CancelInvitation(noteID, id int) error {
+	res, err := s.db.Exec(
+		`UPDATE collaborator_invitations
+         SET status = 'cancelled', responded_at = NOW()
+         WHERE id = $1
+           AND note_id = $2
+           AND status = 'pending'`,
+		id,
+		noteID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RespondToInvitation accepts or declines a pending invitation addressed to
+// userID. Accepting adds the collaborator in the same transaction; an existing
+// collaborator keeps their current permission. Invitations sent to an email
+// address can only be accepted once the user has verified that address,
+// otherwise errInvitationUnverified is returned.
+func (s *Store) RespondToInvitation(id, userID int, accept bool) (*types.CollaboratorInvitation, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var noteID, inviterID int
+	var role types.CollaboratorRole
+	var verified bool
+	err = tx.QueryRow(
+		`SELECT i.note_id, i.inviter_id, i.role,
+                i.invitee_email IS NULL
+                    OR (u.email_verified_at IS NOT NULL AND LOWER(u.email) = LOWER(i.invitee_email))
+         FROM collaborator_invitations i
+         JOIN users u ON u.id = i.invitee_id
+         WHERE i.id = $1
+           AND i.invitee_id = $2
+           AND i.status = 'pending'
+         FOR UPDATE OF i`,
+		id,
+		userID,
+	).Scan(&noteID, &inviterID, &role, &verified)
+	if err != nil {
+		return nil, err
+	}
+
+	status := types.InvitationDeclined
+	if accept {
+		if !verified {
+			return nil, errInvitationUnverified
+		}
+		status = types.InvitationAccepted
+
+		if _, err := tx.Exec(
+			`INSERT INTO note_collaborators (note_id, user_id, role, added_by)
+             SELECT $1, $2, $3, $4
+             FROM notes
+             WHERE id = $1 AND owner_id <> $2
+             ON CONFLICT (note_id, user_id)
+             DO UPDATE SET role = EXCLUDED.role, expires_at = NULL, added_by = EXCLUDED.added_by, source_folder_id = NULL
+             WHERE note_collaborators.expires_at <= NOW()`,
+			noteID,
+			userID,
+			role,
+			inviterID,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE collaborator_invitations
+         SET status = $2, responded_at = NOW()
+         WHERE id = $1`,
+		id,
+		status,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetInvitationByID(id)
+}
+
+const transferSelect = `SELECT t.id, t.note_id, n.title, t.from_user_id, f.username,
+	t.to_user_id, u.username, t.keep_access, t.status, t.created_at, t.responded_at
+	FROM note_ownership_transfers t
+	JOIN notes n ON n.id = t.note_id
+	JOIN users f ON f.id = t.from_user_id
+	JOIN users u ON u.id = t.to_user_id`
+
+func scanTransfer(row scanner) (*types.OwnershipTransfer, error) {
+	var t types.OwnershipTransfer
+	err := row.Scan(
+		&t.ID,
+		&t.NoteID,
+		&t.NoteTitle,
+		&t.FromUserID,
+		&t.FromUsername,
+		&t.ToUserID,
+		&t.ToUsername,
+		&t.KeepAccess,
+		&t.Status,
+		&t.CreatedAt,
+		&t.RespondedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func recordAudit(db execer, noteID, actorID int, action string, details map[string]any) error {
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO note_audit_log (note_id, actor_id, action, details)
+         VALUES ($1, $2, $3, $4)`,
+		noteID,
+		actorID,
+		action,
+		encoded,
+	)
+	return err
+}
+
+// CreateTransfer records a pending transfer from the note's current owner.
+// The recipient must already collaborate on the note.
+func (s *Store) CreateTransfer(t types.OwnershipTransfer) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var isCollab bool
+	err = tx.QueryRow(
+		`SELECT EXISTS (
+             SELECT 1 FROM note_collaborators
+             WHERE note_id = $1 AND user_id = $2
+               AND (expires_at IS NULL OR expires_at > NOW())
+         )`,
+		t.NoteID,
+		t.ToUserID,
+	).Scan(&isCollab)
+	if err != nil {
+		return 0, err
+	}
+	if !isCollab {
+		return 0, errTransferRecipient
+	}
+
+	var id int
+	err = tx.QueryRow(
+		`INSERT INTO note_ownership_transfers (note_id, from_user_id, to_user_id, keep_access)
+         VALUES ($1, $2, $3, $4)
+         ON CONFLICT DO NOTHING
+         RETURNING id`,
+		t.NoteID,
+		t.FromUserID,
+		t.ToUserID,
+		t.KeepAccess,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errTransferExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := recordAudit(tx, t.NoteID, t.FromUserID, "ownership_transfer_proposed", map[string]any{
+		"transferId": id,
+		"toUserId":   t.ToUserID,
+		"keepAccess": t.KeepAccess,
+	}); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetTransferByID(id int) (*types.OwnershipTransfer, error) {
+	return scanTransfer(s.db.QueryRow(transferSelect+` WHERE t.id = $1`, id))
+}
+
+func (s *Store) GetPendingTransfer(noteID int) (*types.OwnershipTransfer, error) {
+	return scanTransfer(s.db.QueryRow(
+		transferSelect+` WHERE t.note_id = $1 AND t.status = 'pending'`,
+		noteID,
+	))
+}
+
+func (s *Store) ListIncomingTransfers(userID int) ([]types.OwnershipTransfer, error) {
+	rows, err := s.db.Query(
+		transferSelect+` WHERE t.to_user_id = $1 AND t.status = 'pending'
+         ORDER BY t.created_at DESC, t.id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []types.OwnershipTransfer{}
+	for rows.Next() {
+		t, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, *t)
+	}
+
+	return transfers, rows.Err()
+}
+
+func (s *Store) CancelTransfer(noteID, actorID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(
+		`UPDATE note_ownership_transfers
+         SET status = 'cancelled', responded_at = NOW()
+         WHERE note_id = $1
+           AND status = 'pending'
+         RETURNING id`,
+		noteID,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	if err := recordAudit(tx, noteID, actorID, "ownership_transfer_cancelled", map[string]any{
+		"transferId": id,
+	}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RespondToTransfer accepts or declines a pending transfer addressed to
+// userID. Acceptance moves the note to the recipient, drops their
+// collaborator row, optionally keeps the previous owner as an editor and
+// detaches the note from the previous owner's folder, all in one
+// transaction. A transfer whose proposer no longer owns the note is
+// cancelled and errTransferStale returned.
+func (s *Store) RespondToTransfer(id, userID int, accept bool) (*types.OwnershipTransfer, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var noteID, fromUserID int
+	var keepAccess bool
+	err = tx.QueryRow(
+		`SELECT note_id, from_user_id, keep_access
+         FROM note_ownership_transfers
+         WHERE id = $1
+           AND to_user_id = $2
+           AND status = 'pending'
+         FOR UPDATE`,
+		id,
+		userID,
+	).Scan(&noteID, &fromUserID, &keepAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	var ownerID int
+	err = tx.QueryRow(
+		`SELECT owner_id FROM notes WHERE id = $1 FOR UPDATE`,
+		noteID,
+	).Scan(&ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ownerID != fromUserID {
+		if _, err := tx.Exec(
+			`UPDATE note_ownership_transfers
+             SET status = 'cancelled', responded_at = NOW()
+             WHERE id = $1`,
+			id,
+		); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, errTransferStale
+	}
+
+	status := types.TransferDeclined
+	action := "ownership_transfer_declined"
+	if accept {
+		status = types.TransferAccepted
+		action = "ownership_transferred"
+
+		if _, err := tx.Exec(
+			`UPDATE notes
+             SET owner_id = $2, folder_id = NULL, version = version + 1, updated_at = NOW()
+             WHERE id = $1`,
+			noteID,
+			userID,
+		); err != nil {
+			return nil, err
+		}
+
+		// The note leaves the old owner's folders, and with them the grants
+		// those folders handed down.
+		if _, err := tx.Exec(
+			`DELETE FROM note_collaborators
+             WHERE note_id = $1
+               AND (user_id = $2 OR source_folder_id IS NOT NULL)`,
+			noteID,
+			userID,
+		); err != nil {
+			return nil, err
+		}
+
+		if keepAccess {
+			if _, err := tx.Exec(
+				`INSERT INTO note_collaborators (note_id, user_id, role, added_by)
+                 VALUES ($1, $2, $3, $4)
+                 ON CONFLICT (note_id, user_id)
+                 DO UPDATE SET role = EXCLUDED.role, expires_at = NULL, added_by = EXCLUDED.added_by, source_folder_id = NULL`,
+				noteID,
+				fromUserID,
+				types.RoleEditor,
+				userID,
+			); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE note_ownership_transfers
+         SET status = $2, responded_at = NOW()
+         WHERE id = $1`,
+		id,
+		status,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := recordAudit(tx, noteID, userID, action, map[string]any{
+		"transferId": id,
+		"fromUserId": fromUserID,
+		"toUserId":   userID,
+		"keepAccess": keepAccess,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetTransferByID(id)
+}
+
+func (s *Store) ListAuditEntries(noteID, limit int) ([]types.AuditEntry, error) {
+	rows, err := s.db.Query(
+		`SELECT id, note_id, actor_id, action, details, created_at
+         FROM note_audit_log
+         WHERE note_id = $1
+         ORDER BY created_at DESC, id DESC
+         LIMIT $2`,
+		noteID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []types.AuditEntry{}
+	for rows.Next() {
+		var e types.AuditEntry
+		var actorID sql.NullInt64
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.NoteID, &actorID, &e.Action, &details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			e.ActorID = &id
+		}
+		if err := json.Unmarshal(details, &e.Details); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+const accessRequestSelect = `SELECT r.id, r.note_id, r.requester_id, u.username, r.role, r.message,
+	r.status, r.reviewer_id, r.created_at, r.responded_at
+	FROM note_access_requests r
+	JOIN users u ON u.id = r.requester_id`
+
+func scanAccessRequest(row scanner) (*types.AccessRequest, error) {
+	var req types.AccessRequest
+	var reviewerID sql.NullInt64
+	err := row.Scan(
+		&req.ID,
+		&req.NoteID,
+		&req.RequesterID,
+		&req.RequesterUsername,
+		&req.Role,
+		&req.Message,
+		&req.Status,
+		&reviewerID,
+		&req.CreatedAt,
+		&req.RespondedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if reviewerID.Valid {
+		id := int(reviewerID.Int64)
+		req.ReviewerID = &id
+	}
+
+	return &req, nil
+}
+
+func (s *Store) queryAccessRequests(query string, args ...any) ([]types.AccessRequest, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []types.AccessRequest{}
+	for rows.Next() {
+		req, err := scanAccessRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *req)
+	}
+
+	return requests, rows.Err()
+}
+
+// CreateAccessRequest records a pending request for access to a live note.
+// sql.ErrNoRows means the note does not exist or is archived; a second
+// pending request from the same user yields errAccessRequestExists.
+func (s *Store) CreateAccessRequest(req types.AccessRequest) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(
+		`SELECT TRUE FROM notes WHERE id = $1 AND is_archived = FALSE`,
+		req.NoteID,
+	).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = tx.QueryRow(
+		`INSERT INTO note_access_requests (note_id, requester_id, role, message)
+         VALUES ($1, $2, $3, $4)
+         ON CONFLICT DO NOTHING
+         RETURNING id`,
+		req.NoteID,
+		req.RequesterID,
+		req.Role,
+		req.Message,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errAccessRequestExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetAccessRequestByID(id int) (*types.AccessRequest, error) {
+	return scanAccessRequest(s.db.QueryRow(accessRequestSelect+` WHERE r.id = $1`, id))
+}
+
+func (s *Store) ListNoteAccessRequests(noteID int) ([]types.AccessRequest, error) {
+	return s.queryAccessRequests(
+		accessRequestSelect+` WHERE r.note_id = $1 AND r.status = 'pending'
+         ORDER BY r.created_at ASC, r.id ASC`,
+		noteID,
+	)
+}
+
+func (s *Store) ListUserAccessRequests(userID int) ([]types.AccessRequest, error) {
+	return s.queryAccessRequests(
+		accessRequestSelect+` WHERE r.requester_id = $1
+         ORDER BY r.created_at DESC, r.id DESC`,
+		userID,
+	)
+}
+
+func (s *Store) CancelAccessRequest(id, userID int) error {
+	res, err := s.db.Exec(
+		`UPDATE note_access_requests
+         SET status = 'cancelled', responded_at = NOW()
+         WHERE id = $1
+           AND requester_id = $2
+           AND status = 'pending'`,
+		id,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ResolveAccessRequest approves or denies a pending request on noteID.
+// Approving grants role to the requester in the same transaction, never
+// lowering a role they already hold.
+func (s *Store) ResolveAccessRequest(noteID, id, reviewerID int, approve bool, role types.CollaboratorRole) (*types.AccessRequest, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var requesterID int
+	err = tx.QueryRow(
+		`SELECT requester_id
+         FROM note_access_requests
+         WHERE id = $1
+           AND note_id = $2
+           AND status = 'pending'
+         FOR UPDATE`,
+		id,
+		noteID,
+	).Scan(&requesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	status, action := types.AccessRequestDenied, "access_request_denied"
+	if approve {
+		status, action = types.AccessRequestApproved, "access_request_approved"
+
+		if _, err := tx.Exec(
+			`INSERT INTO note_collaborators (note_id, user_id, role, added_by)
+             SELECT $1, $2, $3, $4
+             FROM notes
+             WHERE id = $1 AND owner_id <> $2
+             ON CONFLICT (note_id, user_id)
+             DO UPDATE SET role = EXCLUDED.role, expires_at = NULL, added_by = EXCLUDED.added_by, source_folder_id = NULL
+             WHERE note_collaborators.expires_at <= NOW()
+                OR collaborator_role_rank(note_collaborators.role) < collaborator_role_rank(EXCLUDED.role)`,
+			noteID,
+			requesterID,
+			role,
+			reviewerID,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE note_access_requests
+         SET status = $2, role = $3, reviewer_id = $4, responded_at = NOW()
+         WHERE id = $1`,
+		id,
+		status,
+		role,
+		reviewerID,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := recordAudit(tx, noteID, reviewerID, action, map[string]any{
+		"requestId": id,
+		"userId":    requesterID,
+		"role":      role,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetAccessRequestByID(id)
+}
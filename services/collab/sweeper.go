@@ -0,0 +1,41 @@
+package collab
+
+import (
+	"layer-api/types"
+	"log"
+	"time"
+)
+
+// RunGrantSweeper removes lapsed time-limited grants and tells each note's
+// owner whose access ended. Authorization already ignores lapsed grants, so
+// the interval only bounds how long the rows and notifications lag behind.
+func RunGrantSweeper(collabs types.CollaboratorStore, notifications types.NotificationStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sweepGrants(collabs, notifications)
+		<-ticker.C
+	}
+}
+
+func sweepGrants(collabs types.CollaboratorStore, notifications types.NotificationStore) {
+	grants, err := collabs.SweepExpiredGrants()
+	if err != nil {
+		log.Println("grant sweeper error:", err)
+		return
+	}
+
+	for _, g := range grants {
+		if err := notifications.CreateNotification(g.OwnerID, types.NotificationCollaboratorExpired, map[string]any{
+			"noteId":    g.NoteID,
+			"noteTitle": g.NoteTitle,
+			"userId":    g.UserID,
+			"username":  g.Username,
+			"role":      g.Role,
+			"expiredAt": g.ExpiredAt,
+		}); err != nil {
+			log.Println("grant sweeper notify error:", err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package collab
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"layer-api/authz"
+	"layer-api/types"
+	"layer-api/utils"
+	"net/http"
+)
+
+func (h *Handler) HandleProposeTransfer(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || ownerID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, _, ok := h.authorize(w, r, noteID, ownerID, authz.ActionTransfer); !ok {
+		return
+	}
+
+	var payload types.ProposeTransferPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.UserID == ownerID {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("you already own this note"))
+		return
+	}
+
+	keepAccess := true
+	if payload.KeepAccess != nil {
+		keepAccess = *payload.KeepAccess
+	}
+
+	id, err := h.transferStore.CreateTransfer(types.OwnershipTransfer{
+		NoteID:     noteID,
+		FromUserID: ownerID,
+		ToUserID:   payload.UserID,
+		KeepAccess: keepAccess,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errTransferRecipient):
+			utils.WriteError(w, http.StatusBadRequest, err)
+		case errors.Is(err, errTransferExists):
+			utils.WriteError(w, http.StatusConflict, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	transfer, err := h.transferStore.GetTransferByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, transfer)
+}
+
+func (h *Handler) HandleGetTransfer(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || ownerID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, _, ok := h.authorize(w, r, noteID, ownerID, authz.ActionTransfer); !ok {
+		return
+	}
+
+	transfer, err := h.transferStore.GetPendingTransfer(noteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("no pending transfer"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, transfer)
+}
+
+func (h *Handler) HandleCancelTransfer(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || ownerID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, _, ok := h.authorize(w, r, noteID, ownerID, authz.ActionTransfer); !ok {
+		return
+	}
+
+	if err := h.transferStore.CancelTransfer(noteID, ownerID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("no pending transfer"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "transfer cancelled"})
+}
+
+func (h *Handler) HandleListIncomingTransfers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	transfers, err := h.transferStore.ListIncomingTransfers(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, transfers)
+}
+
+func (h *Handler) HandleAcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	h.respondToTransfer(w, r, true)
+}
+
+func (h *Handler) HandleDeclineTransfer(w http.ResponseWriter, r *http.Request) {
+	h.respondToTransfer(w, r, false)
+}
+
+func (h *Handler) respondToTransfer(w http.ResponseWriter, r *http.Request, accept bool) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	transferID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	transfer, err := h.transferStore.RespondToTransfer(transferID, userID, accept)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("transfer not found"))
+		case errors.Is(err, errTransferStale):
+			utils.WriteError(w, http.StatusConflict, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, transfer)
+}
+
+func (h *Handler) HandleListAudit(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || actorID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, _, ok := h.authorize(w, r, noteID, actorID, authz.ActionViewAudit); !ok {
+		return
+	}
+
+	limit := utils.AtoiSafe(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	entries, err := h.transferStore.ListAuditEntries(noteID, limit)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,198 @@
+package export
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"layer-api/types"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+	FormatText     Format = "text"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^\p{L}\p{N}._ -]+`)
+
+type Collaborator struct {
+	UserID   int                    `json:"userId"`
+	Username string                 `json:"username"`
+	Role     types.CollaboratorRole `json:"role"`
+}
+
+type Document struct {
+	Note          types.Note
+	FolderPath    string
+	Tags          []string
+	Collaborators []Collaborator
+}
+
+func ParseFormat(raw string) (Format, error) {
+	switch strings.ToLower(raw) {
+	case "", "md", "markdown":
+		return FormatMarkdown, nil
+	case "html":
+		return FormatHTML, nil
+	case "txt", "text":
+		return FormatText, nil
+	default:
+		return "", fmt.Errorf("unsupported export format %q", raw)
+	}
+}
+
+func (f Format) Extension() string {
+	switch f {
+	case FormatHTML:
+		return ".html"
+	case FormatText:
+		return ".txt"
+	default:
+		return ".md"
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	case FormatText:
+		return "text/plain; charset=utf-8"
+	default:
+		return "text/markdown; charset=utf-8"
+	}
+}
+
+func FileName(n types.Note, f Format) string {
+	title := strings.TrimSpace(unsafeFileChars.ReplaceAllString(n.Title, ""))
+	if runes := []rune(title); len(runes) > 80 {
+		title = strings.TrimSpace(string(runes[:80]))
+	}
+	if title == "" {
+		title = "untitled"
+	}
+	return fmt.Sprintf("%s-%d%s", title, n.ID, f.Extension())
+}
+
+func Write(w io.Writer, doc Document, f Format) error {
+	switch f {
+	case FormatHTML:
+		return writeHTML(w, doc)
+	case FormatText:
+		return writeText(w, doc)
+	default:
+		return writeMarkdown(w, doc)
+	}
+}
+
+func writeMarkdown(w io.Writer, doc Document) error {
+	var b strings.Builder
+
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "id: %d\n", doc.Note.ID)
+	fmt.Fprintf(&b, "title: %s\n", strconv.Quote(doc.Note.Title))
+	fmt.Fprintf(&b, "created: %s\n", doc.Note.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "updated: %s\n", doc.Note.UpdatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "archived: %t\n", doc.Note.IsArchived)
+	if doc.FolderPath != "" {
+		fmt.Fprintf(&b, "folder: %s\n", strconv.Quote(doc.FolderPath))
+	}
+	if len(doc.Tags) > 0 {
+		b.WriteString("tags:\n")
+		for _, t := range doc.Tags {
+			fmt.Fprintf(&b, "  - %s\n", strconv.Quote(t))
+		}
+	}
+	if len(doc.Collaborators) > 0 {
+		b.WriteString("collaborators:\n")
+		for _, c := range doc.Collaborators {
+			fmt.Fprintf(&b, "  - username: %s\n", strconv.Quote(c.Username))
+			fmt.Fprintf(&b, "    userId: %d\n", c.UserID)
+			fmt.Fprintf(&b, "    role: %s\n", c.Role)
+		}
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(doc.Note.Content)
+	if !strings.HasSuffix(doc.Note.Content, "\n") {
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeHTML(w io.Writer, doc Document) error {
+	var b strings.Builder
+
+	title := html.EscapeString(doc.Note.Title)
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n", title)
+	fmt.Fprintf(&b, "<meta name=\"created\" content=\"%s\">\n", doc.Note.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "<meta name=\"updated\" content=\"%s\">\n", doc.Note.UpdatedAt.UTC().Format(time.RFC3339))
+	if len(doc.Tags) > 0 {
+		fmt.Fprintf(&b, "<meta name=\"keywords\" content=\"%s\">\n", html.EscapeString(strings.Join(doc.Tags, ", ")))
+	}
+	b.WriteString("</head>\n<body>\n<article>\n")
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", title)
+	b.WriteString(RenderMarkdown(doc.Note.Content))
+	b.WriteString("</article>\n<footer>\n<dl>\n")
+	fmt.Fprintf(&b, "<dt>Created</dt><dd>%s</dd>\n", doc.Note.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "<dt>Updated</dt><dd>%s</dd>\n", doc.Note.UpdatedAt.UTC().Format(time.RFC3339))
+	if doc.FolderPath != "" {
+		fmt.Fprintf(&b, "<dt>Folder</dt><dd>%s</dd>\n", html.EscapeString(doc.FolderPath))
+	}
+	if len(doc.Tags) > 0 {
+		fmt.Fprintf(&b, "<dt>Tags</dt><dd>%s</dd>\n", html.EscapeString(strings.Join(doc.Tags, ", ")))
+	}
+	if len(doc.Collaborators) > 0 {
+		fmt.Fprintf(&b, "<dt>Collaborators</dt><dd>%s</dd>\n", html.EscapeString(collaboratorNames(doc.Collaborators)))
+	}
+	b.WriteString("</dl>\n</footer>\n</body>\n</html>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeText(w io.Writer, doc Document) error {
+	var b strings.Builder
+
+	title := doc.Note.Title
+	if title == "" {
+		title = "Untitled"
+	}
+	b.WriteString(title + "\n")
+	b.WriteString(strings.Repeat("=", len([]rune(title))) + "\n\n")
+	fmt.Fprintf(&b, "Created: %s\n", doc.Note.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Updated: %s\n", doc.Note.UpdatedAt.UTC().Format(time.RFC3339))
+	if doc.FolderPath != "" {
+		fmt.Fprintf(&b, "Folder: %s\n", doc.FolderPath)
+	}
+	if len(doc.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s\n", strings.Join(doc.Tags, ", "))
+	}
+	if len(doc.Collaborators) > 0 {
+		fmt.Fprintf(&b, "Collaborators: %s\n", collaboratorNames(doc.Collaborators))
+	}
+	b.WriteString("\n")
+	b.WriteString(doc.Note.Content)
+	if !strings.HasSuffix(doc.Note.Content, "\n") {
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func collaboratorNames(collabs []Collaborator) string {
+	names := make([]string, len(collabs))
+	for i, c := range collabs {
+		names[i] = fmt.Sprintf("%s (%s)", c.Username, c.Role)
+	}
+	return strings.Join(names, ", ")
+}
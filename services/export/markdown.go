@@ -0,0 +1,175 @@
+package export
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	headingRe     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	orderedItemRe = regexp.MustCompile(`^\d+[.)]\s+(.*)$`)
+	linkRe        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	imageRe       = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	boldRe        = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	italicRe      = regexp.MustCompile(`\*(\S(?:.*?\S)?)\*|\b_(\S(?:.*?\S)?)_\b`)
+	strikeRe      = regexp.MustCompile(`~~(.+?)~~`)
+	codeSpanRe    = regexp.MustCompile("`([^`]+)`")
+)
+
+// RenderMarkdown converts the subset of Markdown used by note content into
+// HTML. All text is escaped before inline formatting is applied, so the
+// output is safe to embed in a page.
+func RenderMarkdown(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var out strings.Builder
+	var paragraph []string
+	listTag := ""
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + renderInline(strings.Join(paragraph, " ")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			out.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") {
+			flushParagraph()
+			closeList()
+
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+
+			if lang != "" {
+				out.WriteString(`<pre><code class="language-` + html.EscapeString(lang) + `">`)
+			} else {
+				out.WriteString("<pre><code>")
+			}
+			out.WriteString(html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+
+		case headingRe.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			m := headingRe.FindStringSubmatch(trimmed)
+			level := strconv.Itoa(len(m[1]))
+			out.WriteString("<h" + level + ">" + renderInline(m[2]) + "</h" + level + ">\n")
+
+		case trimmed == "---" || trimmed == "***" || trimmed == "___":
+			flushParagraph()
+			closeList()
+			out.WriteString("<hr>\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			closeList()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")))
+			}
+			i--
+			out.WriteString("<blockquote>\n" + RenderMarkdown(strings.Join(quote, "\n")) + "</blockquote>\n")
+
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ "):
+			flushParagraph()
+			openList("ul")
+			item := strings.TrimSpace(trimmed[2:])
+			switch {
+			case strings.HasPrefix(item, "[ ] "):
+				item = `<input type="checkbox" disabled> ` + renderInline(item[4:])
+			case strings.HasPrefix(item, "[x] ") || strings.HasPrefix(item, "[X] "):
+				item = `<input type="checkbox" checked disabled> ` + renderInline(item[4:])
+			default:
+				item = renderInline(item)
+			}
+			out.WriteString("<li>" + item + "</li>\n")
+
+		case orderedItemRe.MatchString(trimmed):
+			flushParagraph()
+			openList("ol")
+			m := orderedItemRe.FindStringSubmatch(trimmed)
+			out.WriteString("<li>" + renderInline(m[1]) + "</li>\n")
+
+		default:
+			closeList()
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+
+	flushParagraph()
+	closeList()
+
+	return out.String()
+}
+
+func renderInline(text string) string {
+	var spans []string
+	text = codeSpanRe.ReplaceAllStringFunc(text, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return "\x00" + strconv.Itoa(len(spans)-1) + "\x00"
+	})
+
+	text = html.EscapeString(text)
+
+	text = imageRe.ReplaceAllStringFunc(text, func(m string) string {
+		parts := imageRe.FindStringSubmatch(m)
+		if !safeURL(parts[2]) {
+			return parts[1]
+		}
+		return `<img src="` + parts[2] + `" alt="` + parts[1] + `">`
+	})
+	text = linkRe.ReplaceAllStringFunc(text, func(m string) string {
+		parts := linkRe.FindStringSubmatch(m)
+		if !safeURL(parts[2]) {
+			return parts[1]
+		}
+		return `<a href="` + parts[2] + `">` + parts[1] + `</a>`
+	})
+	text = boldRe.ReplaceAllString(text, "<strong>$1$2</strong>")
+	text = italicRe.ReplaceAllString(text, "<em>$1$2</em>")
+	text = strikeRe.ReplaceAllString(text, "<del>$1</del>")
+
+	for i, span := range spans {
+		text = strings.Replace(text, "\x00"+strconv.Itoa(i)+"\x00", span, 1)
+	}
+
+	return text
+}
+
+func safeURL(raw string) bool {
+	lower := strings.ToLower(html.UnescapeString(raw))
+	return strings.HasPrefix(lower, "http://") ||
+		strings.HasPrefix(lower, "https://") ||
+		strings.HasPrefix(lower, "mailto:") ||
+		strings.HasPrefix(lower, "/") ||
+		strings.HasPrefix(lower, "#") ||
+		!strings.Contains(lower, ":")
+}
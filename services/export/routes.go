@@ -0,0 +1,274 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"layer-api/authz"
+	"layer-api/types"
+	"layer-api/utils"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	noteStore   types.NoteStore
+	tagStore    types.TagStore
+	collabStore types.CollaboratorStore
+	folderStore types.FolderStore
+	userStore   types.UserStore
+	authz       *authz.Authorizer
+}
+
+func NewHandler(
+	noteStore types.NoteStore,
+	tagStore types.TagStore,
+	collabStore types.CollaboratorStore,
+	folderStore types.FolderStore,
+	userStore types.UserStore,
+	authorizer *authz.Authorizer,
+) *Handler {
+	return &Handler{
+		noteStore:   noteStore,
+		tagStore:    tagStore,
+		collabStore: collabStore,
+		folderStore: folderStore,
+		userStore:   userStore,
+		authz:       authorizer,
+	}
+}
+
+type manifestEntry struct {
+	ID            int            `json:"id"`
+	Title         string         `json:"title"`
+	File          string         `json:"file"`
+	Folder        string         `json:"folder,omitempty"`
+	Tags          []string       `json:"tags"`
+	Collaborators []Collaborator `json:"collaborators"`
+	IsArchived    bool           `json:"isArchived"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.Handle("/export/notes", utils.AuthMiddleware(http.HandlerFunc(h.handleExportAll))).Methods("GET")
+	router.Handle("/notes/{id}/export", utils.AuthMiddleware(http.HandlerFunc(h.handleExportNote))).Methods("GET")
+}
+
+func (h *Handler) handleExportNote(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	noteID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || noteID <= 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("invalid note id"))
+		return
+	}
+
+	format, err := ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	n, _, err := h.authz.Authorize(r.Context(), noteID, userID, authz.ActionView)
+	if err != nil {
+		authz.WriteError(w, err)
+		return
+	}
+
+	// Folders belong to the owner; collaborators get the note without the
+	// owner's folder names.
+	var folders map[int]string
+	if n.OwnerID == userID {
+		folders, err = h.folderPaths(userID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	doc, err := h.buildDocument(*n, userID, folders)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", FileName(*n, format)))
+	w.WriteHeader(http.StatusOK)
+
+	if err := Write(w, doc, format); err != nil {
+		log.Println("export write error:", err)
+	}
+}
+
+func (h *Handler) handleExportAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	format, err := ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	includeArchived := r.URL.Query().Get("archived") == "true"
+
+	folders, err := h.folderPaths(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	filename := fmt.Sprintf("layer-export-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	var manifest []manifestEntry
+
+	err = h.noteStore.ForEachNoteByOwner(userID, includeArchived, func(n types.Note) error {
+		doc, err := h.buildDocument(n, userID, folders)
+		if err != nil {
+			return err
+		}
+
+		file := path.Join(doc.FolderPath, FileName(n, format))
+		if n.IsArchived {
+			file = path.Join("archive", file)
+		}
+
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file,
+			Method:   zip.Deflate,
+			Modified: n.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if err := Write(fw, doc, format); err != nil {
+			return err
+		}
+
+		manifest = append(manifest, manifestEntry{
+			ID:            n.ID,
+			Title:         n.Title,
+			File:          file,
+			Folder:        doc.FolderPath,
+			Tags:          doc.Tags,
+			Collaborators: doc.Collaborators,
+			IsArchived:    n.IsArchived,
+			CreatedAt:     n.CreatedAt,
+			UpdatedAt:     n.UpdatedAt,
+		})
+		return nil
+	})
+	if err != nil {
+		log.Println("export archive error:", err)
+		_ = zw.Close()
+		return
+	}
+
+	mw, err := zw.Create("manifest.json")
+	if err == nil {
+		enc := json.NewEncoder(mw)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(map[string]any{
+			"exportedAt": time.Now().UTC(),
+			"format":     format,
+			"notes":      manifest,
+		})
+	}
+	if err != nil {
+		log.Println("export manifest error:", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		log.Println("export archive error:", err)
+	}
+}
+
+func (h *Handler) buildDocument(n types.Note, viewerID int, folders map[int]string) (Document, error) {
+	doc := Document{Note: n}
+
+	if n.FolderID != nil {
+		doc.FolderPath = folders[*n.FolderID]
+	}
+
+	tags, err := h.tagStore.ListTagsByNote(n.ID, viewerID)
+	if err != nil {
+		return doc, err
+	}
+	for _, t := range tags {
+		doc.Tags = append(doc.Tags, t.Name)
+	}
+
+	collabs, err := h.collabStore.ListCollaborators(n.ID)
+	if err != nil {
+		return doc, err
+	}
+	for _, c := range collabs {
+		entry := Collaborator{UserID: c.UserID, Role: c.Role}
+		if u, err := h.userStore.GetUserByID(c.UserID); err == nil {
+			entry.Username = u.Username
+		}
+		doc.Collaborators = append(doc.Collaborators, entry)
+	}
+
+	return doc, nil
+}
+
+func (h *Handler) folderPaths(ownerID int) (map[int]string, error) {
+	folders, err := h.folderStore.ListFoldersByOwner(ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]types.Folder, len(folders))
+	for _, f := range folders {
+		byID[f.ID] = f
+	}
+
+	paths := make(map[int]string, len(folders))
+	var resolve func(id int, depth int) string
+	resolve = func(id int, depth int) string {
+		if p, ok := paths[id]; ok {
+			return p
+		}
+		f, ok := byID[id]
+		if !ok || depth > len(folders) {
+			return ""
+		}
+		name := unsafeFileChars.ReplaceAllString(f.Name, "_")
+		if strings.Trim(name, ".") == "" {
+			name = "_"
+		}
+		p := name
+		if f.ParentID != nil {
+			p = path.Join(resolve(*f.ParentID, depth+1), name)
+		}
+		paths[id] = p
+		return p
+	}
+
+	for _, f := range folders {
+		resolve(f.ID, 0)
+	}
+
+	return paths, nil
+}
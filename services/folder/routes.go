@@ -0,0 +1,506 @@
+package folder
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"layer-api/authz"
+	"layer-api/types"
+	"layer-api/utils"
+	"layer-api/verification"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	folderStore types.FolderStore
+	noteStore   types.NoteStore
+	userStore   types.UserStore
+	authz       *authz.Authorizer
+	verified    *verification.Policy
+}
+
+func NewHandler(folderStore types.FolderStore, noteStore types.NoteStore, userStore types.UserStore, authorizer *authz.Authorizer, verified *verification.Policy) *Handler {
+	return &Handler{
+		folderStore: folderStore,
+		noteStore:   noteStore,
+		userStore:   userStore,
+		authz:       authorizer,
+		verified:    verified,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.Handle("/folders", utils.AuthMiddleware(http.HandlerFunc(h.handleCreateFolder))).Methods("POST")
+	router.Handle("/folders", utils.AuthMiddleware(http.HandlerFunc(h.handleGetFolderTree))).Methods("GET")
+	router.Handle("/folders/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleGetFolderContents))).Methods("GET")
+	router.Handle("/folders/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleRenameFolder))).Methods("PATCH")
+	router.Handle("/folders/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleDeleteFolder))).Methods("DELETE")
+	router.Handle("/folders/{id}/move", utils.AuthMiddleware(http.HandlerFunc(h.handleMoveFolder))).Methods("POST")
+
+	router.Handle("/folders/{id}/collaborators", utils.AuthMiddleware(h.verified.Require(verification.RestrictInvite, http.HandlerFunc(h.handleShareFolder)))).Methods("POST")
+	router.Handle("/folders/{id}/collaborators", utils.AuthMiddleware(http.HandlerFunc(h.handleListFolderCollaborators))).Methods("GET")
+	router.Handle("/folders/{id}/collaborators/{userId}", utils.AuthMiddleware(http.HandlerFunc(h.handleUnshareFolder))).Methods("DELETE")
+
+	router.Handle("/notes/{id}/move", utils.AuthMiddleware(http.HandlerFunc(h.handleMoveNote))).Methods("POST")
+}
+
+func (h *Handler) handleCreateFolder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	var payload types.CreateFolderPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.ParentID != nil {
+		if _, err := h.getOwnedFolder(*payload.ParentID, userID); err != nil {
+			writeFolderError(w, err)
+			return
+		}
+	}
+
+	id, err := h.folderStore.CreateFolder(types.Folder{
+		OwnerID:  userID,
+		ParentID: payload.ParentID,
+		Name:     payload.Name,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.folderStore.GetFolderByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) handleGetFolderTree(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	folders, err := h.folderStore.ListFoldersByOwner(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, buildTree(folders))
+}
+
+func (h *Handler) handleGetFolderContents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	f, err := h.getOwnedFolder(id, userID)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	children, err := h.folderStore.ListChildFolders(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	notes, err := h.folderStore.ListNotesInFolder(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if children == nil {
+		children = []types.Folder{}
+	}
+	if notes == nil {
+		notes = []types.Note{}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.FolderContents{
+		Folder:  *f,
+		Folders: children,
+		Notes:   notes,
+	})
+}
+
+func (h *Handler) handleRenameFolder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.UpdateFolderPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.folderStore.RenameFolder(id, userID, payload.Name); err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	f, err := h.folderStore.GetFolderByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, f)
+}
+
+func (h *Handler) handleMoveFolder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.MoveFolderPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.getOwnedFolder(id, userID); err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	if payload.ParentID != nil {
+		if _, err := h.getOwnedFolder(*payload.ParentID, userID); err != nil {
+			writeFolderError(w, err)
+			return
+		}
+	}
+
+	if err := h.folderStore.MoveFolder(id, userID, payload.ParentID); err != nil {
+		if errors.Is(err, errFolderCycle) {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeFolderError(w, err)
+		return
+	}
+
+	f, err := h.folderStore.GetFolderByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, f)
+}
+
+func (h *Handler) handleDeleteFolder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var cascade bool
+	switch r.URL.Query().Get("notes") {
+	case "", "reparent":
+		cascade = false
+	case "cascade":
+		cascade = true
+	default:
+		utils.WriteError(w, http.StatusBadRequest, errors.New("notes must be either cascade or reparent"))
+		return
+	}
+
+	if err := h.folderStore.DeleteFolder(id, userID, cascade); err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "folder deleted"})
+}
+
+func (h *Handler) handleMoveNote(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.MoveNotePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, _, err := h.authz.Authorize(r.Context(), noteID, userID, authz.ActionMove); err != nil {
+		authz.WriteError(w, err)
+		return
+	}
+
+	if payload.FolderID != nil {
+		if _, err := h.getOwnedFolder(*payload.FolderID, userID); err != nil {
+			writeFolderError(w, err)
+			return
+		}
+	}
+
+	if err := h.folderStore.MoveNoteToFolder(noteID, payload.FolderID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	moved, err := h.noteStore.GetNoteByID(noteID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, moved)
+}
+
+func (h *Handler) handleShareFolder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.getOwnedFolder(id, userID); err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	var payload types.AddCollaboratorPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.UserID == userID {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("owner cannot be a collaborator"))
+		return
+	}
+
+	if _, err := h.userStore.GetUserByID(payload.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	role := payload.Role
+	if role == "" {
+		role = types.RoleEditor
+	}
+
+	if err := h.folderStore.ShareFolder(id, payload.UserID, role); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "folder shared"})
+}
+
+func (h *Handler) handleListFolderCollaborators(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.getOwnedFolder(id, userID); err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	collabs, err := h.folderStore.ListFolderCollaborators(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, collabs)
+}
+
+func (h *Handler) handleUnshareFolder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	targetUserID, err := parseID(r, "userId")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.getOwnedFolder(id, userID); err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	if err := h.folderStore.UnshareFolder(id, targetUserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("user is not a collaborator"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "folder unshared"})
+}
+
+func (h *Handler) getOwnedFolder(id, userID int) (*types.Folder, error) {
+	f, err := h.folderStore.GetFolderByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if f.OwnerID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return f, nil
+}
+
+func buildTree(folders []types.Folder) []types.Folder {
+	children := make(map[int][]types.Folder)
+	var roots []types.Folder
+
+	for _, f := range folders {
+		if f.ParentID == nil {
+			roots = append(roots, f)
+			continue
+		}
+		children[*f.ParentID] = append(children[*f.ParentID], f)
+	}
+
+	var attach func(f types.Folder) types.Folder
+	attach = func(f types.Folder) types.Folder {
+		for _, c := range children[f.ID] {
+			f.Children = append(f.Children, attach(c))
+		}
+		return f
+	}
+
+	tree := []types.Folder{}
+	for _, root := range roots {
+		tree = append(tree, attach(root))
+	}
+
+	return tree
+}
+
+func writeFolderError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, errors.New("folder not found"))
+		return
+	}
+	utils.WriteError(w, http.StatusInternalServerError, err)
+}
+
+func parseID(r *http.Request, key string) (int, error) {
+	vars := mux.Vars(r)
+	raw, ok := vars[key]
+	if !ok || raw == "" {
+		return 0, fmt.Errorf("missing id")
+	}
+
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid id")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,470 @@
+package folder
+
+import (
+	"database/sql"
+	"errors"
+	"layer-api/types"
+)
+
+var errFolderCycle = errors.New("cannot move a folder into itself or one of its subfolders")
+
+const subtreeCTE = `WITH RECURSIVE subtree AS (
+    SELECT id FROM folders WHERE id = $1
+    UNION ALL
+    SELECT f.id FROM folders f JOIN subtree st ON f.parent_id = st.id
+)`
+
+// subtreeNotes selects the notes filed anywhere under folder $1.
+const subtreeNotes = subtreeCTE + ` SELECT n.id FROM notes n JOIN subtree st ON n.folder_id = st.id`
+
+// folderGrantsCTE selects, for every note yielded by scope, the strongest
+// role each folder collaborator inherits through the note's folder chain.
+// scope is a query returning note ids as id.
+func folderGrantsCTE(scope string) string {
+	return `WITH RECURSIVE scoped AS (` + scope + `), chain AS (
+    SELECT n.id AS note_id, n.owner_id, n.folder_id
+    FROM notes n
+    JOIN scoped s ON s.id = n.id
+    WHERE n.folder_id IS NOT NULL
+    UNION ALL
+    SELECT c.note_id, c.owner_id, f.parent_id
+    FROM chain c
+    JOIN folders f ON f.id = c.folder_id
+    WHERE f.parent_id IS NOT NULL
+), granted AS (
+    SELECT DISTINCT ON (c.note_id, fc.user_id) c.note_id, fc.user_id, fc.role, fc.folder_id, c.owner_id
+    FROM chain c
+    JOIN folder_collaborators fc ON fc.folder_id = c.folder_id
+    WHERE fc.user_id <> c.owner_id
+    ORDER BY c.note_id, fc.user_id, collaborator_role_rank(fc.role) DESC, fc.folder_id
+)`
+}
+
+// syncFolderGrants brings the folder-derived grants of the notes in scope in
+// line with their folder chain. Direct grants are left alone unless they
+// have lapsed.
+func syncFolderGrants(tx *sql.Tx, scope string, args ...any) error {
+	cte := folderGrantsCTE(scope)
+
+	if _, err := tx.Exec(
+		cte+`
+         DELETE FROM note_collaborators nc
+         USING scoped s
+         WHERE nc.note_id = s.id
+           AND nc.source_folder_id IS NOT NULL
+           AND NOT EXISTS (
+               SELECT 1 FROM granted g WHERE g.note_id = nc.note_id AND g.user_id = nc.user_id
+           )`,
+		args...,
+	); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(
+		cte+`
+         INSERT INTO note_collaborators (note_id, user_id, role, added_by, source_folder_id)
+         SELECT note_id, user_id, role, owner_id, folder_id
+         FROM granted
+         ON CONFLICT (note_id, user_id)
+         DO UPDATE SET role = EXCLUDED.role, expires_at = NULL, source_folder_id = EXCLUDED.source_folder_id
+         WHERE note_collaborators.source_folder_id IS NOT NULL
+            OR note_collaborators.expires_at <= NOW()`,
+		args...,
+	)
+	return err
+}
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateFolder(folder types.Folder) (int, error) {
+	var id int
+
+	err := s.db.QueryRow(
+		`INSERT INTO folders (owner_id, parent_id, name)
+         VALUES ($1, $2, $3)
+         RETURNING id`,
+		folder.OwnerID,
+		folder.ParentID,
+		folder.Name,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetFolderByID(id int) (*types.Folder, error) {
+	row := s.db.QueryRow(
+		`SELECT id, owner_id, parent_id, name, created_at, updated_at
+         FROM folders
+         WHERE id = $1
+         LIMIT 1`,
+		id,
+	)
+
+	var f types.Folder
+	err := row.Scan(
+		&f.ID,
+		&f.OwnerID,
+		&f.ParentID,
+		&f.Name,
+		&f.CreatedAt,
+		&f.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+func (s *Store) ListFoldersByOwner(ownerID int) ([]types.Folder, error) {
+	rows, err := s.db.Query(
+		`SELECT id, owner_id, parent_id, name, created_at, updated_at
+         FROM folders
+         WHERE owner_id = $1
+         ORDER BY LOWER(name) ASC`,
+		ownerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFolders(rows)
+}
+
+func (s *Store) ListChildFolders(parentID int) ([]types.Folder, error) {
+	rows, err := s.db.Query(
+		`SELECT id, owner_id, parent_id, name, created_at, updated_at
+         FROM folders
+         WHERE parent_id = $1
+         ORDER BY LOWER(name) ASC`,
+		parentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFolders(rows)
+}
+
+func (s *Store) ListNotesInFolder(folderID int) ([]types.Note, error) {
+	rows, err := s.db.Query(
+		`SELECT id, owner_id, folder_id, workspace_id, title, content, is_archived, version, created_at, updated_at
+         FROM notes
+         WHERE folder_id = $1
+           AND is_archived = FALSE
+         ORDER BY updated_at DESC`,
+		folderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []types.Note
+
+	for rows.Next() {
+		var n types.Note
+		if err := rows.Scan(
+			&n.ID,
+			&n.OwnerID,
+			&n.FolderID,
+			&n.WorkspaceID,
+			&n.Title,
+			&n.Content,
+			&n.IsArchived,
+			&n.Version,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+func (s *Store) RenameFolder(id, ownerID int, name string) error {
+	res, err := s.db.Exec(
+		`UPDATE folders SET name = $1, updated_at = NOW()
+         WHERE id = $2 AND owner_id = $3`,
+		name,
+		id,
+		ownerID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(res)
+}
+
+func (s *Store) MoveFolder(id, ownerID int, parentID *int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if parentID != nil {
+		var cycle bool
+		err := tx.QueryRow(
+			subtreeCTE+` SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)`,
+			id,
+			*parentID,
+		).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return errFolderCycle
+		}
+	}
+
+	res, err := tx.Exec(
+		`UPDATE folders SET parent_id = $1, updated_at = NOW()
+         WHERE id = $2 AND owner_id = $3`,
+		parentID,
+		id,
+		ownerID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res); err != nil {
+		return err
+	}
+
+	if err := syncFolderGrants(tx, subtreeNotes, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) DeleteFolder(id, ownerID int, cascade bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentID *int
+	err = tx.QueryRow(
+		`SELECT parent_id FROM folders WHERE id = $1 AND owner_id = $2 FOR UPDATE`,
+		id,
+		ownerID,
+	).Scan(&parentID)
+	if err != nil {
+		return err
+	}
+
+	if cascade {
+		if _, err := tx.Exec(
+			subtreeCTE+` DELETE FROM notes WHERE folder_id IN (SELECT id FROM subtree)`,
+			id,
+		); err != nil {
+			return err
+		}
+	} else {
+		// The folder drops out of every chain below it, and with it the
+		// grants it handed down.
+		if _, err := tx.Exec(`DELETE FROM folder_collaborators WHERE folder_id = $1`, id); err != nil {
+			return err
+		}
+		if err := syncFolderGrants(tx, subtreeNotes, id); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(
+			`UPDATE notes SET folder_id = $1, version = version + 1, updated_at = NOW() WHERE folder_id = $2`,
+			parentID,
+			id,
+		); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`UPDATE folders SET parent_id = $1, updated_at = NOW() WHERE parent_id = $2`,
+			parentID,
+			id,
+		); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM folders WHERE id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) MoveNoteToFolder(noteID int, folderID *int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE notes SET folder_id = $1, version = version + 1, updated_at = NOW() WHERE id = $2`,
+		folderID,
+		noteID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res); err != nil {
+		return err
+	}
+
+	// Grants inherited from the old folder chain go, the new chain's arrive.
+	if err := syncFolderGrants(tx, `SELECT id FROM notes WHERE id = $1`, noteID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) ShareFolder(folderID, userID int, role types.CollaboratorRole) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO folder_collaborators (folder_id, user_id, role)
+         VALUES ($1, $2, $3)
+         ON CONFLICT (folder_id, user_id)
+         DO UPDATE SET role = EXCLUDED.role`,
+		folderID,
+		userID,
+		role,
+	); err != nil {
+		return err
+	}
+
+	if err := syncFolderGrants(tx, subtreeNotes, folderID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) UnshareFolder(folderID, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`DELETE FROM folder_collaborators
+         WHERE folder_id = $1
+           AND user_id = $2`,
+		folderID,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res); err != nil {
+		return err
+	}
+
+	if err := syncFolderGrants(tx, subtreeNotes, folderID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) ListFolderCollaborators(folderID int) ([]types.FolderCollaborator, error) {
+	rows, err := s.db.Query(
+		`SELECT id, folder_id, user_id, role, created_at
+         FROM folder_collaborators
+         WHERE folder_id = $1
+         ORDER BY created_at ASC`,
+		folderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []types.FolderCollaborator
+
+	for rows.Next() {
+		var c types.FolderCollaborator
+		if err := rows.Scan(
+			&c.ID,
+			&c.FolderID,
+			&c.UserID,
+			&c.Role,
+			&c.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func scanFolders(rows *sql.Rows) ([]types.Folder, error) {
+	var result []types.Folder
+
+	for rows.Next() {
+		var f types.Folder
+		if err := rows.Scan(
+			&f.ID,
+			&f.OwnerID,
+			&f.ParentID,
+			&f.Name,
+			&f.CreatedAt,
+			&f.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func requireAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
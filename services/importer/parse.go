@@ -0,0 +1,481 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"layer-api/types"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	SourceMarkdown = "markdown"
+	SourceObsidian = "obsidian"
+	SourceENEX     = "enex"
+
+	maxEntrySize = 5 << 20
+)
+
+var (
+	inlineTagRe = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]*[\p{L}_/-][\p{L}\p{N}_/-]*)`)
+	headingRe   = regexp.MustCompile(`(?m)^#\s+(.+?)\s*$`)
+)
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"20060102T150405Z",
+}
+
+func DetectSource(filename, requested string) (string, error) {
+	switch strings.ToLower(requested) {
+	case SourceMarkdown, SourceObsidian, SourceENEX:
+		return strings.ToLower(requested), nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported import source %q", requested)
+	}
+
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".enex":
+		return SourceENEX, nil
+	case ".zip":
+		return SourceMarkdown, nil
+	default:
+		return "", errors.New("upload a .zip archive or an .enex export")
+	}
+}
+
+// Parse reads an uploaded archive into import items. Entries that cannot be
+// read are returned as failed results so the caller can report them
+// alongside the notes that were created.
+func Parse(source string, r io.ReaderAt, size int64) ([]types.ImportItem, []types.ImportResult, error) {
+	switch source {
+	case SourceENEX:
+		return parseENEX(io.NewSectionReader(r, 0, size))
+	case SourceMarkdown, SourceObsidian:
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid zip archive: %w", err)
+		}
+		return parseMarkdownZip(zr, source == SourceObsidian)
+	default:
+		return nil, nil, fmt.Errorf("unsupported import source %q", source)
+	}
+}
+
+func parseMarkdownZip(zr *zip.Reader, obsidian bool) ([]types.ImportItem, []types.ImportResult, error) {
+	var items []types.ImportItem
+	var failed []types.ImportResult
+
+	if !obsidian {
+		for _, f := range zr.File {
+			if strings.HasPrefix(f.Name, ".obsidian/") || strings.Contains(f.Name, "/.obsidian/") {
+				obsidian = true
+				break
+			}
+		}
+	}
+
+	root := commonRoot(zr.File)
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || skipEntry(f.Name) {
+			continue
+		}
+
+		ext := strings.ToLower(path.Ext(f.Name))
+		if ext != ".md" && ext != ".markdown" && ext != ".txt" {
+			continue
+		}
+
+		if f.UncompressedSize64 > maxEntrySize {
+			failed = append(failed, types.ImportResult{File: f.Name, Status: types.ImportStatusFailed, Error: "file is too large"})
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			failed = append(failed, types.ImportResult{File: f.Name, Status: types.ImportStatusFailed, Error: err.Error()})
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, maxEntrySize+1))
+		rc.Close()
+		if err != nil {
+			failed = append(failed, types.ImportResult{File: f.Name, Status: types.ImportStatusFailed, Error: err.Error()})
+			continue
+		}
+
+		rel := strings.TrimPrefix(f.Name, root)
+		item := parseMarkdownFile(rel, string(data), obsidian)
+		item.Path = f.Name
+		if item.UpdatedAt == nil && !f.Modified.IsZero() {
+			modified := f.Modified
+			item.UpdatedAt = &modified
+		}
+		items = append(items, item)
+	}
+
+	return items, failed, nil
+}
+
+func parseMarkdownFile(name, data string, obsidian bool) types.ImportItem {
+	data = strings.TrimPrefix(strings.ReplaceAll(data, "\r\n", "\n"), "\ufeff")
+	meta, body := splitFrontMatter(data)
+
+	item := types.ImportItem{
+		Content: strings.TrimLeft(body, "\n"),
+	}
+	if dir := path.Dir(name); dir != "." {
+		item.FolderPath = dir
+	}
+
+	if t, ok := meta["title"]; ok && len(t) > 0 {
+		item.Title = t[0]
+	} else if m := headingRe.FindStringSubmatch(body); m != nil && !obsidian {
+		item.Title = m[1]
+	} else {
+		item.Title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+
+	item.Tags = append(item.Tags, meta["tags"]...)
+	item.Tags = append(item.Tags, meta["tag"]...)
+	if obsidian {
+		for _, m := range inlineTagRe.FindAllStringSubmatch(stripCodeBlocks(body), -1) {
+			item.Tags = append(item.Tags, m[1])
+		}
+	}
+	item.Tags = dedupeTags(item.Tags)
+
+	for _, key := range []string{"created", "createdAt", "date"} {
+		if v, ok := meta[key]; ok && len(v) > 0 {
+			item.CreatedAt = parseTime(v[0])
+			break
+		}
+	}
+	for _, key := range []string{"updated", "updatedAt", "modified"} {
+		if v, ok := meta[key]; ok && len(v) > 0 {
+			item.UpdatedAt = parseTime(v[0])
+			break
+		}
+	}
+	if v, ok := meta["archived"]; ok && len(v) > 0 {
+		item.IsArchived = v[0] == "true"
+	}
+	if v, ok := meta["folder"]; ok && len(v) > 0 && item.FolderPath == "" {
+		item.FolderPath = v[0]
+	}
+
+	return item
+}
+
+// splitFrontMatter parses the YAML front matter subset written by exports
+// and common editors: scalar keys, inline lists and block lists of scalars.
+func splitFrontMatter(data string) (map[string][]string, string) {
+	meta := make(map[string][]string)
+
+	if !strings.HasPrefix(data, "---\n") {
+		return meta, data
+	}
+
+	end := strings.Index(data[4:], "\n---")
+	if end < 0 {
+		return meta, data
+	}
+
+	block := data[4 : 4+end]
+	body := data[4+end+4:]
+	if i := strings.IndexByte(body, '\n'); i >= 0 {
+		body = body[i+1:]
+	} else {
+		body = ""
+	}
+
+	var current string
+	for _, line := range strings.Split(block, "\n") {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "-") {
+			trimmed := strings.TrimSpace(line)
+			if current != "" && strings.HasPrefix(trimmed, "- ") && !strings.Contains(trimmed, ": ") {
+				meta[current] = append(meta[current], unquote(strings.TrimSpace(trimmed[2:])))
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			current = ""
+			continue
+		}
+		current = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch {
+		case value == "":
+			meta[current] = nil
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, v := range strings.Split(value[1:len(value)-1], ",") {
+				if v = unquote(strings.TrimSpace(v)); v != "" {
+					meta[current] = append(meta[current], v)
+				}
+			}
+		default:
+			meta[current] = []string{unquote(value)}
+		}
+	}
+
+	return meta, body
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"') {
+		inner := s[1 : len(s)-1]
+		inner = strings.ReplaceAll(inner, `\"`, `"`)
+		inner = strings.ReplaceAll(inner, `\n`, "\n")
+		inner = strings.ReplaceAll(inner, `\t`, "\t")
+		return strings.ReplaceAll(inner, `\\`, `\`)
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+func parseTime(raw string) *time.Time {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+func stripCodeBlocks(body string) string {
+	var b strings.Builder
+	inFence := false
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if !inFence {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+func dedupeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, t := range tags {
+		t = strings.TrimSpace(strings.TrimPrefix(t, "#"))
+		if t == "" || len(t) > 50 || seen[strings.ToLower(t)] {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		result = append(result, t)
+	}
+	return result
+}
+
+func skipEntry(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return path.Base(name) == "manifest.json"
+}
+
+// commonRoot returns the single top-level directory shared by every entry,
+// which archive tools add when zipping a folder.
+func commonRoot(files []*zip.File) string {
+	root := ""
+	for _, f := range files {
+		if skipEntry(f.Name) {
+			continue
+		}
+		first, _, found := strings.Cut(f.Name, "/")
+		if !found {
+			return ""
+		}
+		if root == "" {
+			root = first
+		} else if root != first {
+			return ""
+		}
+	}
+	if root == "" {
+		return ""
+	}
+	return root + "/"
+}
+
+type enexNote struct {
+	Title   string   `xml:"title"`
+	Content string   `xml:"content"`
+	Created string   `xml:"created"`
+	Updated string   `xml:"updated"`
+	Tags    []string `xml:"tag"`
+}
+
+func parseENEX(r io.Reader) ([]types.ImportItem, []types.ImportResult, error) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+
+	var items []types.ImportItem
+	var failed []types.ImportResult
+	index := 0
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid enex file: %w", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+		index++
+
+		var n enexNote
+		name := fmt.Sprintf("note-%d", index)
+		if err := dec.DecodeElement(&n, &start); err != nil {
+			failed = append(failed, types.ImportResult{File: name, Status: types.ImportStatusFailed, Error: err.Error()})
+			continue
+		}
+		if n.Title != "" {
+			name = n.Title
+		}
+
+		content, err := enmlToMarkdown(n.Content)
+		if err != nil {
+			failed = append(failed, types.ImportResult{File: name, Status: types.ImportStatusFailed, Error: err.Error()})
+			continue
+		}
+
+		item := types.ImportItem{
+			Path:      name,
+			Title:     n.Title,
+			Content:   content,
+			Tags:      dedupeTags(n.Tags),
+			CreatedAt: parseTime(n.Created),
+			UpdatedAt: parseTime(n.Updated),
+		}
+		items = append(items, item)
+	}
+
+	return items, failed, nil
+}
+
+// enmlToMarkdown flattens Evernote's XHTML note body into Markdown-style
+// plain text, keeping paragraphs, lists, checkboxes and links.
+func enmlToMarkdown(enml string) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader([]byte(enml)))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var b strings.Builder
+	var links []string
+	listDepth := 0
+
+	newline := func() {
+		s := b.String()
+		if s != "" && !strings.HasSuffix(s, "\n") {
+			b.WriteString("\n")
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid note content: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "br":
+				b.WriteString("\n")
+			case "div", "p":
+				newline()
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				newline()
+				b.WriteString(strings.Repeat("#", int(t.Name.Local[1]-'0')) + " ")
+			case "ul", "ol":
+				newline()
+				listDepth++
+			case "li":
+				newline()
+				b.WriteString(strings.Repeat("  ", max(listDepth-1, 0)) + "- ")
+			case "en-todo":
+				checked := false
+				for _, a := range t.Attr {
+					if a.Name.Local == "checked" && a.Value == "true" {
+						checked = true
+					}
+				}
+				if checked {
+					b.WriteString("[x] ")
+				} else {
+					b.WriteString("[ ] ")
+				}
+			case "a":
+				href := ""
+				for _, a := range t.Attr {
+					if a.Name.Local == "href" {
+						href = a.Value
+					}
+				}
+				links = append(links, href)
+				if href != "" {
+					b.WriteString("[")
+				}
+			case "hr":
+				newline()
+				b.WriteString("---\n")
+			}
+		case xml.EndElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "div", "p", "li", "h1", "h2", "h3", "h4", "h5", "h6":
+				newline()
+			case "ul", "ol":
+				listDepth--
+				newline()
+			case "a":
+				if len(links) > 0 {
+					href := links[len(links)-1]
+					links = links[:len(links)-1]
+					if href != "" {
+						b.WriteString("](" + href + ")")
+					}
+				}
+			}
+		case xml.CharData:
+			b.Write(t)
+		}
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,281 @@
+package importer
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"layer-api/types"
+	"layer-api/utils"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxUploadSize  = 100 << 20
+	asyncThreshold = 4 << 20
+	maxTitleLength = 200
+	maxContentSize = 100000
+	maxFolderName  = 100
+
+	// Running jobs are touched every jobHeartbeat; one untouched for
+	// staleJobAfter belongs to an instance that is gone.
+	jobHeartbeat  = 30 * time.Second
+	staleJobAfter = 2 * time.Minute
+)
+
+type Handler struct {
+	store types.ImportStore
+}
+
+func NewHandler(store types.ImportStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.Handle("/import", utils.AuthMiddleware(http.HandlerFunc(h.handleImport))).Methods("POST")
+	router.Handle("/import/jobs", utils.AuthMiddleware(http.HandlerFunc(h.handleListJobs))).Methods("GET")
+	router.Handle("/import/jobs/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleGetJob))).Methods("GET")
+}
+
+func (h *Handler) handleImport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("invalid or too large upload"))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("missing file"))
+		return
+	}
+	defer file.Close()
+
+	source, err := DetectSource(header.Filename, r.FormValue("source"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rootFolder := strings.TrimSpace(r.FormValue("folder"))
+	if rootFolder == "" {
+		rootFolder = strings.TrimSuffix(path.Base(header.Filename), path.Ext(header.Filename))
+	}
+
+	if header.Size <= asyncThreshold && r.FormValue("async") != "true" {
+		items, results, err := Parse(source, file, header.Size)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		imported, err := h.importItems(userID, rootFolder, items)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		results = append(results, imported...)
+
+		utils.WriteJSON(w, http.StatusOK, summarize(results))
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "layer-import-*")
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if _, err := io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	jobID, err := h.store.CreateImportJob(types.ImportJob{
+		OwnerID:  userID,
+		Source:   source,
+		Filename: header.Filename,
+		Status:   types.ImportJobPending,
+	})
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	go h.runJob(jobID, userID, source, rootFolder, tmp, header.Size)
+
+	job, err := h.store.GetImportJob(jobID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/import/jobs/%d", jobID))
+	utils.WriteJSON(w, http.StatusAccepted, job)
+}
+
+func (h *Handler) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	jobs, err := h.store.ListImportJobs(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, jobs)
+}
+
+func (h *Handler) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("invalid job id"))
+		return
+	}
+
+	job, err := h.store.GetImportJob(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("import job not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if job.OwnerID != userID {
+		utils.WriteError(w, http.StatusNotFound, errors.New("import job not found"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, job)
+}
+
+func (h *Handler) runJob(jobID, userID int, source, rootFolder string, tmp *os.File, size int64) {
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	if err := h.store.UpdateImportJobStatus(jobID, types.ImportJobRunning); err != nil {
+		log.Println("import job status error:", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go h.heartbeat(jobID, done)
+
+	items, results, err := Parse(source, tmp, size)
+	if err == nil {
+		var imported []types.ImportResult
+		imported, err = h.importItems(userID, rootFolder, items)
+		results = append(results, imported...)
+	}
+
+	status, errMsg := types.ImportJobCompleted, ""
+	if err != nil {
+		status, errMsg = types.ImportJobFailed, err.Error()
+	}
+
+	if err := h.store.FinishImportJob(jobID, status, results, errMsg); err != nil {
+		log.Println("import job finish error:", err)
+	}
+}
+
+// heartbeat keeps a running job fresh until done is closed, so the sweeper
+// can tell it apart from one orphaned by a restart.
+func (h *Handler) heartbeat(jobID int, done <-chan struct{}) {
+	ticker := time.NewTicker(jobHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := h.store.TouchImportJob(jobID); err != nil {
+				log.Println("import job heartbeat error:", err)
+			}
+		}
+	}
+}
+
+func (h *Handler) importItems(userID int, rootFolder string, items []types.ImportItem) ([]types.ImportResult, error) {
+	var valid []types.ImportItem
+	var results []types.ImportResult
+
+	for _, item := range items {
+		if len(item.Content) > maxContentSize {
+			results = append(results, types.ImportResult{
+				File:   item.Path,
+				Status: types.ImportStatusFailed,
+				Error:  "content exceeds 100000 characters",
+			})
+			continue
+		}
+
+		item.Title = strings.TrimSpace(item.Title)
+		if runes := []rune(item.Title); len(runes) > maxTitleLength {
+			item.Title = string(runes[:maxTitleLength])
+		}
+		valid = append(valid, item)
+	}
+
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	imported, err := h.store.ImportNotes(userID, rootFolder, valid)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(results, imported...), nil
+}
+
+func summarize(results []types.ImportResult) map[string]any {
+	imported := 0
+	for _, r := range results {
+		if r.Status == types.ImportStatusImported {
+			imported++
+		}
+	}
+	if results == nil {
+		results = []types.ImportResult{}
+	}
+
+	return map[string]any{
+		"total":    len(results),
+		"imported": imported,
+		"failed":   len(results) - imported,
+		"results":  results,
+	}
+}
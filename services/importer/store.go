@@ -0,0 +1,422 @@
+package importer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"layer-api/types"
+	"strings"
+	"time"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) ImportNotes(ownerID int, rootFolder string, items []types.ImportItem) ([]types.ImportResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var rootID *int
+	if rootFolder = truncateFolderName(strings.TrimSpace(rootFolder)); rootFolder != "" {
+		var id int
+		err := tx.QueryRow(
+			`INSERT INTO folders (owner_id, name) VALUES ($1, $2) RETURNING id`,
+			ownerID,
+			rootFolder,
+		).Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		rootID = &id
+	}
+
+	cache := newImportCache()
+	results := make([]types.ImportResult, 0, len(items))
+
+	for _, item := range items {
+		if _, err := tx.Exec(`SAVEPOINT import_item`); err != nil {
+			return nil, err
+		}
+
+		noteID, err := importItem(tx, ownerID, rootID, item, cache)
+		if err != nil {
+			if _, rbErr := tx.Exec(`ROLLBACK TO SAVEPOINT import_item`); rbErr != nil {
+				return nil, rbErr
+			}
+			cache.discard()
+			results = append(results, types.ImportResult{
+				File:   item.Path,
+				Status: types.ImportStatusFailed,
+				Error:  err.Error(),
+			})
+			continue
+		}
+
+		if _, err := tx.Exec(`RELEASE SAVEPOINT import_item`); err != nil {
+			return nil, err
+		}
+		cache.keep()
+		results = append(results, types.ImportResult{
+			File:   item.Path,
+			Status: types.ImportStatusImported,
+			NoteID: noteID,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// importCache remembers the folders and tags an import has found or created.
+// What the current item adds stays pending until its savepoint is released,
+// since rolling the item back also removes the rows those IDs point to.
+type importCache struct {
+	folders        map[string]int
+	tags           map[string]int
+	pendingFolders map[string]int
+	pendingTags    map[string]int
+}
+
+func newImportCache() *importCache {
+	return &importCache{
+		folders:        make(map[string]int),
+		tags:           make(map[string]int),
+		pendingFolders: make(map[string]int),
+		pendingTags:    make(map[string]int),
+	}
+}
+
+func (c *importCache) folder(key string) (int, bool) {
+	if id, ok := c.folders[key]; ok {
+		return id, true
+	}
+	id, ok := c.pendingFolders[key]
+	return id, ok
+}
+
+func (c *importCache) tag(key string) (int, bool) {
+	if id, ok := c.tags[key]; ok {
+		return id, true
+	}
+	id, ok := c.pendingTags[key]
+	return id, ok
+}
+
+// keep makes the current item's entries permanent.
+func (c *importCache) keep() {
+	for k, id := range c.pendingFolders {
+		c.folders[k] = id
+	}
+	for k, id := range c.pendingTags {
+		c.tags[k] = id
+	}
+	c.discard()
+}
+
+// discard forgets the current item's entries.
+func (c *importCache) discard() {
+	clear(c.pendingFolders)
+	clear(c.pendingTags)
+}
+
+func importItem(tx *sql.Tx, ownerID int, rootID *int, item types.ImportItem, cache *importCache) (int, error) {
+	folderID := rootID
+	if item.FolderPath != "" {
+		id, err := ensureFolder(tx, ownerID, rootID, item.FolderPath, cache)
+		if err != nil {
+			return 0, err
+		}
+		folderID = &id
+	}
+
+	var noteID int
+	err := tx.QueryRow(
+		`INSERT INTO notes (owner_id, folder_id, title, content, is_archived, created_at, updated_at)
+         VALUES ($1, $2, $3, $4, $5, COALESCE($6, NOW()), COALESCE($7, $6, NOW()))
+         RETURNING id`,
+		ownerID,
+		folderID,
+		item.Title,
+		item.Content,
+		item.IsArchived,
+		item.CreatedAt,
+		item.UpdatedAt,
+	).Scan(&noteID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, name := range item.Tags {
+		key := strings.ToLower(name)
+		tagID, ok := cache.tag(key)
+		if !ok {
+			err := tx.QueryRow(
+				`SELECT id FROM tags WHERE owner_id = $1 AND LOWER(name) = $2`,
+				ownerID,
+				key,
+			).Scan(&tagID)
+			if err == sql.ErrNoRows {
+				err = tx.QueryRow(
+					`INSERT INTO tags (owner_id, name) VALUES ($1, $2) RETURNING id`,
+					ownerID,
+					name,
+				).Scan(&tagID)
+			}
+			if err != nil {
+				return 0, err
+			}
+			cache.pendingTags[key] = tagID
+		}
+
+		if _, err := tx.Exec(
+			`INSERT INTO note_tags (note_id, tag_id) VALUES ($1, $2)
+             ON CONFLICT (note_id, tag_id) DO NOTHING`,
+			noteID,
+			tagID,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	return noteID, nil
+}
+
+func ensureFolder(tx *sql.Tx, ownerID int, rootID *int, folderPath string, cache *importCache) (int, error) {
+	parentID := rootID
+	current := ""
+
+	for _, name := range strings.Split(folderPath, "/") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		name = truncateFolderName(name)
+
+		current += "/" + name
+		if id, ok := cache.folder(current); ok {
+			parentID = &id
+			continue
+		}
+
+		var id int
+		err := tx.QueryRow(
+			`SELECT id FROM folders
+             WHERE owner_id = $1
+               AND parent_id IS NOT DISTINCT FROM $2
+               AND name = $3
+             LIMIT 1`,
+			ownerID,
+			parentID,
+			name,
+		).Scan(&id)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow(
+				`INSERT INTO folders (owner_id, parent_id, name) VALUES ($1, $2, $3) RETURNING id`,
+				ownerID,
+				parentID,
+				name,
+			).Scan(&id)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		cache.pendingFolders[current] = id
+		parentID = &id
+	}
+
+	if parentID == nil {
+		return 0, sql.ErrNoRows
+	}
+
+	return *parentID, nil
+}
+
+// truncateFolderName fits name into folders.name.
+func truncateFolderName(name string) string {
+	if len([]rune(name)) > maxFolderName {
+		return string([]rune(name)[:maxFolderName])
+	}
+	return name
+}
+
+func (s *Store) CreateImportJob(job types.ImportJob) (int, error) {
+	var id int
+
+	err := s.db.QueryRow(
+		`INSERT INTO import_jobs (owner_id, source, filename, status)
+         VALUES ($1, $2, $3, $4)
+         RETURNING id`,
+		job.OwnerID,
+		job.Source,
+		job.Filename,
+		job.Status,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetImportJob(id int) (*types.ImportJob, error) {
+	row := s.db.QueryRow(
+		`SELECT id, owner_id, source, filename, status, total, imported, failed,
+                results, error, created_at, updated_at, finished_at
+         FROM import_jobs
+         WHERE id = $1
+         LIMIT 1`,
+		id,
+	)
+
+	var j types.ImportJob
+	var results []byte
+	err := row.Scan(
+		&j.ID,
+		&j.OwnerID,
+		&j.Source,
+		&j.Filename,
+		&j.Status,
+		&j.Total,
+		&j.Imported,
+		&j.Failed,
+		&results,
+		&j.Error,
+		&j.CreatedAt,
+		&j.UpdatedAt,
+		&j.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(results, &j.Results); err != nil {
+		return nil, err
+	}
+
+	return &j, nil
+}
+
+func (s *Store) ListImportJobs(ownerID int) ([]types.ImportJob, error) {
+	rows, err := s.db.Query(
+		`SELECT id, owner_id, source, filename, status, total, imported, failed,
+                error, created_at, updated_at, finished_at
+         FROM import_jobs
+         WHERE owner_id = $1
+         ORDER BY created_at DESC
+         LIMIT 50`,
+		ownerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []types.ImportJob
+
+	for rows.Next() {
+		var j types.ImportJob
+		if err := rows.Scan(
+			&j.ID,
+			&j.OwnerID,
+			&j.Source,
+			&j.Filename,
+			&j.Status,
+			&j.Total,
+			&j.Imported,
+			&j.Failed,
+			&j.Error,
+			&j.CreatedAt,
+			&j.UpdatedAt,
+			&j.FinishedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, j)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *Store) UpdateImportJobStatus(id int, status string) error {
+	_, err := s.db.Exec(
+		`UPDATE import_jobs SET status = $1, updated_at = NOW() WHERE id = $2`,
+		status,
+		id,
+	)
+	return err
+}
+
+// TouchImportJob records that a job is still being worked on.
+func (s *Store) TouchImportJob(id int) error {
+	_, err := s.db.Exec(`UPDATE import_jobs SET updated_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+// FailStaleImportJobs fails pending or running jobs that nobody touched for
+// staleAfter, left behind by an instance that stopped mid-import, and
+// returns how many there were.
+func (s *Store) FailStaleImportJobs(staleAfter time.Duration, errMsg string) (int64, error) {
+	res, err := s.db.Exec(
+		`UPDATE import_jobs
+         SET status = $1, error = $2, updated_at = NOW(), finished_at = NOW()
+         WHERE status IN ($3, $4)
+           AND updated_at < NOW() - make_interval(secs => $5)`,
+		types.ImportJobFailed,
+		errMsg,
+		types.ImportJobPending,
+		types.ImportJobRunning,
+		staleAfter.Seconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *Store) FinishImportJob(id int, status string, results []types.ImportResult, errMsg string) error {
+	if results == nil {
+		results = []types.ImportResult{}
+	}
+
+	encoded, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+
+	imported := 0
+	for _, r := range results {
+		if r.Status == types.ImportStatusImported {
+			imported++
+		}
+	}
+
+	_, err = s.db.Exec(
+		`UPDATE import_jobs
+         SET status = $1, total = $2, imported = $3, failed = $4, results = $5,
+             error = $6, updated_at = NOW(), finished_at = NOW()
+         WHERE id = $7`,
+		status,
+		len(results),
+		imported,
+		len(results)-imported,
+		encoded,
+		errMsg,
+		id,
+	)
+	return err
+}
@@ -0,0 +1,286 @@
+package importer
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"layer-api/types"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// simDriver models just enough of PostgreSQL for ImportNotes: folders, tags
+// and notes with their foreign keys, and savepoints that undo the rows an
+// item created.
+type simDriver struct{ db *simDB }
+
+type simDB struct {
+	mu      sync.Mutex
+	nextID  int64
+	folders map[int64]simFolder
+	tags    map[int64]string
+	notes   map[int64]simNote
+	// created lists what was inserted since the last SAVEPOINT.
+	created []func()
+}
+
+type simFolder struct {
+	parent *int64
+	name   string
+}
+
+type simNote struct {
+	folder *int64
+	title  string
+	tags   []int64
+}
+
+func (d simDriver) Open(string) (driver.Conn, error) { return &simConn{db: d.db}, nil }
+
+type simConn struct{ db *simDB }
+
+func (c *simConn) Prepare(query string) (driver.Stmt, error) {
+	return &simStmt{db: c.db, query: query}, nil
+}
+func (c *simConn) Close() error              { return nil }
+func (c *simConn) Begin() (driver.Tx, error) { return simTx{}, nil }
+
+type simTx struct{}
+
+func (simTx) Commit() error   { return nil }
+func (simTx) Rollback() error { return nil }
+
+type simStmt struct {
+	db    *simDB
+	query string
+}
+
+func (s *simStmt) Close() error  { return nil }
+func (s *simStmt) NumInput() int { return -1 }
+
+func (s *simStmt) Exec(args []driver.Value) (driver.Result, error) {
+	_, err := s.run(args)
+	return driver.RowsAffected(1), err
+}
+
+func (s *simStmt) Query(args []driver.Value) (driver.Rows, error) {
+	id, err := s.run(args)
+	if err != nil {
+		return nil, err
+	}
+	rows := &simRows{}
+	if id != 0 {
+		rows.values = []driver.Value{id}
+	}
+	return rows, nil
+}
+
+func optionalID(v driver.Value) *int64 {
+	if v == nil {
+		return nil
+	}
+	id := v.(int64)
+	return &id
+}
+
+func sameParent(a, b *int64) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// run executes one statement and returns the id it selected or inserted,
+// or 0 for no row.
+func (s *simStmt) run(args []driver.Value) (int64, error) {
+	db := s.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	q := strings.Join(strings.Fields(s.query), " ")
+	switch {
+	case strings.HasPrefix(q, "SAVEPOINT"), strings.HasPrefix(q, "RELEASE SAVEPOINT"):
+		db.created = nil
+		return 0, nil
+
+	case strings.HasPrefix(q, "ROLLBACK TO SAVEPOINT"):
+		for _, undo := range db.created {
+			undo()
+		}
+		db.created = nil
+		return 0, nil
+
+	case strings.HasPrefix(q, "INSERT INTO folders"):
+		f := simFolder{name: args[len(args)-1].(string)}
+		if len(args) == 3 {
+			f.parent = optionalID(args[1])
+		}
+		if len([]rune(f.name)) > 100 {
+			return 0, errors.New(`value too long for type character varying(100)`)
+		}
+		if f.parent != nil {
+			if _, ok := db.folders[*f.parent]; !ok {
+				return 0, errors.New(`insert on table "folders" violates foreign key constraint`)
+			}
+		}
+		db.nextID++
+		id := db.nextID
+		db.folders[id] = f
+		db.created = append(db.created, func() { delete(db.folders, id) })
+		return id, nil
+
+	case strings.HasPrefix(q, "SELECT id FROM folders"):
+		parent := optionalID(args[1])
+		for id, f := range db.folders {
+			if f.name == args[2].(string) && sameParent(f.parent, parent) {
+				return id, nil
+			}
+		}
+		return 0, nil
+
+	case strings.HasPrefix(q, "INSERT INTO notes"):
+		n := simNote{folder: optionalID(args[1]), title: args[2].(string)}
+		if n.folder != nil {
+			if _, ok := db.folders[*n.folder]; !ok {
+				return 0, errors.New(`insert on table "notes" violates foreign key constraint "notes_folder_id_fkey"`)
+			}
+		}
+		if strings.ContainsRune(args[3].(string), 0) {
+			return 0, errors.New(`invalid byte sequence for encoding "UTF8": 0x00`)
+		}
+		db.nextID++
+		id := db.nextID
+		db.notes[id] = n
+		db.created = append(db.created, func() { delete(db.notes, id) })
+		return id, nil
+
+	case strings.HasPrefix(q, "SELECT id FROM tags"):
+		for id, name := range db.tags {
+			if strings.ToLower(name) == args[1].(string) {
+				return id, nil
+			}
+		}
+		return 0, nil
+
+	case strings.HasPrefix(q, "INSERT INTO tags"):
+		db.nextID++
+		id := db.nextID
+		db.tags[id] = args[1].(string)
+		db.created = append(db.created, func() { delete(db.tags, id) })
+		return id, nil
+
+	case strings.HasPrefix(q, "INSERT INTO note_tags"):
+		noteID, tagID := args[0].(int64), args[1].(int64)
+		if _, ok := db.tags[tagID]; !ok {
+			return 0, errors.New(`insert on table "note_tags" violates foreign key constraint "note_tags_tag_id_fkey"`)
+		}
+		n := db.notes[noteID]
+		n.tags = append(n.tags, tagID)
+		db.notes[noteID] = n
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unexpected query %q", q)
+}
+
+type simRows struct {
+	values []driver.Value
+	done   bool
+}
+
+func (r *simRows) Columns() []string { return []string{"id"} }
+func (r *simRows) Close() error      { return nil }
+
+func (r *simRows) Next(dest []driver.Value) error {
+	if r.done || r.values == nil {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+	return nil
+}
+
+var simDBs = struct {
+	sync.Mutex
+	n int
+}{}
+
+func newSimStore(t *testing.T) (*Store, *simDB) {
+	t.Helper()
+
+	sim := &simDB{
+		folders: make(map[int64]simFolder),
+		tags:    make(map[int64]string),
+		notes:   make(map[int64]simNote),
+	}
+
+	simDBs.Lock()
+	simDBs.n++
+	name := fmt.Sprintf("importer-sim-%d", simDBs.n)
+	simDBs.Unlock()
+	sql.Register(name, simDriver{db: sim})
+
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return NewStore(db), sim
+}
+
+func TestImportNotesSurvivesFailedItem(t *testing.T) {
+	store, sim := newSimStore(t)
+
+	items := []types.ImportItem{
+		// Creates "Projects/Alpha" and the "plans" tag, then fails.
+		{Path: "Projects/Alpha/bad.md", Title: "Bad", Content: "nul \x00 byte", FolderPath: "Projects/Alpha", Tags: []string{"plans"}},
+		{Path: "Projects/Alpha/good.md", Title: "Good", Content: "fine", FolderPath: "Projects/Alpha", Tags: []string{"Plans"}},
+		{Path: "Projects/Alpha/also.md", Title: "Also", Content: "fine too", FolderPath: "Projects/Alpha", Tags: []string{"plans"}},
+	}
+
+	results, err := store.ImportNotes(1, "export", items)
+	if err != nil {
+		t.Fatalf("ImportNotes: %v", err)
+	}
+
+	want := []string{types.ImportStatusFailed, types.ImportStatusImported, types.ImportStatusImported}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Fatalf("result %d (%s) = %s %q, want %s", i, r.File, r.Status, r.Error, want[i])
+		}
+	}
+
+	if len(sim.notes) != 2 {
+		t.Fatalf("%d notes stored, want 2", len(sim.notes))
+	}
+	for _, n := range sim.notes {
+		if n.folder == nil || sim.folders[*n.folder].name != "Alpha" {
+			t.Fatalf("note %q filed in %v, want Alpha", n.title, n.folder)
+		}
+		if len(n.tags) != 1 || sim.tags[n.tags[0]] != "Plans" {
+			t.Fatalf("note %q tags = %v", n.title, n.tags)
+		}
+	}
+	// export, Projects and Alpha, each created once by the good note.
+	if len(sim.folders) != 3 {
+		t.Fatalf("%d folders stored, want 3", len(sim.folders))
+	}
+}
+
+func TestImportNotesTruncatesRootFolder(t *testing.T) {
+	store, sim := newSimStore(t)
+
+	root := strings.Repeat("ü", 150)
+	results, err := store.ImportNotes(1, root, []types.ImportItem{{Path: "a.md", Title: "A", Content: "a"}})
+	if err != nil {
+		t.Fatalf("ImportNotes with a long root folder: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != types.ImportStatusImported {
+		t.Fatalf("results = %+v", results)
+	}
+	for _, f := range sim.folders {
+		if got := len([]rune(f.name)); got != maxFolderName {
+			t.Fatalf("root folder name has %d runes, want %d", got, maxFolderName)
+		}
+	}
+}
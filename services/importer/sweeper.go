@@ -0,0 +1,25 @@
+package importer
+
+import (
+	"layer-api/types"
+	"log"
+	"time"
+)
+
+// RunJobSweeper fails import jobs orphaned by a restart or crash. The upload
+// only ever lived in the stopped instance's temp directory, so the job
+// cannot be resumed; the first sweep runs at startup.
+func RunJobSweeper(store types.ImportStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := store.FailStaleImportJobs(staleJobAfter, "import was interrupted; upload the file again")
+		if err != nil {
+			log.Println("import job sweeper error:", err)
+		} else if n > 0 {
+			log.Printf("import job sweeper: failed %d interrupted jobs", n)
+		}
+		<-ticker.C
+	}
+}
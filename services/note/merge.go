@@ -0,0 +1,215 @@
+package note
+
+import (
+	"errors"
+	"layer-api/types"
+	"strings"
+)
+
+// maxDiffDistance caps how many lines may differ between two versions, and
+// maxDiffLines how long the differing middle section may be, before a merge
+// is refused. Together they bound a merge to a few megabytes.
+const (
+	maxDiffDistance = 1000
+	maxDiffLines    = 20000
+)
+
+var (
+	errDiffTooLarge    = errors.New("changes are too large to merge automatically")
+	errBaseUnavailable = errors.New("base version is no longer available")
+)
+
+// mergeLines performs a line-level three-way merge of current and incoming,
+// which were both derived from base. It returns the merged text when every
+// change applies cleanly, otherwise the overlapping regions.
+func mergeLines(base, current, incoming string) (string, []types.MergeConflict, error) {
+	b := splitLines(base)
+	c := splitLines(current)
+	in := splitLines(incoming)
+
+	toCurrent, err := matchLines(b, c)
+	if err != nil {
+		return "", nil, err
+	}
+	toIncoming, err := matchLines(b, in)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var merged []string
+	var conflicts []types.MergeConflict
+
+	resolve := func(bLo, bHi, cLo, cHi, iLo, iHi int) {
+		bs, cs, is := b[bLo:bHi], c[cLo:cHi], in[iLo:iHi]
+		switch {
+		case equalLines(cs, bs):
+			merged = append(merged, is...)
+		case equalLines(is, bs), equalLines(cs, is):
+			merged = append(merged, cs...)
+		default:
+			conflicts = append(conflicts, types.MergeConflict{
+				Field:     "content",
+				BaseStart: bLo + 1,
+				Base:      nonNil(bs),
+				Current:   nonNil(cs),
+				Incoming:  nonNil(is),
+			})
+			merged = append(merged, "<<<<<<< current")
+			merged = append(merged, cs...)
+			merged = append(merged, "=======")
+			merged = append(merged, is...)
+			merged = append(merged, ">>>>>>> incoming")
+		}
+	}
+
+	bi, ci, ii := 0, 0, 0
+	for {
+		next := -1
+		for k := bi; k < len(b); k++ {
+			if toCurrent[k] >= 0 && toIncoming[k] >= 0 {
+				next = k
+				break
+			}
+		}
+
+		if next < 0 {
+			resolve(bi, len(b), ci, len(c), ii, len(in))
+			break
+		}
+
+		nc, ni := toCurrent[next], toIncoming[next]
+		if next > bi || nc > ci || ni > ii {
+			resolve(bi, next, ci, nc, ii, ni)
+		}
+
+		merged = append(merged, b[next])
+		bi, ci, ii = next+1, nc+1, ni+1
+	}
+
+	return strings.Join(merged, "\n"), conflicts, nil
+}
+
+// matchLines returns, for each line of a, the index of the line of b it is
+// paired with in a longest common subsequence, or -1. It uses Myers' O(ND)
+// algorithm so small edits to large notes stay cheap.
+func matchLines(a, b []string) ([]int, error) {
+	match := make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+
+	// Lines shared at both ends pair up directly, which keeps typical edits
+	// to long notes out of the search below.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		match[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		match[len(a)-1-suffix] = len(b) - 1 - suffix
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	n, m := len(a), len(b)
+	total := n + m
+	if total == 0 {
+		return match, nil
+	}
+	if total > maxDiffLines {
+		return nil, errDiffTooLarge
+	}
+
+	offset := total + 1
+	v := make([]int, 2*total+3)
+	// trace[d] holds v for diagonals -d-1..d+1 as it was before step d,
+	// which is all the backtrack reads, so memory grows with D² rather than
+	// D·(N+M).
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= total; d++ {
+		if d > maxDiffDistance {
+			return nil, errDiffTooLarge
+		}
+
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0 && (x > 0 || y > 0); d-- {
+		vd := trace[d]
+		at := func(k int) int { return vd[k+d+1] }
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			match[prefix+x] = prefix + y
+		}
+
+		if d > 0 {
+			x, y = prevX, prevY
+		}
+	}
+
+	return match, nil
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func nonNil(lines []string) []string {
+	if lines == nil {
+		return []string{}
+	}
+	return lines
+}
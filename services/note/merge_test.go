@@ -0,0 +1,224 @@
+package note
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMergeLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		current   string
+		incoming  string
+		want      string
+		conflicts int
+	}{
+		{
+			name:     "no changes",
+			base:     "a\nb\nc",
+			current:  "a\nb\nc",
+			incoming: "a\nb\nc",
+			want:     "a\nb\nc",
+		},
+		{
+			name:     "only incoming changed",
+			base:     "a\nb\nc",
+			current:  "a\nb\nc",
+			incoming: "a\nB\nc",
+			want:     "a\nB\nc",
+		},
+		{
+			name:     "only current changed",
+			base:     "a\nb\nc",
+			current:  "a\nb\nC",
+			incoming: "a\nb\nc",
+			want:     "a\nb\nC",
+		},
+		{
+			name:     "separate lines changed",
+			base:     "a\nb\nc\nd\ne",
+			current:  "A\nb\nc\nd\ne",
+			incoming: "a\nb\nc\nd\nE",
+			want:     "A\nb\nc\nd\nE",
+		},
+		{
+			name:     "same change on both sides",
+			base:     "a\nb\nc",
+			current:  "a\nX\nc",
+			incoming: "a\nX\nc",
+			want:     "a\nX\nc",
+		},
+		{
+			name:     "insertions at both ends",
+			base:     "m",
+			current:  "top\nm",
+			incoming: "m\nbottom",
+			want:     "top\nm\nbottom",
+		},
+		{
+			name:     "deletion and unrelated edit",
+			base:     "a\nb\nc\nd",
+			current:  "a\nc\nd",
+			incoming: "a\nb\nc\nD",
+			want:     "a\nc\nD",
+		},
+		{
+			name:     "from empty base",
+			base:     "",
+			current:  "",
+			incoming: "new",
+			want:     "new",
+		},
+		{
+			name:      "overlapping edits conflict",
+			base:      "a\nb\nc",
+			current:   "a\nmine\nc",
+			incoming:  "a\ntheirs\nc",
+			want:      "a\n<<<<<<< current\nmine\n=======\ntheirs\n>>>>>>> incoming\nc",
+			conflicts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts, err := mergeLines(tt.base, tt.current, tt.incoming)
+			if err != nil {
+				t.Fatalf("mergeLines: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("merged = %q, want %q", got, tt.want)
+			}
+			if len(conflicts) != tt.conflicts {
+				t.Errorf("got %d conflicts, want %d", len(conflicts), tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestMergeLinesConflictDetails(t *testing.T) {
+	_, conflicts, err := mergeLines("a\nb\nc", "a\nmine\nc", "a\ntheirs\nc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1", len(conflicts))
+	}
+
+	c := conflicts[0]
+	if c.Field != "content" || c.BaseStart != 2 {
+		t.Errorf("conflict at %s:%d, want content:2", c.Field, c.BaseStart)
+	}
+	if strings.Join(c.Base, ",") != "b" || strings.Join(c.Current, ",") != "mine" || strings.Join(c.Incoming, ",") != "theirs" {
+		t.Errorf("unexpected conflict %+v", c)
+	}
+}
+
+// lcsLength is the textbook dynamic programme, used as a reference.
+func lcsLength(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestMatchLinesFindsLongestCommonSubsequence(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	randomLines := func() []string {
+		lines := make([]string, rng.IntN(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.IntN(4)))
+		}
+		return lines
+	}
+
+	for i := range 2000 {
+		a, b := randomLines(), randomLines()
+		match, err := matchLines(a, b)
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+
+		matched, last := 0, -1
+		for x, y := range match {
+			if y < 0 {
+				continue
+			}
+			if y <= last || y >= len(b) || a[x] != b[y] {
+				t.Fatalf("case %d: invalid pairing %v for %q / %q", i, match, a, b)
+			}
+			last = y
+			matched++
+		}
+		if want := lcsLength(a, b); matched != want {
+			t.Fatalf("case %d: matched %d lines, LCS is %d (%q / %q)", i, matched, want, a, b)
+		}
+	}
+}
+
+func TestMatchLinesRefusesLargeDiffs(t *testing.T) {
+	a := make([]string, maxDiffDistance+10)
+	b := make([]string, maxDiffDistance+10)
+	for i := range a {
+		a[i] = fmt.Sprintf("a%d", i)
+		b[i] = fmt.Sprintf("b%d", i)
+	}
+
+	if _, err := matchLines(a, b); !errors.Is(err, errDiffTooLarge) {
+		t.Fatalf("err = %v, want errDiffTooLarge", err)
+	}
+}
+
+func TestMatchLinesBoundsMemory(t *testing.T) {
+	// Two unrelated 40 KB bodies once allocated gigabytes before giving up.
+	var a, b []string
+	for i := 0; i < 4000; i++ {
+		a = append(a, fmt.Sprintf("left %04d", i))
+		b = append(b, fmt.Sprintf("right %04d", i))
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := matchLines(a, b)
+	runtime.ReadMemStats(&after)
+
+	if !errors.Is(err, errDiffTooLarge) {
+		t.Fatalf("err = %v, want errDiffTooLarge", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+		t.Fatalf("allocated %d MB", allocated>>20)
+	}
+}
+
+func TestMatchLinesSmallEditToLongNote(t *testing.T) {
+	var a []string
+	for i := 0; i < 50000; i++ {
+		a = append(a, fmt.Sprintf("line %d", i))
+	}
+	b := append([]string(nil), a...)
+	b[25000] = "edited"
+
+	match, err := matchLines(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x, y := range match {
+		if (x == 25000) != (y < 0) {
+			t.Fatalf("line %d matched %d", x, y)
+		}
+	}
+}
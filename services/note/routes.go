@@ -1,23 +1,40 @@
 package note
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"layer-api/authz"
 	"layer-api/types"
 	"layer-api/utils"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
 
 type Handler struct {
-	store types.NoteStore
+	store          types.NoteStore
+	folderStore    types.FolderStore
+	workspaceStore types.WorkspaceStore
+	authz          *authz.Authorizer
 }
 
-func NewHandler(store types.NoteStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(
+	store types.NoteStore,
+	folderStore types.FolderStore,
+	workspaceStore types.WorkspaceStore,
+	authorizer *authz.Authorizer,
+) *Handler {
+	return &Handler{
+		store:          store,
+		folderStore:    folderStore,
+		workspaceStore: workspaceStore,
+		authz:          authorizer,
+	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
@@ -26,6 +43,9 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.Handle("/notes/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleGetNote))).Methods("GET")
 	router.Handle("/notes/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleUpdateNote))).Methods("PATCH")
 	router.Handle("/notes/{id}/archive", utils.AuthMiddleware(http.HandlerFunc(h.handleArchiveNote))).Methods("POST")
+	router.Handle("/notes/{id}/pin", utils.AuthMiddleware(http.HandlerFunc(h.handlePinNote))).Methods("POST")
+	router.Handle("/notes/{id}/pin", utils.AuthMiddleware(http.HandlerFunc(h.handleUnpinNote))).Methods("DELETE")
+	router.Handle("/notes/{id}/reorder", utils.AuthMiddleware(http.HandlerFunc(h.handleReorderNote))).Methods("POST")
 }
 
 func (h *Handler) handleCreateNote(w http.ResponseWriter, r *http.Request) {
@@ -45,6 +65,34 @@ func (h *Handler) handleCreateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if payload.FolderID != nil {
+		f, err := h.folderStore.GetFolderByID(*payload.FolderID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err != nil || f.OwnerID != userID {
+			utils.WriteError(w, http.StatusNotFound, errors.New("folder not found"))
+			return
+		}
+	}
+
+	if payload.WorkspaceID != nil {
+		m, err := h.workspaceStore.GetMember(*payload.WorkspaceID, userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, http.StatusNotFound, errors.New("workspace not found"))
+			return
+		}
+		if m.Role.Rank() < types.WorkspaceRoleMember.Rank() {
+			utils.WriteError(w, http.StatusForbidden, errors.New("viewers cannot create notes in this workspace"))
+			return
+		}
+	}
+
 	n := types.Note{
 		OwnerID: userID,
 		Title:   payload.Title,
@@ -57,12 +105,27 @@ func (h *Handler) handleCreateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if payload.FolderID != nil {
+		if err := h.folderStore.MoveNoteToFolder(id, payload.FolderID); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if payload.WorkspaceID != nil {
+		if err := h.workspaceStore.SetNoteWorkspace(id, payload.WorkspaceID, ""); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
 	created, err := h.store.GetNoteByID(id)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	w.Header().Set("ETag", noteETag(created))
 	utils.WriteJSON(w, http.StatusCreated, created)
 }
 
@@ -73,7 +136,18 @@ func (h *Handler) handleListNotes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	notes, err := h.store.ListNotesByOwner(userID)
+	query := r.URL.Query()
+	filter := types.NoteFilter{
+		MatchAnyTag:   query.Get("tagMatch") == "any",
+		IncludeShared: query.Get("shared") == "true",
+	}
+	for _, tag := range query["tag"] {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
+
+	notes, err := h.store.ListNotesByOwner(userID, filter)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -95,18 +169,27 @@ func (h *Handler) handleGetNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	n, err := h.store.GetNoteByID(id)
+	n, _, err := h.authz.Authorize(r.Context(), id, userID, authz.ActionView)
+	if err != nil {
+		authz.WriteError(w, err)
+		return
+	}
+
+	if err := h.store.RecordCollaboratorActivity(id, userID); err != nil {
+		log.Println("record collaborator activity:", err)
+	}
+
+	p, err := h.fillPosition(n, userID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteError(w, http.StatusNotFound, errors.New("note not found"))
-			return
-		}
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	if n.OwnerID != userID {
-		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("note not found"))
+	etag := noteViewETag(n, p)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
@@ -126,18 +209,9 @@ func (h *Handler) handleUpdateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	existing, err := h.store.GetNoteByID(id)
+	existing, _, err := h.authz.Authorize(r.Context(), id, userID, authz.ActionEdit)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("note not found"))
-			return
-		}
-		utils.WriteError(w, http.StatusInternalServerError, err)
-		return
-	}
-
-	if existing.OwnerID != userID {
-		utils.WriteError(w, http.StatusNotFound, errors.New("note not found"))
+		authz.WriteError(w, err)
 		return
 	}
 
@@ -156,27 +230,91 @@ func (h *Handler) handleUpdateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updated := types.Note{
-		ID:      existing.ID,
-		OwnerID: existing.OwnerID,
-		Title:   existing.Title,
-		Content: existing.Content,
+	// If-Match guards the content only, so a tag read back from GET still
+	// matches after the caller re-pins the note.
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !etagMatches(ifMatch, noteETag(existing), false) {
+		w.Header().Set("ETag", noteETag(existing))
+		utils.WriteError(w, http.StatusPreconditionFailed, errVersionConflict)
+		return
 	}
 
-	if payload.Title != nil {
-		updated.Title = *payload.Title
-	}
-	if payload.Content != nil {
-		updated.Content = *payload.Content
+	if payload.BaseVersion != nil && *payload.BaseVersion > existing.Version {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("base version is newer than the note"))
+		return
 	}
 
-	if err := h.store.UpdateNote(updated); err != nil {
+	for attempt := 0; ; attempt++ {
+		updated := types.Note{
+			ID:      existing.ID,
+			OwnerID: existing.OwnerID,
+			Title:   existing.Title,
+			Content: existing.Content,
+			Version: existing.Version,
+		}
+
+		if payload.BaseVersion != nil && *payload.BaseVersion != existing.Version {
+			merged, conflicts, err := h.mergeUpdate(existing, payload)
+			if errors.Is(err, errBaseUnavailable) {
+				w.Header().Set("ETag", noteETag(existing))
+				utils.WriteError(w, http.StatusConflict, err)
+				return
+			}
+			if err != nil {
+				writeNoteError(w, err)
+				return
+			}
+			if len(conflicts) > 0 {
+				w.Header().Set("ETag", noteETag(existing))
+				utils.WriteJSON(w, http.StatusConflict, map[string]any{
+					"error":          "note was modified concurrently and the changes overlap",
+					"baseVersion":    *payload.BaseVersion,
+					"currentVersion": existing.Version,
+					"note":           existing,
+					"conflicts":      conflicts,
+					"merged":         merged,
+				})
+				return
+			}
+			updated.Title = merged.Title
+			updated.Content = merged.Content
+		} else {
+			if payload.Title != nil {
+				updated.Title = *payload.Title
+			}
+			if payload.Content != nil {
+				updated.Content = *payload.Content
+			}
+		}
+
+		err := h.store.UpdateNote(updated)
+		if err == nil {
+			break
+		}
 		if errors.Is(err, sql.ErrNoRows) {
 			utils.WriteError(w, http.StatusNotFound, errors.New("note not found"))
 			return
 		}
-		utils.WriteError(w, http.StatusInternalServerError, err)
-		return
+		if !errors.Is(err, errVersionConflict) {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		current, getErr := h.store.GetNoteByID(id)
+		if getErr != nil {
+			writeNoteError(w, getErr)
+			return
+		}
+		if ifMatch != "" || attempt >= 2 {
+			w.Header().Set("ETag", noteETag(current))
+			utils.WriteError(w, http.StatusPreconditionFailed, errVersionConflict)
+			return
+		}
+		existing = current
+	}
+
+	if err := h.store.RecordCollaboratorActivity(id, userID); err != nil {
+		log.Println("record collaborator activity:", err)
 	}
 
 	n, err := h.store.GetNoteByID(id)
@@ -185,9 +323,59 @@ func (h *Handler) handleUpdateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", noteETag(n))
 	utils.WriteJSON(w, http.StatusOK, n)
 }
 
+// mergeUpdate replays a payload written against an older version of the note
+// on top of its current state. The title is taken whole; content is merged
+// line by line. Any overlap is reported as a conflict, and the returned note
+// then carries the content with conflict markers for the client to resolve.
+func (h *Handler) mergeUpdate(current *types.Note, payload types.UpdateNotePayload) (*types.Note, []types.MergeConflict, error) {
+	base, err := h.store.GetNoteRevision(current.ID, *payload.BaseVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errBaseUnavailable
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := &types.Note{Title: current.Title, Content: current.Content}
+	var conflicts []types.MergeConflict
+
+	if payload.Title != nil && *payload.Title != base.Title && *payload.Title != current.Title {
+		if current.Title == base.Title {
+			merged.Title = *payload.Title
+		} else {
+			conflicts = append(conflicts, types.MergeConflict{
+				Field:    "title",
+				Base:     []string{base.Title},
+				Current:  []string{current.Title},
+				Incoming: []string{*payload.Title},
+			})
+		}
+	}
+
+	if payload.Content != nil {
+		content, contentConflicts, err := mergeLines(base.Content, current.Content, *payload.Content)
+		if errors.Is(err, errDiffTooLarge) {
+			content = current.Content
+			contentConflicts = []types.MergeConflict{{
+				Field:    "content",
+				Base:     splitLines(base.Content),
+				Current:  splitLines(current.Content),
+				Incoming: splitLines(*payload.Content),
+			}}
+		} else if err != nil {
+			return nil, nil, err
+		}
+		merged.Content = content
+		conflicts = append(conflicts, contentConflicts...)
+	}
+
+	return merged, conflicts, nil
+}
+
 func (h *Handler) handleArchiveNote(w http.ResponseWriter, r *http.Request) {
 	userID, ok := utils.GetUserIDFromContext(r.Context())
 	if !ok || userID <= 0 {
@@ -201,6 +389,11 @@ func (h *Handler) handleArchiveNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, _, err := h.authz.Authorize(r.Context(), id, userID, authz.ActionArchive); err != nil {
+		authz.WriteError(w, err)
+		return
+	}
+
 	if err := h.store.ArchiveNote(id, userID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			utils.WriteError(w, http.StatusNotFound, errors.New("note not found"))
@@ -215,6 +408,183 @@ func (h *Handler) handleArchiveNote(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (h *Handler) handlePinNote(w http.ResponseWriter, r *http.Request) {
+	h.setPinned(w, r, true)
+}
+
+func (h *Handler) handleUnpinNote(w http.ResponseWriter, r *http.Request) {
+	h.setPinned(w, r, false)
+}
+
+func (h *Handler) setPinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseIDFromVars(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	n, err := h.getVisibleNote(r.Context(), id, userID)
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	if err := h.store.SetNotePinned(id, userID, pinned); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if _, err := h.fillPosition(n, userID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, n)
+}
+
+func (h *Handler) handleReorderNote(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseIDFromVars(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.ReorderNotePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.AfterID == nil && payload.BeforeID == nil {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("afterId or beforeId is required"))
+		return
+	}
+	if (payload.AfterID != nil && *payload.AfterID == id) || (payload.BeforeID != nil && *payload.BeforeID == id) {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("note cannot be ordered relative to itself"))
+		return
+	}
+
+	n, err := h.getVisibleNote(r.Context(), id, userID)
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	if err := h.store.ReorderNote(id, userID, payload.AfterID, payload.BeforeID); err != nil {
+		if errors.Is(err, errStaleOrder) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		writeNoteError(w, err)
+		return
+	}
+
+	if _, err := h.fillPosition(n, userID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, n)
+}
+
+// getVisibleNote returns a non-archived note the user may view.
+func (h *Handler) getVisibleNote(ctx context.Context, id, userID int) (*types.Note, error) {
+	n, _, err := h.authz.Authorize(ctx, id, userID, authz.ActionView)
+	if err != nil {
+		return nil, err
+	}
+	if n.IsArchived {
+		return nil, authz.ErrNotFound
+	}
+
+	return n, nil
+}
+
+// fillPosition sets the caller's pin and position on n and returns the row
+// they came from, or nil when the caller never pinned or ordered the note.
+func (h *Handler) fillPosition(n *types.Note, userID int) (*types.NotePosition, error) {
+	p, err := h.store.GetNotePosition(n.ID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n.IsPinned = p.IsPinned
+	n.Position = p.Position
+	return p, nil
+}
+
+// noteETag identifies the shared state of a note, its content version.
+func noteETag(n *types.Note) string {
+	return fmt.Sprintf(`"%d-%d"`, n.ID, n.Version)
+}
+
+// noteViewETag identifies a note as one user reads it: the content version
+// plus the time their pin or position last changed, so re-pinning or
+// reordering invalidates cached copies too.
+func noteViewETag(n *types.Note, p *types.NotePosition) string {
+	if p == nil {
+		return noteETag(n)
+	}
+	return fmt.Sprintf(`"%d-%d.%d"`, n.ID, n.Version, p.UpdatedAt.UnixMicro())
+}
+
+// contentETag strips the per-user part from an ETag made by noteViewETag,
+// leaving the noteETag it was built on.
+func contentETag(etag string) string {
+	if i := strings.IndexByte(etag, '.'); i >= 0 && strings.HasSuffix(etag, `"`) {
+		return etag[:i] + `"`
+	}
+	return etag
+}
+
+// etagMatches reports whether header, an If-Match or If-None-Match value,
+// lists etag. If-None-Match uses weak comparison, If-Match strong; If-Match
+// also accepts a noteViewETag of the same content.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag || (!weak && contentETag(candidate) == etag) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeNoteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		err = authz.ErrNotFound
+	}
+	authz.WriteError(w, err)
+}
+
 func parseIDFromVars(r *http.Request) (int, error) {
 	vars := mux.Vars(r)
 	rawID, ok := vars["id"]
@@ -0,0 +1,59 @@
+package note
+
+import (
+	"layer-api/types"
+	"testing"
+	"time"
+)
+
+func TestNoteViewETag(t *testing.T) {
+	n := &types.Note{ID: 7, Version: 3}
+	at := time.Date(2026, 1, 4, 9, 30, 0, 123456000, time.UTC)
+
+	if got := noteViewETag(n, nil); got != `"7-3"` {
+		t.Fatalf("without a position = %s, want the content tag", got)
+	}
+
+	pinned := noteViewETag(n, &types.NotePosition{IsPinned: true, UpdatedAt: at})
+	if pinned == noteETag(n) {
+		t.Fatal("view tag ignores the caller's position")
+	}
+	repinned := noteViewETag(n, &types.NotePosition{UpdatedAt: at.Add(time.Microsecond)})
+	if repinned == pinned {
+		t.Fatal("view tag unchanged after the position was updated")
+	}
+	if contentETag(pinned) != noteETag(n) {
+		t.Fatalf("contentETag(%s) = %s, want %s", pinned, contentETag(pinned), noteETag(n))
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	n := &types.Note{ID: 7, Version: 3}
+	view := noteViewETag(n, &types.NotePosition{UpdatedAt: time.Unix(1767519000, 0)})
+	stale := noteViewETag(&types.Note{ID: 7, Version: 2}, &types.NotePosition{UpdatedAt: time.Unix(1767519000, 0)})
+
+	cases := []struct {
+		name   string
+		header string
+		etag   string
+		weak   bool
+		want   bool
+	}{
+		{"if-none-match same view", view, view, true, true},
+		{"if-none-match weak view", "W/" + view, view, true, true},
+		{"if-none-match content tag against view", noteETag(n), view, true, false},
+		{"if-none-match list", `"1-1", ` + view, view, true, true},
+		{"if-none-match star", "*", view, true, true},
+		{"if-match content tag", noteETag(n), noteETag(n), false, true},
+		{"if-match view tag of current content", view, noteETag(n), false, true},
+		{"if-match view tag of older content", stale, noteETag(n), false, false},
+		{"if-match rejects weak tags", "W/" + noteETag(n), noteETag(n), false, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := etagMatches(tc.header, tc.etag, tc.weak); got != tc.want {
+				t.Fatalf("etagMatches(%s, %s, %v) = %v, want %v", tc.header, tc.etag, tc.weak, got, tc.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,17 @@ package note
 
 import (
 	"database/sql"
+	"errors"
 	"layer-api/types"
+	"layer-api/utils"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	errStaleOrder      = errors.New("neighbouring notes are out of order, refresh and retry")
+	errVersionConflict = errors.New("note has been modified since it was read")
 )
 
 type Store struct {
@@ -26,16 +36,19 @@ func (s *Store) CreateNote(note types.Note) (int, error) {
 }
 
 func (s *Store) GetNoteByID(id int) (*types.Note, error) {
-	row := s.db.QueryRow(`SELECT id, owner_id, title, content, is_archived, created_at, updated_at
+	row := s.db.QueryRow(`SELECT id, owner_id, folder_id, workspace_id, title, content, is_archived, version, created_at, updated_at
 	FROM notes WHERE id = $1 LIMIT 1`, id)
 
 	var n types.Note
 	err := row.Scan(
 		&n.ID,
 		&n.OwnerID,
+		&n.FolderID,
+		&n.WorkspaceID,
 		&n.Title,
 		&n.Content,
 		&n.IsArchived,
+		&n.Version,
 		&n.CreatedAt,
 		&n.UpdatedAt,
 	)
@@ -46,9 +59,51 @@ func (s *Store) GetNoteByID(id int) (*types.Note, error) {
 	return &n, nil
 }
 
-func (s *Store) ListNotesByOwner(ownerID int) ([]types.Note, error) {
-	rows, err := s.db.Query(`SELECT id, owner_id, title, content, is_archived, created_at, updated_at
-	FROM notes WHERE owner_id = $1 AND is_archived = FALSE ORDER BY updated_at DESC`, ownerID)
+func (s *Store) ListNotesByOwner(ownerID int, filter types.NoteFilter) ([]types.Note, error) {
+	query := `SELECT n.id, n.owner_id, n.folder_id, n.workspace_id, n.title, n.content, n.is_archived,
+	n.version, COALESCE(np.is_pinned, FALSE), COALESCE(np.position, ''), n.created_at, n.updated_at
+	FROM notes n
+	LEFT JOIN note_positions np ON np.note_id = n.id AND np.user_id = $1
+	WHERE n.is_archived = FALSE`
+	args := []any{ownerID}
+
+	if filter.IncludeShared {
+		query += ` AND (n.owner_id = $1 OR n.id IN (
+		SELECT note_id FROM note_collaborators
+		WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > NOW()))
+		OR note_workspace_role(n.id, $1) IS NOT NULL)`
+	} else {
+		query += ` AND n.owner_id = $1`
+	}
+
+	if len(filter.Tags) > 0 {
+		seen := make(map[string]bool)
+		var names []string
+		for _, t := range filter.Tags {
+			name := strings.ToLower(t)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+
+		required := len(names)
+		if filter.MatchAnyTag {
+			required = 1
+		}
+
+		query += ` AND n.id IN (
+		SELECT nt.note_id FROM note_tags nt
+		JOIN tags t ON t.id = nt.tag_id
+		WHERE t.owner_id = $1 AND LOWER(t.name) = ANY($2)
+		GROUP BY nt.note_id
+		HAVING COUNT(DISTINCT t.id) >= $3)`
+		args = append(args, pq.Array(names), required)
+	}
+
+	query += ` ORDER BY COALESCE(np.is_pinned, FALSE) DESC, np.position ASC NULLS FIRST, n.updated_at DESC`
+
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -61,9 +116,14 @@ func (s *Store) ListNotesByOwner(ownerID int) ([]types.Note, error) {
 		if err := rows.Scan(
 			&n.ID,
 			&n.OwnerID,
+			&n.FolderID,
+			&n.WorkspaceID,
 			&n.Title,
 			&n.Content,
 			&n.IsArchived,
+			&n.Version,
+			&n.IsPinned,
+			&n.Position,
 			&n.CreatedAt,
 			&n.UpdatedAt,
 		); err != nil {
@@ -79,9 +139,41 @@ func (s *Store) ListNotesByOwner(ownerID int) ([]types.Note, error) {
 	return notes, nil
 }
 
+func (s *Store) ForEachNoteByOwner(ownerID int, includeArchived bool, fn func(types.Note) error) error {
+	rows, err := s.db.Query(`SELECT id, owner_id, folder_id, workspace_id, title, content, is_archived, version, created_at, updated_at
+	FROM notes WHERE owner_id = $1 AND (is_archived = FALSE OR $2) ORDER BY id ASC`, ownerID, includeArchived)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n types.Note
+		if err := rows.Scan(
+			&n.ID,
+			&n.OwnerID,
+			&n.FolderID,
+			&n.WorkspaceID,
+			&n.Title,
+			&n.Content,
+			&n.IsArchived,
+			&n.Version,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+		); err != nil {
+			return err
+		}
+		if err := fn(n); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 func (s *Store) UpdateNote(note types.Note) error {
-	res, err := s.db.Exec(`UPDATE notes SET title = $1, content = $2, updated_at = NOW()
-	WHERE id = $3 AND owner_id = $4`, note.Title, note.Content, note.ID, note.OwnerID)
+	res, err := s.db.Exec(`UPDATE notes SET title = $1, content = $2, version = version + 1, updated_at = NOW()
+	WHERE id = $3 AND owner_id = $4 AND ($5 = 0 OR version = $5)`, note.Title, note.Content, note.ID, note.OwnerID, note.Version)
 	if err != nil {
 		return err
 	}
@@ -92,14 +184,26 @@ func (s *Store) UpdateNote(note types.Note) error {
 	}
 
 	if affected == 0 {
-		return sql.ErrNoRows
+		if note.Version == 0 {
+			return sql.ErrNoRows
+		}
+
+		var exists bool
+		if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM notes WHERE id = $1 AND owner_id = $2)`,
+			note.ID, note.OwnerID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+		return errVersionConflict
 	}
 
 	return nil
 }
 
 func (s *Store) ArchiveNote(id int, ownerID int) error {
-	res, err := s.db.Exec(`UPDATE notes SET is_archived = TRUE, updated_at = NOW() 
+	res, err := s.db.Exec(`UPDATE notes SET is_archived = TRUE, version = version + 1, updated_at = NOW()
 	WHERE id = $1 AND owner_id = $2 AND is_archived = FALSE`, id, ownerID)
 	if err != nil {
 		return err
@@ -118,7 +222,7 @@ func (s *Store) ArchiveNote(id int, ownerID int) error {
 }
 
 func (s *Store) UpdateNoteContent(id int, content string) error {
-	res, err := s.db.Exec(`UPDATE notes SET content = $1, updated_at = NOW()
+	res, err := s.db.Exec(`UPDATE notes SET content = $1, version = version + 1, updated_at = NOW()
          WHERE id = $2`,
 		content,
 		id,
@@ -138,3 +242,187 @@ func (s *Store) UpdateNoteContent(id int, content string) error {
 
 	return nil
 }
+
+// RecordCollaboratorActivity stamps the collaborator's last activity on the
+// note, at most once a minute. Owners and workspace members have no row and
+// are left alone.
+func (s *Store) RecordCollaboratorActivity(noteID, userID int) error {
+	_, err := s.db.Exec(
+		`UPDATE note_collaborators
+         SET last_active_at = NOW()
+         WHERE note_id = $1
+           AND user_id = $2
+           AND (last_active_at IS NULL OR last_active_at < NOW() - INTERVAL '1 minute')`,
+		noteID,
+		userID,
+	)
+	return err
+}
+
+func (s *Store) GetNoteRevision(noteID int, version int64) (*types.NoteRevision, error) {
+	row := s.db.QueryRow(`SELECT note_id, version, title, content, created_at
+	FROM note_revisions WHERE note_id = $1 AND version <= $2
+	ORDER BY version DESC LIMIT 1`, noteID, version)
+
+	var rev types.NoteRevision
+	err := row.Scan(
+		&rev.NoteID,
+		&rev.Version,
+		&rev.Title,
+		&rev.Content,
+		&rev.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+func (s *Store) GetNotePosition(noteID, userID int) (*types.NotePosition, error) {
+	row := s.db.QueryRow(`SELECT note_id, user_id, is_pinned, COALESCE(position, ''), updated_at
+	FROM note_positions WHERE note_id = $1 AND user_id = $2`, noteID, userID)
+
+	var p types.NotePosition
+	err := row.Scan(
+		&p.NoteID,
+		&p.UserID,
+		&p.IsPinned,
+		&p.Position,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (s *Store) SetNotePinned(noteID, userID int, pinned bool) error {
+	_, err := s.db.Exec(`INSERT INTO note_positions (user_id, note_id, is_pinned)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, note_id)
+	DO UPDATE SET is_pinned = EXCLUDED.is_pinned, updated_at = NOW()`, userID, noteID, pinned)
+	return err
+}
+
+func (s *Store) ReorderNote(noteID, userID int, afterID, beforeID *int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, userID); err != nil {
+		return err
+	}
+
+	if err := materializePositions(tx, userID); err != nil {
+		return err
+	}
+
+	after, err := positionOf(tx, afterID, userID)
+	if err != nil {
+		return err
+	}
+	before, err := positionOf(tx, beforeID, userID)
+	if err != nil {
+		return err
+	}
+
+	key, err := utils.KeyBetween(after, before)
+	if err != nil {
+		return errStaleOrder
+	}
+
+	res, err := tx.Exec(`UPDATE note_positions SET position = $1, updated_at = NOW()
+	WHERE user_id = $2 AND note_id = $3`, key, userID, noteID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// materializePositions gives every visible note without a position a key
+// ahead of the existing ones, keeping the order the list currently shows.
+func materializePositions(tx *sql.Tx, userID int) error {
+	rows, err := tx.Query(`SELECT n.id
+	FROM notes n
+	LEFT JOIN note_positions np ON np.note_id = n.id AND np.user_id = $1
+	WHERE n.is_archived = FALSE
+	  AND np.position IS NULL
+	  AND (n.owner_id = $1 OR n.id IN (SELECT note_id FROM note_collaborators
+	       WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > NOW()))
+	       OR note_workspace_role(n.id, $1) IS NOT NULL)
+	ORDER BY COALESCE(np.is_pinned, FALSE) DESC, n.updated_at DESC`, userID)
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var first string
+	if err := tx.QueryRow(`SELECT COALESCE(MIN(position), '') FROM note_positions
+	WHERE user_id = $1 AND position IS NOT NULL`, userID).Scan(&first); err != nil {
+		return err
+	}
+
+	for i := len(ids) - 1; i >= 0; i-- {
+		key, err := utils.KeyBetween("", first)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`INSERT INTO note_positions (user_id, note_id, position)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, note_id)
+		DO UPDATE SET position = EXCLUDED.position, updated_at = NOW()`, userID, ids[i], key); err != nil {
+			return err
+		}
+
+		first = key
+	}
+
+	return nil
+}
+
+func positionOf(tx *sql.Tx, noteID *int, userID int) (string, error) {
+	if noteID == nil {
+		return "", nil
+	}
+
+	var position string
+	err := tx.QueryRow(`SELECT position FROM note_positions
+	WHERE note_id = $1 AND user_id = $2 AND position IS NOT NULL`, *noteID, userID).Scan(&position)
+	if err != nil {
+		return "", err
+	}
+
+	return position, nil
+}
@@ -0,0 +1,183 @@
+package note
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"layer-api/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rowDriver answers every query with one row whose columns are read from
+// the query's own SELECT list, so a Scan with the wrong number or type of
+// destinations fails the same way it would against PostgreSQL.
+type rowDriver struct{}
+
+func (rowDriver) Open(string) (driver.Conn, error) { return rowConn{}, nil }
+
+type rowConn struct{}
+
+func (rowConn) Prepare(query string) (driver.Stmt, error) { return rowStmt{query: query}, nil }
+func (rowConn) Close() error                              { return nil }
+func (rowConn) Begin() (driver.Tx, error)                 { return nil, errors.New("transactions not supported") }
+
+type rowStmt struct{ query string }
+
+func (rowStmt) Close() error  { return nil }
+func (rowStmt) NumInput() int { return -1 }
+
+func (rowStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec not supported")
+}
+
+func (s rowStmt) Query([]driver.Value) (driver.Rows, error) {
+	columns := selectColumns(s.query)
+	values := make([]driver.Value, len(columns))
+	for i, col := range columns {
+		v, err := sampleValue(col)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return &singleRow{columns: columns, values: values}, nil
+}
+
+type singleRow struct {
+	columns []string
+	values  []driver.Value
+	done    bool
+}
+
+func (r *singleRow) Columns() []string { return r.columns }
+func (r *singleRow) Close() error      { return nil }
+
+func (r *singleRow) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+	return nil
+}
+
+// selectColumns returns the column names of the outermost SELECT list.
+func selectColumns(query string) []string {
+	upper := strings.ToUpper(query)
+	start := strings.Index(upper, "SELECT") + len("SELECT")
+
+	var columns []string
+	depth, from := 0, start
+	for i := start; i < len(query); i++ {
+		switch query[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				columns = append(columns, columnName(query[from:i]))
+				from = i + 1
+			}
+		}
+		if depth == 0 && strings.HasPrefix(upper[i:], "FROM") && isSpace(query[i-1]) {
+			columns = append(columns, columnName(query[from:i]))
+			break
+		}
+	}
+	return columns
+}
+
+func isSpace(c byte) bool { return c == ' ' || c == '\n' || c == '\t' || c == '\r' }
+
+// columnName turns "n.id" or "COALESCE(np.is_pinned, FALSE)" into the bare
+// column name.
+func columnName(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if open := strings.Index(expr, "("); open >= 0 {
+		expr = strings.SplitN(expr[open+1:], ",", 2)[0]
+	}
+	expr = strings.TrimSpace(expr)
+	if dot := strings.LastIndex(expr, "."); dot >= 0 {
+		expr = expr[dot+1:]
+	}
+	return expr
+}
+
+func sampleValue(column string) (driver.Value, error) {
+	switch column {
+	case "id", "owner_id", "version":
+		return int64(1), nil
+	case "folder_id", "workspace_id":
+		return nil, nil
+	case "title", "content", "position":
+		return "x", nil
+	case "is_archived", "is_pinned":
+		return false, nil
+	case "created_at", "updated_at":
+		return time.Now(), nil
+	default:
+		return nil, fmt.Errorf("no sample value for column %q", column)
+	}
+}
+
+func init() {
+	sql.Register("note-rows", rowDriver{})
+}
+
+func newRowStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := sql.Open("note-rows", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewStore(db)
+}
+
+func TestGetNoteByIDScansRow(t *testing.T) {
+	n, err := newRowStore(t).GetNoteByID(1)
+	if err != nil {
+		t.Fatalf("GetNoteByID: %v", err)
+	}
+	if n.ID != 1 || n.Title != "x" {
+		t.Fatalf("unexpected note %+v", n)
+	}
+}
+
+func TestListNotesByOwnerScansRow(t *testing.T) {
+	for _, filter := range []types.NoteFilter{
+		{},
+		{IncludeShared: true},
+		{Tags: []string{"a"}},
+	} {
+		notes, err := newRowStore(t).ListNotesByOwner(1, filter)
+		if err != nil {
+			t.Fatalf("ListNotesByOwner(%+v): %v", filter, err)
+		}
+		if len(notes) != 1 || notes[0].ID != 1 || notes[0].Position != "x" {
+			t.Fatalf("ListNotesByOwner(%+v) = %+v", filter, notes)
+		}
+	}
+}
+
+func TestForEachNoteByOwnerScansRow(t *testing.T) {
+	var seen int
+	err := newRowStore(t).ForEachNoteByOwner(1, true, func(n types.Note) error {
+		seen++
+		if n.ID != 1 || n.Content != "x" {
+			t.Errorf("unexpected note %+v", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachNoteByOwner: %v", err)
+	}
+	if seen != 1 {
+		t.Fatalf("callback ran %d times, want 1", seen)
+	}
+}
@@ -0,0 +1,87 @@
+package notification
+
+import (
+	"database/sql"
+	"errors"
+	"layer-api/types"
+	"layer-api/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store types.NotificationStore
+}
+
+func NewHandler(store types.NotificationStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.Handle("/notifications", utils.AuthMiddleware(http.HandlerFunc(h.handleList))).Methods("GET")
+	router.Handle("/notifications/read", utils.AuthMiddleware(http.HandlerFunc(h.handleMarkAllRead))).Methods("POST")
+	router.Handle("/notifications/{id}/read", utils.AuthMiddleware(http.HandlerFunc(h.handleMarkRead))).Methods("POST")
+}
+
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	limit := utils.AtoiSafe(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	notifications, err := h.store.ListNotifications(userID, r.URL.Query().Get("unread") == "true", limit)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, notifications)
+}
+
+func (h *Handler) handleMarkRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("invalid notification id"))
+		return
+	}
+
+	if err := h.store.MarkNotificationRead(id, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("notification not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "notification marked as read"})
+}
+
+func (h *Handler) handleMarkAllRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	if err := h.store.MarkAllNotificationsRead(userID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "notifications marked as read"})
+}
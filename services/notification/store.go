@@ -0,0 +1,99 @@
+package notification
+
+import (
+	"database/sql"
+	"encoding/json"
+	"layer-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateNotification(userID int, kind string, payload map[string]any) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO notifications (user_id, kind, payload)
+         VALUES ($1, $2, $3)`,
+		userID,
+		kind,
+		encoded,
+	)
+	return err
+}
+
+func (s *Store) ListNotifications(userID int, unreadOnly bool, limit int) ([]types.Notification, error) {
+	rows, err := s.db.Query(
+		`SELECT id, user_id, kind, payload, read_at, created_at
+         FROM notifications
+         WHERE user_id = $1
+           AND (NOT $2 OR read_at IS NULL)
+         ORDER BY created_at DESC, id DESC
+         LIMIT $3`,
+		userID,
+		unreadOnly,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []types.Notification{}
+	for rows.Next() {
+		var n types.Notification
+		var payload []byte
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &payload, &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(payload, &n.Payload); err != nil {
+			return nil, err
+		}
+		result = append(result, n)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *Store) MarkNotificationRead(id, userID int) error {
+	res, err := s.db.Exec(
+		`UPDATE notifications
+         SET read_at = COALESCE(read_at, NOW())
+         WHERE id = $1
+           AND user_id = $2`,
+		id,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *Store) MarkAllNotificationsRead(userID int) error {
+	_, err := s.db.Exec(
+		`UPDATE notifications
+         SET read_at = NOW()
+         WHERE user_id = $1
+           AND read_at IS NULL`,
+		userID,
+	)
+	return err
+}
@@ -1,9 +1,14 @@
 package realtime
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"layer-api/authz"
 	"layer-api/types"
 	"log"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -12,24 +17,32 @@ type Client struct {
 	hub       *Hub
 	conn      *websocket.Conn
 	send      chan []byte
+	done      chan struct{}
 	userID    int
 	noteID    int
+	canEdit   atomic.Bool
 	noteStore types.NoteStore
+	authz     *authz.Authorizer
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn, userID, noteID int, noteStore types.NoteStore) *Client {
-	return &Client{
+func NewClient(hub *Hub, conn *websocket.Conn, userID, noteID int, canEdit bool, noteStore types.NoteStore, authorizer *authz.Authorizer) *Client {
+	c := &Client{
 		hub:       hub,
 		conn:      conn,
 		send:      make(chan []byte, 256),
+		done:      make(chan struct{}),
 		userID:    userID,
 		noteID:    noteID,
 		noteStore: noteStore,
+		authz:     authorizer,
 	}
+	c.canEdit.Store(canEdit)
+	return c
 }
 
 func (c *Client) readPump() {
 	defer func() {
+		close(c.done)
 		c.hub.unregister <- c
 		_ = c.conn.Close()
 	}()
@@ -54,10 +67,17 @@ func (c *Client) readPump() {
 
 		switch msg.Type {
 		case types.RealtimeMessageTypePatch:
+			if !c.canEdit.Load() {
+				c.sendError("read-only access to this note")
+				continue
+			}
 			if err := c.noteStore.UpdateNoteContent(c.noteID, msg.Patch); err != nil {
 				c.sendError("failed to save note")
 				continue
 			}
+			if err := c.noteStore.RecordCollaboratorActivity(c.noteID, c.userID); err != nil {
+				log.Println("ws activity error:", err)
+			}
 
 			serverMsg := types.RealtimeServerMessage{
 				Type:    types.RealtimeMessageTypePatch,
@@ -91,6 +111,46 @@ func (c *Client) writePump() {
 	}
 }
 
+// watchAccess re-authorizes the client each time its time-limited grant
+// lapses. Clients left without access are disconnected; clients that still
+// reach the note some other way carry on with the role that remains.
+func (c *Client) watchAccess(expiresAt *time.Time) {
+	var last time.Time
+	for expiresAt != nil {
+		wait := time.Until(*expiresAt)
+		if expiresAt.Equal(last) {
+			// The database clock has not caught up with ours yet.
+			wait = time.Second
+		}
+		last = *expiresAt
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-c.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		_, access, err := c.authz.Authorize(context.Background(), c.noteID, c.userID, authz.ActionView)
+		if err != nil {
+			if !errors.Is(err, authz.ErrNotFound) {
+				log.Println("ws access check error:", err)
+			}
+			_ = c.conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "access to this note has expired"),
+				time.Now().Add(time.Second),
+			)
+			_ = c.conn.Close()
+			return
+		}
+
+		c.canEdit.Store(access.Can(authz.ActionEdit))
+		expiresAt = access.ExpiresAt
+	}
+}
+
 func (c *Client) sendError(message string) {
 	serverMsg := types.RealtimeServerMessage{
 		Type:   types.RealtimeMessageTypeError,
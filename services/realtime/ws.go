@@ -1,11 +1,12 @@
 package realtime
 
 import (
-	"database/sql"
 	"encoding/json"
 	"errors"
+	"layer-api/authz"
 	"layer-api/types"
 	"layer-api/utils"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -20,16 +21,16 @@ var upgrader = websocket.Upgrader{
 }
 
 type Handler struct {
-	hub         *Hub
-	noteStore   types.NoteStore
-	collabStore types.CollaboratorStore
+	hub       *Hub
+	noteStore types.NoteStore
+	authz     *authz.Authorizer
 }
 
-func NewHandler(hub *Hub, noteStore types.NoteStore, collabStore types.CollaboratorStore) *Handler {
+func NewHandler(hub *Hub, noteStore types.NoteStore, authorizer *authz.Authorizer) *Handler {
 	return &Handler{
-		hub:         hub,
-		noteStore:   noteStore,
-		collabStore: collabStore,
+		hub:       hub,
+		noteStore: noteStore,
+		authz:     authorizer,
 	}
 }
 
@@ -54,26 +55,15 @@ func (h *Handler) handleNoteWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	n, err := h.noteStore.GetNoteByID(noteID)
+	n, access, err := h.authz.Authorize(r.Context(), noteID, userID, authz.ActionView)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteError(w, http.StatusNotFound, errors.New("note not found"))
-			return
-		}
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		authz.WriteError(w, err)
 		return
 	}
+	canEdit := access.Can(authz.ActionEdit)
 
-	if n.OwnerID != userID {
-		okCollab, err := h.collabStore.IsCollaborator(noteID, userID)
-		if err != nil {
-			utils.WriteError(w, http.StatusInternalServerError, err)
-			return
-		}
-		if !okCollab {
-			utils.WriteError(w, http.StatusForbidden, errors.New("no access to this note"))
-			return
-		}
+	if err := h.noteStore.RecordCollaboratorActivity(noteID, userID); err != nil {
+		log.Println("ws activity error:", err)
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -81,7 +71,7 @@ func (h *Handler) handleNoteWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client := NewClient(h.hub, conn, userID, noteID, h.noteStore)
+	client := NewClient(h.hub, conn, userID, noteID, canEdit, h.noteStore, h.authz)
 	h.hub.register <- client
 
 	initMsg := types.RealtimeServerMessage{
@@ -98,4 +88,5 @@ func (h *Handler) handleNoteWS(w http.ResponseWriter, r *http.Request) {
 
 	go client.writePump()
 	go client.readPump()
+	go client.watchAccess(access.ExpiresAt)
 }
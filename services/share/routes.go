@@ -0,0 +1,310 @@
+package share
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"layer-api/authz"
+	"layer-api/services/export"
+	"layer-api/types"
+	"layer-api/utils"
+	"layer-api/verification"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store     types.ShareLinkStore
+	noteStore types.NoteStore
+	authz     *authz.Authorizer
+	verified  *verification.Policy
+}
+
+func NewHandler(store types.ShareLinkStore, noteStore types.NoteStore, authorizer *authz.Authorizer, verified *verification.Policy) *Handler {
+	return &Handler{
+		store:     store,
+		noteStore: noteStore,
+		authz:     authorizer,
+		verified:  verified,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.Handle("/notes/{id}/shares", utils.AuthMiddleware(h.verified.Require(verification.RestrictShare, http.HandlerFunc(h.handleCreate)))).Methods("POST")
+	router.Handle("/notes/{id}/shares", utils.AuthMiddleware(http.HandlerFunc(h.handleList))).Methods("GET")
+	router.Handle("/notes/{id}/shares/{shareId}", utils.AuthMiddleware(http.HandlerFunc(h.handleRevoke))).Methods("DELETE")
+
+	router.HandleFunc("/shared/{token}", h.handleOpen).Methods("GET", "POST")
+}
+
+func (h *Handler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.checkOwner(r, noteID, userID); err != nil {
+		writeOwnerError(w, err)
+		return
+	}
+
+	var payload types.CreateShareLinkPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("expiresAt must be in the future"))
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	link := types.ShareLink{
+		NoteID:    noteID,
+		CreatedBy: userID,
+		Token:     token,
+		ExpiresAt: payload.ExpiresAt,
+	}
+
+	if payload.Password != nil {
+		hash, err := utils.HashPassword(*payload.Password)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		link.PasswordHash = hash
+	}
+
+	id, err := h.store.CreateShareLink(link)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.store.GetShareLinkByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.checkOwner(r, noteID, userID); err != nil {
+		writeOwnerError(w, err)
+		return
+	}
+
+	links, err := h.store.ListShareLinks(noteID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, links)
+}
+
+func (h *Handler) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	shareID, err := parseID(r, "shareId")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.checkOwner(r, noteID, userID); err != nil {
+		writeOwnerError(w, err)
+		return
+	}
+
+	if err := h.store.DeleteShareLink(noteID, shareID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("share link not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "share link revoked"})
+}
+
+// handleOpen serves a shared note without authentication. Password-protected
+// links take the password from the X-Share-Password header or, for POST, from
+// the JSON body. Every lookup failure is reported the same way so tokens
+// cannot be probed.
+func (h *Handler) handleOpen(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+
+	link, err := h.store.GetShareLinkByToken(mux.Vars(r)["token"])
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("share link not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		utils.WriteError(w, http.StatusGone, errors.New("share link has expired"))
+		return
+	}
+
+	if link.HasPassword {
+		password := r.Header.Get("X-Share-Password")
+		if r.Method == http.MethodPost {
+			var payload types.OpenShareLinkPayload
+			if err := utils.ParseJSON(r, &payload); err != nil {
+				utils.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			password = payload.Password
+		}
+
+		if password == "" {
+			utils.WriteError(w, http.StatusUnauthorized, errors.New("password required"))
+			return
+		}
+		if !utils.CheckPassword(link.PasswordHash, password) {
+			utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid password"))
+			return
+		}
+	}
+
+	n, err := h.noteStore.GetNoteByID(link.NoteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("share link not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if n.IsArchived {
+		utils.WriteError(w, http.StatusNotFound, errors.New("share link not found"))
+		return
+	}
+
+	if err := h.store.RecordShareLinkView(link.ID); err != nil {
+		log.Printf("share: record view for link %d: %v", link.ID, err)
+	}
+
+	if !wantsHTML(r) {
+		utils.WriteJSON(w, http.StatusOK, types.SharedNote{
+			Title:     n.Title,
+			Content:   n.Content,
+			CreatedAt: n.CreatedAt,
+			UpdatedAt: n.UpdatedAt,
+		})
+		return
+	}
+
+	shared := types.Note{
+		Title:     n.Title,
+		Content:   n.Content,
+		CreatedAt: n.CreatedAt,
+		UpdatedAt: n.UpdatedAt,
+	}
+
+	w.Header().Set("Content-Type", export.FormatHTML.ContentType())
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src https: data:; style-src 'unsafe-inline'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(http.StatusOK)
+	if err := export.Write(w, export.Document{Note: shared}, export.FormatHTML); err != nil {
+		log.Printf("share: render note %d: %v", n.ID, err)
+	}
+}
+
+func (h *Handler) checkOwner(r *http.Request, noteID, userID int) error {
+	_, _, err := h.authz.Authorize(r.Context(), noteID, userID, authz.ActionShare)
+	return err
+}
+
+func writeOwnerError(w http.ResponseWriter, err error) {
+	authz.WriteError(w, err)
+}
+
+// wantsHTML prefers an explicit ?format= over the Accept header.
+func wantsHTML(r *http.Request) bool {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "html":
+		return true
+	case "json":
+		return false
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/html") && !strings.Contains(accept, "application/json")
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func parseID(r *http.Request, key string) (int, error) {
+	raw, ok := mux.Vars(r)[key]
+	if !ok || raw == "" {
+		return 0, fmt.Errorf("missing %s", key)
+	}
+
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid %s", key)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,131 @@
+package share
+
+import (
+	"database/sql"
+	"layer-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+const shareLinkColumns = `id, note_id, created_by, token, COALESCE(password_hash, ''),
+	expires_at, view_count, last_viewed_at, created_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanShareLink(row scanner) (*types.ShareLink, error) {
+	var l types.ShareLink
+	err := row.Scan(
+		&l.ID,
+		&l.NoteID,
+		&l.CreatedBy,
+		&l.Token,
+		&l.PasswordHash,
+		&l.ExpiresAt,
+		&l.ViewCount,
+		&l.LastViewedAt,
+		&l.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	l.HasPassword = l.PasswordHash != ""
+
+	return &l, nil
+}
+
+func (s *Store) CreateShareLink(link types.ShareLink) (int, error) {
+	var id int
+
+	err := s.db.QueryRow(
+		`INSERT INTO share_links (note_id, created_by, token, password_hash, expires_at)
+         VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+         RETURNING id`,
+		link.NoteID,
+		link.CreatedBy,
+		link.Token,
+		link.PasswordHash,
+		link.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetShareLinkByID(id int) (*types.ShareLink, error) {
+	return scanShareLink(s.db.QueryRow(
+		`SELECT `+shareLinkColumns+` FROM share_links WHERE id = $1`,
+		id,
+	))
+}
+
+func (s *Store) GetShareLinkByToken(token string) (*types.ShareLink, error) {
+	return scanShareLink(s.db.QueryRow(
+		`SELECT `+shareLinkColumns+` FROM share_links WHERE token = $1`,
+		token,
+	))
+}
+
+func (s *Store) ListShareLinks(noteID int) ([]types.ShareLink, error) {
+	rows, err := s.db.Query(
+		`SELECT `+shareLinkColumns+` FROM share_links
+         WHERE note_id = $1
+         ORDER BY created_at DESC, id DESC`,
+		noteID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []types.ShareLink{}
+	for rows.Next() {
+		l, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *l)
+	}
+
+	return links, rows.Err()
+}
+
+func (s *Store) DeleteShareLink(noteID, id int) error {
+	res, err := s.db.Exec(
+		`DELETE FROM share_links WHERE id = $1 AND note_id = $2`,
+		id,
+		noteID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *Store) RecordShareLinkView(id int) error {
+	_, err := s.db.Exec(
+		`UPDATE share_links
+         SET view_count = view_count + 1, last_viewed_at = NOW()
+         WHERE id = $1`,
+		id,
+	)
+	return err
+}
@@ -0,0 +1,386 @@
+package tag
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"layer-api/authz"
+	"layer-api/types"
+	"layer-api/utils"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	tagStore types.TagStore
+	authz    *authz.Authorizer
+}
+
+func NewHandler(tagStore types.TagStore, authorizer *authz.Authorizer) *Handler {
+	return &Handler{
+		tagStore: tagStore,
+		authz:    authorizer,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.Handle("/tags", utils.AuthMiddleware(http.HandlerFunc(h.handleCreateTag))).Methods("POST")
+	router.Handle("/tags", utils.AuthMiddleware(http.HandlerFunc(h.handleListTags))).Methods("GET")
+	router.Handle("/tags/merge", utils.AuthMiddleware(http.HandlerFunc(h.handleMergeTags))).Methods("POST")
+	router.Handle("/tags/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleUpdateTag))).Methods("PATCH")
+	router.Handle("/tags/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleDeleteTag))).Methods("DELETE")
+
+	router.Handle("/notes/{id}/tags", utils.AuthMiddleware(http.HandlerFunc(h.handleListNoteTags))).Methods("GET")
+	router.Handle("/notes/{id}/tags", utils.AuthMiddleware(http.HandlerFunc(h.handleAttachTag))).Methods("POST")
+	router.Handle("/notes/{id}/tags/{tagId}", utils.AuthMiddleware(http.HandlerFunc(h.handleDetachTag))).Methods("DELETE")
+}
+
+func (h *Handler) handleCreateTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	var payload types.CreateTagPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if existing, err := h.tagStore.GetTagByName(userID, payload.Name); err == nil && existing != nil {
+		utils.WriteError(w, http.StatusConflict, errors.New("tag already exists"))
+		return
+	}
+
+	id, err := h.tagStore.CreateTag(types.Tag{
+		OwnerID: userID,
+		Name:    payload.Name,
+		Color:   strings.ToLower(payload.Color),
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.tagStore.GetTagByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) handleListTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	tags, err := h.tagStore.ListTagsByOwner(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, tags)
+}
+
+func (h *Handler) handleUpdateTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	existing, err := h.getOwnedTag(id, userID)
+	if err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	var payload types.UpdateTagPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if payload.Name != nil {
+		trimmed := strings.TrimSpace(*payload.Name)
+		payload.Name = &trimmed
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.Name == nil && payload.Color == nil {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("no fields to update"))
+		return
+	}
+
+	updated := *existing
+	if payload.Name != nil {
+		other, err := h.tagStore.GetTagByName(userID, *payload.Name)
+		if err == nil && other.ID != existing.ID {
+			utils.WriteError(w, http.StatusConflict, errors.New("tag with this name already exists, merge instead"))
+			return
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		updated.Name = *payload.Name
+	}
+	if payload.Color != nil {
+		updated.Color = strings.ToLower(*payload.Color)
+	}
+
+	if err := h.tagStore.UpdateTag(updated); err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	t, err := h.tagStore.GetTagByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, t)
+}
+
+func (h *Handler) handleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.tagStore.DeleteTag(id, userID); err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "tag deleted"})
+}
+
+func (h *Handler) handleMergeTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	var payload types.MergeTagsPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	seen := map[int]bool{payload.TargetID: true}
+	var sourceIDs []int
+	for _, id := range payload.SourceIDs {
+		if !seen[id] {
+			seen[id] = true
+			sourceIDs = append(sourceIDs, id)
+		}
+	}
+	if len(sourceIDs) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("no source tags to merge"))
+		return
+	}
+
+	if err := h.tagStore.MergeTags(userID, sourceIDs, payload.TargetID); err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	t, err := h.tagStore.GetTagByID(payload.TargetID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, t)
+}
+
+func (h *Handler) handleListNoteTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.checkNoteAccess(r, noteID, userID); err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	tags, err := h.tagStore.ListTagsByNote(noteID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, tags)
+}
+
+func (h *Handler) handleAttachTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.checkNoteAccess(r, noteID, userID); err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	var payload types.AttachTagPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.getOwnedTag(payload.TagID, userID); err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	if err := h.tagStore.AttachTag(noteID, payload.TagID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "tag attached"})
+}
+
+func (h *Handler) handleDetachTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tagID, err := parseID(r, "tagId")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.checkNoteAccess(r, noteID, userID); err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	if _, err := h.getOwnedTag(tagID, userID); err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	if err := h.tagStore.DetachTag(noteID, tagID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("tag is not attached to this note"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "tag detached"})
+}
+
+func (h *Handler) getOwnedTag(id, userID int) (*types.Tag, error) {
+	t, err := h.tagStore.GetTagByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.OwnerID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+func (h *Handler) checkNoteAccess(r *http.Request, noteID, userID int) error {
+	_, _, err := h.authz.Authorize(r.Context(), noteID, userID, authz.ActionView)
+	return err
+}
+
+func writeTagError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, errors.New("tag not found"))
+		return
+	}
+	utils.WriteError(w, http.StatusInternalServerError, err)
+}
+
+func writeNoteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		err = authz.ErrNotFound
+	}
+	authz.WriteError(w, err)
+}
+
+func parseID(r *http.Request, key string) (int, error) {
+	vars := mux.Vars(r)
+	raw, ok := vars[key]
+	if !ok || raw == "" {
+		return 0, fmt.Errorf("missing id")
+	}
+
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid id")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,288 @@
+package tag
+
+import (
+	"database/sql"
+	"layer-api/types"
+
+	"github.com/lib/pq"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateTag(tag types.Tag) (int, error) {
+	var id int
+
+	err := s.db.QueryRow(
+		`INSERT INTO tags (owner_id, name, color)
+         VALUES ($1, $2, COALESCE(NULLIF($3, ''), '#9ca3af'))
+         RETURNING id`,
+		tag.OwnerID,
+		tag.Name,
+		tag.Color,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetTagByID(id int) (*types.Tag, error) {
+	row := s.db.QueryRow(
+		`SELECT t.id, t.owner_id, t.name, t.color,
+                (SELECT COUNT(*) FROM note_tags nt WHERE nt.tag_id = t.id),
+                t.created_at, t.updated_at
+         FROM tags t
+         WHERE t.id = $1
+         LIMIT 1`,
+		id,
+	)
+
+	return scanTag(row)
+}
+
+func (s *Store) GetTagByName(ownerID int, name string) (*types.Tag, error) {
+	row := s.db.QueryRow(
+		`SELECT t.id, t.owner_id, t.name, t.color,
+                (SELECT COUNT(*) FROM note_tags nt WHERE nt.tag_id = t.id),
+                t.created_at, t.updated_at
+         FROM tags t
+         WHERE t.owner_id = $1
+           AND LOWER(t.name) = LOWER($2)
+         LIMIT 1`,
+		ownerID,
+		name,
+	)
+
+	return scanTag(row)
+}
+
+func (s *Store) ListTagsByOwner(ownerID int) ([]types.Tag, error) {
+	rows, err := s.db.Query(
+		`SELECT t.id, t.owner_id, t.name, t.color, COUNT(nt.note_id),
+                t.created_at, t.updated_at
+         FROM tags t
+         LEFT JOIN note_tags nt ON nt.tag_id = t.id
+         WHERE t.owner_id = $1
+         GROUP BY t.id
+         ORDER BY LOWER(t.name) ASC`,
+		ownerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTags(rows)
+}
+
+func (s *Store) UpdateTag(tag types.Tag) error {
+	res, err := s.db.Exec(
+		`UPDATE tags SET name = $1, color = $2, updated_at = NOW()
+         WHERE id = $3 AND owner_id = $4`,
+		tag.Name,
+		tag.Color,
+		tag.ID,
+		tag.OwnerID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *Store) DeleteTag(id int, ownerID int) error {
+	res, err := s.db.Exec(
+		`DELETE FROM tags
+         WHERE id = $1
+           AND owner_id = $2`,
+		id,
+		ownerID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *Store) MergeTags(ownerID int, sourceIDs []int, targetID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var matched int
+	err = tx.QueryRow(
+		`SELECT COUNT(*)
+         FROM tags
+         WHERE owner_id = $1
+           AND (id = ANY($2) OR id = $3)`,
+		ownerID,
+		pq.Array(sourceIDs),
+		targetID,
+	).Scan(&matched)
+	if err != nil {
+		return err
+	}
+	if matched != len(sourceIDs)+1 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO note_tags (note_id, tag_id)
+         SELECT DISTINCT note_id, $1
+         FROM note_tags
+         WHERE tag_id = ANY($2)
+         ON CONFLICT (note_id, tag_id) DO NOTHING`,
+		targetID,
+		pq.Array(sourceIDs),
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`DELETE FROM tags
+         WHERE owner_id = $1
+           AND id = ANY($2)`,
+		ownerID,
+		pq.Array(sourceIDs),
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE tags SET updated_at = NOW() WHERE id = $1`,
+		targetID,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) AttachTag(noteID, tagID int) error {
+	_, err := s.db.Exec(
+		`INSERT INTO note_tags (note_id, tag_id)
+         VALUES ($1, $2)
+         ON CONFLICT (note_id, tag_id) DO NOTHING`,
+		noteID,
+		tagID,
+	)
+	return err
+}
+
+func (s *Store) DetachTag(noteID, tagID int) error {
+	res, err := s.db.Exec(
+		`DELETE FROM note_tags
+         WHERE note_id = $1
+           AND tag_id = $2`,
+		noteID,
+		tagID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *Store) ListTagsByNote(noteID, ownerID int) ([]types.Tag, error) {
+	rows, err := s.db.Query(
+		`SELECT t.id, t.owner_id, t.name, t.color,
+                (SELECT COUNT(*) FROM note_tags c WHERE c.tag_id = t.id),
+                t.created_at, t.updated_at
+         FROM tags t
+         JOIN note_tags nt ON nt.tag_id = t.id
+         WHERE nt.note_id = $1
+           AND t.owner_id = $2
+         ORDER BY LOWER(t.name) ASC`,
+		noteID,
+		ownerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTags(rows)
+}
+
+func scanTag(row *sql.Row) (*types.Tag, error) {
+	var t types.Tag
+	err := row.Scan(
+		&t.ID,
+		&t.OwnerID,
+		&t.Name,
+		&t.Color,
+		&t.NoteCount,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func scanTags(rows *sql.Rows) ([]types.Tag, error) {
+	var result []types.Tag
+
+	for rows.Next() {
+		var t types.Tag
+		if err := rows.Scan(
+			&t.ID,
+			&t.OwnerID,
+			&t.Name,
+			&t.Color,
+			&t.NoteCount,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
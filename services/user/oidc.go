@@ -0,0 +1,400 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"layer-api/oidc"
+	"layer-api/types"
+	"layer-api/utils"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// oidcStateTTL is how long a user has to finish signing in at the provider.
+const oidcStateTTL = 10 * time.Minute
+
+func (h *Handler) HandleListProviders(w http.ResponseWriter, r *http.Request) {
+	providers := make([]map[string]string, 0, len(h.providers))
+	for _, p := range h.providers {
+		providers = append(providers, map[string]string{
+			"name":        p.Name,
+			"displayName": p.DisplayName,
+		})
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i]["name"] < providers[j]["name"] })
+
+	utils.WriteJSON(w, http.StatusOK, providers)
+}
+
+// HandleStartOIDC begins a provider login and returns the URL to send the
+// browser to. The provider redirects back to the app, which then posts the
+// code and state to HandleOIDCCallback.
+func (h *Handler) HandleStartOIDC(w http.ResponseWriter, r *http.Request) {
+	h.startOIDC(w, r, nil)
+}
+
+// HandleStartOIDCLink is HandleStartOIDC for attaching a provider account
+// to the signed-in user instead of logging in. The redirect is finished by
+// HandleOIDCLinkCallback.
+func (h *Handler) HandleStartOIDCLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	h.startOIDC(w, r, &userID)
+}
+
+func (h *Handler) startOIDC(w http.ResponseWriter, r *http.Request, linkUserID *int) {
+	provider, ok := h.providers[mux.Vars(r)["provider"]]
+	if !ok {
+		utils.WriteError(w, http.StatusNotFound, errors.New("unknown identity provider"))
+		return
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), h.oidcRedirectURL, state, nonce, challenge)
+	if err != nil {
+		log.Println("oidc start error:", err)
+		utils.WriteError(w, http.StatusBadGateway, errors.New("identity provider is unavailable"))
+		return
+	}
+
+	loginState := types.OIDCLoginState{
+		Provider:     provider.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		RedirectURI:  h.oidcRedirectURL,
+		LinkUserID:   linkUserID,
+	}
+	if err := h.identities.CreateOIDCLoginState(hashToken(state), loginState, time.Now().Add(oidcStateTTL)); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"authorizationUrl": authURL,
+		"state":            state,
+	})
+}
+
+// HandleOIDCCallback finishes a provider login: as the linked user, as an
+// existing user whose verified email matches, or as a newly registered user.
+func (h *Handler) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, claims, ok := h.finishOIDC(w, r, nil)
+	if !ok {
+		return
+	}
+
+	identity := types.Identity{
+		Provider: provider.Name,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	existing, err := h.identities.GetIdentity(provider.Name, claims.Subject)
+	if err == nil {
+		if err := h.identities.RecordIdentityLogin(existing.ID); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		h.completeLogin(w, r, existing.UserID)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if claims.Email == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s did not share an email address", provider.DisplayName))
+		return
+	}
+
+	u, err := h.store.GetUserByEmail(claims.Email)
+	switch {
+	case err == nil:
+		// Only link when both sides have proven the address; otherwise
+		// whoever registered it first here could be handed the account.
+		if !claims.IsEmailVerified() || u.EmailVerifiedAt == nil {
+			utils.WriteError(w, http.StatusConflict, fmt.Errorf(
+				"an account with this email already exists; log in and link %s from your account", provider.DisplayName,
+			))
+			return
+		}
+
+		identity.UserID = u.ID
+		linked, err := h.identities.LinkIdentity(identity)
+		if err != nil {
+			if errors.Is(err, errIdentityLinked) {
+				utils.WriteError(w, http.StatusConflict, err)
+				return
+			}
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err := h.identities.RecordIdentityLogin(linked.ID); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		h.completeLogin(w, r, u.ID)
+
+	case errors.Is(err, sql.ErrNoRows):
+		h.registerFromIdentity(w, r, claims, identity)
+
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// HandleOIDCLinkCallback finishes a redirect started by HandleStartOIDCLink.
+// Only the user who started the link may finish it; otherwise someone could
+// send their own authorization URL to a victim and have the victim's
+// provider account bound to theirs.
+func (h *Handler) HandleOIDCLinkCallback(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	provider, claims, ok := h.finishOIDC(w, r, &userID)
+	if !ok {
+		return
+	}
+
+	linked, err := h.identities.LinkIdentity(types.Identity{
+		UserID:   userID,
+		Provider: provider.Name,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		if errors.Is(err, errIdentityLinked) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, linked)
+}
+
+// finishOIDC consumes the callback's state and redeems its code. linkUserID
+// is the signed-in caller when finishing a link and must match the user who
+// started it; logins only accept states that were not started for a link.
+func (h *Handler) finishOIDC(w http.ResponseWriter, r *http.Request, linkUserID *int) (*oidc.Provider, *oidc.Claims, bool) {
+	var payload types.OIDCCallbackPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+
+	providerName := mux.Vars(r)["provider"]
+	provider, ok := h.providers[providerName]
+	if !ok {
+		utils.WriteError(w, http.StatusNotFound, errors.New("unknown identity provider"))
+		return nil, nil, false
+	}
+
+	state, err := h.identities.ConsumeOIDCLoginState(hashToken(payload.State))
+	if err == nil && state.Provider != providerName {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid or expired login state"))
+			return nil, nil, false
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, nil, false
+	}
+
+	switch {
+	case linkUserID == nil && state.LinkUserID != nil:
+		utils.WriteError(w, http.StatusBadRequest, errors.New("this sign-in was started to link an account; finish it from that account"))
+		return nil, nil, false
+	case linkUserID != nil && (state.LinkUserID == nil || *state.LinkUserID != *linkUserID):
+		utils.WriteError(w, http.StatusForbidden, errors.New("this link was started by a different account"))
+		return nil, nil, false
+	}
+
+	claims, err := provider.Exchange(r.Context(), state.RedirectURI, payload.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Println("oidc callback error:", err)
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("could not sign in with %s", provider.DisplayName))
+		return nil, nil, false
+	}
+
+	return provider, claims, true
+}
+
+// registerFromIdentity creates an account for someone signing in through a
+// provider for the first time.
+func (h *Handler) registerFromIdentity(w http.ResponseWriter, r *http.Request, claims *oidc.Claims, identity types.Identity) {
+	username, err := h.availableUsername(claims)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	user := types.User{
+		Username: username,
+		Email:    claims.Email,
+	}
+	if claims.IsEmailVerified() {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	userID, err := h.identities.CreateUserWithIdentity(user, identity)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	user.ID = userID
+
+	if user.EmailVerifiedAt == nil {
+		if err := h.sendVerification(&user); err != nil {
+			log.Println("verification mail error:", err)
+		}
+	}
+
+	h.completeLogin(w, r, userID)
+}
+
+// availableUsername derives a username from the provider's claims, adding
+// a numeric suffix when it is taken.
+func (h *Handler) availableUsername(claims *oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	base = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return -1
+		}
+	}, base)
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	for len(base) < 3 {
+		base += "user"
+	}
+
+	candidate := base
+	for range 10 {
+		_, err := h.store.GetUserByUsername(candidate)
+		if errors.Is(err, sql.ErrNoRows) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = base + strconv.Itoa(1000+rand.IntN(9000))
+	}
+
+	return "", errors.New("could not find a free username")
+}
+
+func (h *Handler) HandleListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	identities, err := h.identities.ListIdentities(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, identities)
+}
+
+// HandleUnlinkIdentity removes a linked provider account, unless it is the
+// only way left to sign in.
+func (h *Handler) HandleUnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("invalid identity id"))
+		return
+	}
+
+	u, err := h.store.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if u.Password == "" {
+		identities, err := h.identities.ListIdentities(userID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if len(identities) <= 1 {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("set a password before unlinking your only sign-in method"))
+			return
+		}
+	}
+
+	if err := h.identities.UnlinkIdentity(userID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("identity not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "identity unlinked"})
+}
@@ -0,0 +1,188 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"layer-api/types"
+	"layer-api/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const passwordResetTTL = time.Hour
+
+// HandleChangePassword sets a new password for the signed-in user. Every
+// existing session is revoked and the caller gets a fresh one, so other
+// devices have to sign in again.
+func (h *Handler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	var payload types.ChangePasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.store.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !utils.CheckPassword(u.Password, payload.CurrentPassword) {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("current password is incorrect"))
+		return
+	}
+
+	hashed, err := utils.HashPassword(payload.NewPassword)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.store.UpdatePassword(userID, hashed); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if _, err := h.revokeAllSessions(userID, "password_change"); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	accessToken, refreshToken, err := h.startSession(r, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"message":      "password changed",
+		"accessToken":  accessToken,
+		"refreshToken": refreshToken,
+	})
+}
+
+// HandleForgotPassword emails a reset link, at most one a minute per
+// account. The response is the same whether or not the address belongs to
+// an account, and the token is issued and mailed in the background so
+// response times do not give it away either.
+func (h *Handler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ForgotPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response := map[string]any{"message": "if the email is registered, a reset link has been sent"}
+
+	u, err := h.store.GetUserByEmail(payload.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteJSON(w, http.StatusAccepted, response)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	go h.sendPasswordReset(*u)
+
+	utils.WriteJSON(w, http.StatusAccepted, response)
+}
+
+// sendPasswordReset issues a reset token for u and mails it. A request
+// within a minute of the last one is dropped quietly, since telling the
+// caller would reveal that the account exists.
+func (h *Handler) sendPasswordReset(u types.User) {
+	token, err := newOpaqueToken(32)
+	if err != nil {
+		log.Println("password reset token error:", err)
+		return
+	}
+
+	if err := h.resets.CreatePasswordReset(u.ID, hashToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+		if !errors.Is(err, errResetRecentlySent) {
+			log.Println("password reset token error:", err)
+		}
+		return
+	}
+
+	msg := types.EmailMessage{
+		To:      u.Email,
+		Subject: "Reset your Layer password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to reset the password for your Layer account. "+
+				"Use the link below within the next hour to choose a new one:\n\n%s\n\n"+
+				"If this wasn't you, you can ignore this email.\n",
+			u.Username,
+			h.appLink("/reset-password", token),
+		),
+	}
+	if err := h.mailer.Send(msg); err != nil {
+		log.Println("password reset mail error:", err)
+	}
+}
+
+// HandleResetPassword redeems a token from HandleForgotPassword. Tokens work
+// once, and all of the account's sessions are revoked afterwards.
+func (h *Handler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ResetPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	hashed, err := utils.HashPassword(payload.NewPassword)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	userID, err := h.resets.ResetPassword(hashToken(payload.Token), hashed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid or expired reset token"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if _, err := h.revokeAllSessions(userID, "password_reset"); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "password has been reset"})
+}
+
+// appLink builds a link into the web app carrying token as a query
+// parameter.
+func (h *Handler) appLink(path, token string) string {
+	return strings.TrimRight(h.appURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
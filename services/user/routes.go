@@ -3,28 +3,83 @@ package user
 import (
 	"database/sql"
 	"errors"
+	"layer-api/oidc"
 	"layer-api/types"
 	"layer-api/utils"
+	"log"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type Handler struct {
-	store types.UserStore
+	store      types.UserStore
+	sessions   types.SessionStore
+	resets     types.PasswordResetStore
+	verifier   types.EmailVerificationStore
+	twoFactor  types.TwoFactorStore
+	identities types.IdentityStore
+	mailer     types.Mailer
+	appURL     string
+
+	providers       map[string]*oidc.Provider
+	oidcRedirectURL string
 }
 
-func NewHandler(store types.UserStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(
+	store types.UserStore,
+	sessions types.SessionStore,
+	resets types.PasswordResetStore,
+	verifier types.EmailVerificationStore,
+	twoFactor types.TwoFactorStore,
+	identities types.IdentityStore,
+	mailer types.Mailer,
+	appURL string,
+	providers map[string]*oidc.Provider,
+	oidcRedirectURL string,
+) *Handler {
+	return &Handler{
+		store:           store,
+		sessions:        sessions,
+		resets:          resets,
+		verifier:        verifier,
+		twoFactor:       twoFactor,
+		identities:      identities,
+		mailer:          mailer,
+		appURL:          appURL,
+		providers:       providers,
+		oidcRedirectURL: oidcRedirectURL,
+	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/register", h.HandleRegister).Methods("POST")
 	router.HandleFunc("/login", h.HandleLogin).Methods("POST")
+	router.HandleFunc("/login/2fa", h.HandleLoginTwoFactor).Methods("POST")
 	router.HandleFunc("/refresh", h.HandleRefresh).Methods("POST")
+	router.HandleFunc("/auth/providers", h.HandleListProviders).Methods("GET")
+	router.HandleFunc("/auth/oidc/{provider}/start", h.HandleStartOIDC).Methods("POST")
+	router.HandleFunc("/auth/oidc/{provider}/callback", h.HandleOIDCCallback).Methods("POST")
+	router.HandleFunc("/password/forgot", h.HandleForgotPassword).Methods("POST")
+	router.HandleFunc("/password/reset", h.HandleResetPassword).Methods("POST")
+	router.HandleFunc("/email/verify", h.HandleVerifyEmail).Methods("POST")
 
 	router.Handle("/me", utils.AuthMiddleware(http.HandlerFunc(h.HandleMe))).Methods("GET")
+	router.Handle("/email/verify/resend", utils.AuthMiddleware(http.HandlerFunc(h.HandleResendVerification))).Methods("POST")
+	router.Handle("/auth/oidc/{provider}/link", utils.AuthMiddleware(http.HandlerFunc(h.HandleStartOIDCLink))).Methods("POST")
+	router.Handle("/auth/oidc/{provider}/link/callback", utils.AuthMiddleware(http.HandlerFunc(h.HandleOIDCLinkCallback))).Methods("POST")
+	router.Handle("/identities", utils.AuthMiddleware(http.HandlerFunc(h.HandleListIdentities))).Methods("GET")
+	router.Handle("/identities/{id}", utils.AuthMiddleware(http.HandlerFunc(h.HandleUnlinkIdentity))).Methods("DELETE")
+	router.Handle("/2fa", utils.AuthMiddleware(http.HandlerFunc(h.HandleTwoFactorStatus))).Methods("GET")
+	router.Handle("/2fa/enroll", utils.AuthMiddleware(http.HandlerFunc(h.HandleEnrollTwoFactor))).Methods("POST")
+	router.Handle("/2fa/confirm", utils.AuthMiddleware(http.HandlerFunc(h.HandleConfirmTwoFactor))).Methods("POST")
+	router.Handle("/2fa/disable", utils.AuthMiddleware(http.HandlerFunc(h.HandleDisableTwoFactor))).Methods("POST")
+	router.Handle("/password", utils.AuthMiddleware(http.HandlerFunc(h.HandleChangePassword))).Methods("POST")
+	router.Handle("/logout", utils.AuthMiddleware(http.HandlerFunc(h.HandleLogout))).Methods("POST")
+	router.Handle("/logout-all", utils.AuthMiddleware(http.HandlerFunc(h.HandleLogoutAll))).Methods("POST")
+	router.Handle("/sessions", utils.AuthMiddleware(http.HandlerFunc(h.HandleListSessions))).Methods("GET")
+	router.Handle("/sessions/{id}", utils.AuthMiddleware(http.HandlerFunc(h.HandleRevokeSession))).Methods("DELETE")
 }
 
 func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
@@ -65,14 +120,13 @@ func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+	user.ID = userID
 
-	accessToken, err := utils.GenerateAccessToken(userID)
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
-		return
+	if err := h.sendVerification(&user); err != nil {
+		log.Println("verification mail error:", err)
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(userID)
+	accessToken, refreshToken, err := h.startSession(r, userID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -112,23 +166,7 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, err := utils.GenerateAccessToken(u.ID)
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
-		return
-	}
-
-	refreshToken, err := utils.GenerateRefreshToken(u.ID)
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
-		return
-	}
-
-	utils.WriteJSON(w, http.StatusOK, map[string]any{
-		"message":      "login successfully",
-		"accessToken":  accessToken,
-		"refreshToken": refreshToken,
-	})
+	h.completeLogin(w, r, u.ID)
 }
 
 func (h *Handler) HandleRefresh(w http.ResponseWriter, r *http.Request) {
@@ -142,24 +180,37 @@ func (h *Handler) HandleRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims, err := utils.ParseToken(payload.RefreshToken)
+	newRefreshToken, err := newOpaqueToken(32)
 	if err != nil {
-		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid or expired token"))
-		return
-	}
-
-	if claims.TokenType != "refresh" {
-		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token type"))
+		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	userID, err := strconv.Atoi(claims.Subject)
-	if err != nil || userID <= 0 {
-		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token subject"))
+	session, err := h.sessions.RotateRefreshToken(
+		hashToken(payload.RefreshToken),
+		hashToken(newRefreshToken),
+		time.Now().Add(utils.RefreshTokenTTL),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid or expired token"))
+		case errors.Is(err, errRefreshTokenReused):
+			// Cut off access tokens already minted for the session here
+			// rather than waiting for the revocation sync to catch up.
+			if session != nil && session.RevokedAt != nil {
+				utils.RevokeSession(session.ID, *session.RevokedAt)
+			}
+			utils.WriteError(w, http.StatusUnauthorized, err)
+		case errors.Is(err, errSessionRevoked), errors.Is(err, errSessionExpired):
+			utils.WriteError(w, http.StatusUnauthorized, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
 		return
 	}
 
-	if _, err := h.store.GetUserByID(userID); err != nil {
+	if _, err := h.store.GetUserByID(session.UserID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			utils.WriteError(w, http.StatusNotFound, errors.New("user not found"))
 			return
@@ -168,13 +219,7 @@ func (h *Handler) HandleRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newAccessToken, err := utils.GenerateAccessToken(userID)
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
-		return
-	}
-
-	newRefreshToken, err := utils.GenerateRefreshToken(userID)
+	newAccessToken, err := utils.GenerateAccessToken(session.UserID, session.ID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
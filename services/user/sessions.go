@@ -0,0 +1,195 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"layer-api/types"
+	"layer-api/utils"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// startSession opens a session for a freshly authenticated user and returns
+// its first access and refresh tokens.
+func (h *Handler) startSession(r *http.Request, userID int) (string, string, error) {
+	sessionID, err := newOpaqueToken(24)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := newOpaqueToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	session := types.Session{
+		ID:        sessionID,
+		UserID:    userID,
+		UserAgent: r.UserAgent(),
+		IPAddress: clientIP(r),
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+	}
+	if err := h.sessions.CreateSession(session, hashToken(refreshToken)); err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := utils.GenerateAccessToken(userID, sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	sessionID, ok := utils.GetSessionIDFromContext(r.Context())
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("token is not bound to a session"))
+		return
+	}
+
+	h.revokeSession(w, userID, sessionID, "logged out")
+}
+
+func (h *Handler) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	revoked, err := h.revokeAllSessions(userID, "logout_all")
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"message": "logged out of all sessions",
+		"revoked": len(revoked),
+	})
+}
+
+func (h *Handler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	sessions, err := h.sessions.ListActiveSessions(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	current, _ := utils.GetSessionIDFromContext(r.Context())
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	utils.WriteJSON(w, http.StatusOK, sessions)
+}
+
+func (h *Handler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	h.revokeSession(w, userID, mux.Vars(r)["id"], "session revoked")
+}
+
+func (h *Handler) revokeSession(w http.ResponseWriter, userID int, sessionID, message string) {
+	revokedAt, err := h.sessions.RevokeSession(userID, sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("session not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.RevokeSession(sessionID, revokedAt)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": message})
+}
+
+// revokeAllSessions ends every session userID has, both in the database and
+// in this instance's revocation list.
+func (h *Handler) revokeAllSessions(userID int, reason string) ([]types.Session, error) {
+	revoked, err := h.sessions.RevokeAllSessions(userID, reason)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range revoked {
+		utils.RevokeSession(session.ID, *session.RevokedAt)
+	}
+	return revoked, nil
+}
+
+// RunRevocationSync copies session revocations from the database into the
+// in-memory list AuthMiddleware checks, so sessions revoked by another
+// instance or by refresh token reuse stop working within one interval.
+//
+// revoked_at is stamped before the revoking transaction commits, so a row
+// can show up after newer ones were already read. The cursor therefore
+// stays one interval behind the newest revocation seen; reapplying a
+// revocation is harmless.
+func RunRevocationSync(store types.SessionStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	since := time.Now().Add(-utils.AccessTokenTTL)
+	for {
+		revoked, err := store.ListRevokedSessions(since)
+		if err != nil {
+			log.Println("session revocation sync error:", err)
+		}
+		for _, session := range revoked {
+			utils.RevokeSession(session.ID, *session.RevokedAt)
+			if next := session.RevokedAt.Add(-interval); next.After(since) {
+				since = next
+			}
+		}
+		<-ticker.C
+	}
+}
+
+func newOpaqueToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken is how refresh tokens are stored, so a database leak does not
+// hand out live sessions.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -2,7 +2,21 @@ package user
 
 import (
 	"database/sql"
+	"errors"
 	"layer-api/types"
+	"time"
+)
+
+var (
+	errVerificationRecentlySent = errors.New("a verification email was sent recently; try again in a minute")
+	errResetRecentlySent        = errors.New("a password reset email was sent recently")
+	errTwoFactorEnabled         = errors.New("two-factor authentication is already enabled")
+	errTwoFactorNotPending      = errors.New("start enrolment before confirming two-factor authentication")
+	errIdentityLinked           = errors.New("this external account is already linked")
+
+	errSessionRevoked     = errors.New("session has been revoked")
+	errSessionExpired     = errors.New("session has expired")
+	errRefreshTokenReused = errors.New("refresh token was already used; session revoked")
 )
 
 type Store struct {
@@ -32,7 +46,7 @@ func (s *Store) CreateUser(user types.User) (int, error) {
 
 func (s *Store) GetUserByEmail(email string) (*types.User, error) {
 	row := s.db.QueryRow(
-		`SELECT id, username, email, password, created_at
+		`SELECT id, username, email, password, email_verified_at, created_at
          FROM users
          WHERE email = $1
          LIMIT 1`,
@@ -45,6 +59,7 @@ func (s *Store) GetUserByEmail(email string) (*types.User, error) {
 		&u.Username,
 		&u.Email,
 		&u.Password,
+		&u.EmailVerifiedAt,
 		&u.CreatedAt,
 	)
 	if err != nil {
@@ -56,7 +71,7 @@ func (s *Store) GetUserByEmail(email string) (*types.User, error) {
 
 func (s *Store) GetUserByUsername(username string) (*types.User, error) {
 	row := s.db.QueryRow(
-		`SELECT id, username, email, password, created_at
+		`SELECT id, username, email, password, email_verified_at, created_at
          FROM users
          WHERE username = $1
          LIMIT 1`,
@@ -69,6 +84,7 @@ func (s *Store) GetUserByUsername(username string) (*types.User, error) {
 		&u.Username,
 		&u.Email,
 		&u.Password,
+		&u.EmailVerifiedAt,
 		&u.CreatedAt,
 	)
 	if err != nil {
@@ -80,7 +96,7 @@ func (s *Store) GetUserByUsername(username string) (*types.User, error) {
 
 func (s *Store) GetUserByID(id int) (*types.User, error) {
 	row := s.db.QueryRow(
-		`SELECT id, username, email, password, created_at
+		`SELECT id, username, email, password, email_verified_at, created_at
          FROM users
          WHERE id = $1
          LIMIT 1`,
@@ -93,6 +109,7 @@ func (s *Store) GetUserByID(id int) (*types.User, error) {
 		&u.Username,
 		&u.Email,
 		&u.Password,
+		&u.EmailVerifiedAt,
 		&u.CreatedAt,
 	)
 	if err != nil {
@@ -101,3 +118,842 @@ func (s *Store) GetUserByID(id int) (*types.User, error) {
 
 	return &u, nil
 }
+
+// CreateSession starts a session together with its first refresh token.
+func (s *Store) CreateSession(session types.Session, tokenHash string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO auth_sessions (id, user_id, user_agent, ip_address, expires_at)
+         VALUES ($1, $2, $3, $4, $5)`,
+		session.ID,
+		session.UserID,
+		session.UserAgent,
+		session.IPAddress,
+		session.ExpiresAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO refresh_tokens (session_id, token_hash) VALUES ($1, $2)`,
+		session.ID,
+		tokenHash,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RotateRefreshToken exchanges a live refresh token for newHash and slides
+// the session expiry to expiresAt. Presenting a token that was already
+// rotated means it leaked, so the whole session family is revoked and
+// errRefreshTokenReused returned alongside the revoked session. Unknown
+// tokens yield sql.ErrNoRows.
+func (s *Store) RotateRefreshToken(tokenHash, newHash string, expiresAt time.Time) (*types.Session, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var tokenID int
+	var rotatedAt *time.Time
+	var expired bool
+	var session types.Session
+	err = tx.QueryRow(
+		`SELECT t.id, t.rotated_at, s.id, s.user_id, s.user_agent, s.ip_address,
+                s.created_at, s.last_used_at, s.expires_at, s.revoked_at, s.expires_at <= NOW()
+         FROM refresh_tokens t
+         JOIN auth_sessions s ON s.id = t.session_id
+         WHERE t.token_hash = $1
+         FOR UPDATE`,
+		tokenHash,
+	).Scan(
+		&tokenID,
+		&rotatedAt,
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+		&expired,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.RevokedAt != nil {
+		return nil, errSessionRevoked
+	}
+
+	if rotatedAt != nil {
+		if err := tx.QueryRow(
+			`UPDATE auth_sessions
+             SET revoked_at = NOW(), revoked_reason = 'refresh_token_reuse'
+             WHERE id = $1
+             RETURNING revoked_at`,
+			session.ID,
+		).Scan(&session.RevokedAt); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return &session, errRefreshTokenReused
+	}
+
+	if expired {
+		return nil, errSessionExpired
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE refresh_tokens SET rotated_at = NOW() WHERE id = $1`,
+		tokenID,
+	); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO refresh_tokens (session_id, token_hash) VALUES ($1, $2)`,
+		session.ID,
+		newHash,
+	); err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(
+		`UPDATE auth_sessions
+         SET last_used_at = NOW(), expires_at = $2
+         WHERE id = $1
+         RETURNING last_used_at, expires_at`,
+		session.ID,
+		expiresAt,
+	).Scan(&session.LastUsedAt, &session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+const sessionColumns = `id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at`
+
+func (s *Store) querySessions(query string, args ...any) ([]types.Session, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []types.Session{}
+	for rows.Next() {
+		var session types.Session
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IPAddress,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+			&session.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *Store) ListActiveSessions(userID int) ([]types.Session, error) {
+	return s.querySessions(
+		`SELECT `+sessionColumns+`
+         FROM auth_sessions
+         WHERE user_id = $1
+           AND revoked_at IS NULL
+           AND expires_at > NOW()
+         ORDER BY last_used_at DESC`,
+		userID,
+	)
+}
+
+// RevokeSession ends one of userID's sessions and returns when it was
+// revoked. Sessions that are unknown or already revoked yield sql.ErrNoRows.
+func (s *Store) RevokeSession(userID int, sessionID string) (time.Time, error) {
+	var revokedAt time.Time
+	err := s.db.QueryRow(
+		`UPDATE auth_sessions
+         SET revoked_at = NOW(), revoked_reason = 'logout'
+         WHERE id = $1
+           AND user_id = $2
+           AND revoked_at IS NULL
+         RETURNING revoked_at`,
+		sessionID,
+		userID,
+	).Scan(&revokedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return revokedAt, nil
+}
+
+func (s *Store) RevokeAllSessions(userID int, reason string) ([]types.Session, error) {
+	return s.querySessions(
+		`UPDATE auth_sessions
+         SET revoked_at = NOW(), revoked_reason = $2
+         WHERE user_id = $1
+           AND revoked_at IS NULL
+         RETURNING `+sessionColumns,
+		userID,
+		reason,
+	)
+}
+
+// ListRevokedSessions returns sessions revoked at or after since, oldest
+// first, for keeping the in-memory revocation list current.
+func (s *Store) ListRevokedSessions(since time.Time) ([]types.Session, error) {
+	return s.querySessions(
+		`SELECT `+sessionColumns+`
+         FROM auth_sessions
+         WHERE revoked_at >= $1
+         ORDER BY revoked_at ASC`,
+		since,
+	)
+}
+
+func (s *Store) UpdatePassword(userID int, passwordHash string) error {
+	res, err := s.db.Exec(
+		`UPDATE users SET password = $2 WHERE id = $1`,
+		userID,
+		passwordHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreatePasswordReset stores a reset token for userID. Earlier tokens that
+// were never used stop working, so only the newest email is valid. It
+// refuses with errResetRecentlySent when the last token is under a minute
+// old.
+func (s *Store) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user row so concurrent requests queue behind each other.
+	if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return err
+	}
+
+	var recent bool
+	err = tx.QueryRow(
+		`SELECT EXISTS (
+             SELECT 1 FROM password_reset_tokens
+             WHERE user_id = $1
+               AND used_at IS NULL
+               AND created_at > NOW() - INTERVAL '1 minute'
+         )`,
+		userID,
+	).Scan(&recent)
+	if err != nil {
+		return err
+	}
+	if recent {
+		return errResetRecentlySent
+	}
+
+	if _, err := tx.Exec(
+		`DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+         VALUES ($1, $2, $3)`,
+		userID,
+		tokenHash,
+		expiresAt,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword redeems a reset token and sets the new password hash,
+// returning the user it belongs to. Tokens that are unknown, used or
+// expired yield sql.ErrNoRows.
+func (s *Store) ResetPassword(tokenHash, passwordHash string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID int
+	err = tx.QueryRow(
+		`SELECT id, user_id
+         FROM password_reset_tokens
+         WHERE token_hash = $1
+           AND used_at IS NULL
+           AND expires_at > NOW()
+         FOR UPDATE`,
+		tokenHash,
+	).Scan(&tokenID, &userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE password_reset_tokens SET used_at = NOW() WHERE id = $1`,
+		tokenID,
+	); err != nil {
+		return 0, err
+	}
+
+	// Following the emailed link proves the address, so it counts as
+	// verification too.
+	if _, err := tx.Exec(
+		`UPDATE users
+         SET password = $2, email_verified_at = COALESCE(email_verified_at, NOW())
+         WHERE id = $1`,
+		userID,
+		passwordHash,
+	); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// CreateEmailVerification stores a verification token for userID and
+// retires any earlier unused ones. It refuses with
+// errVerificationRecentlySent when the last token is under a minute old.
+func (s *Store) CreateEmailVerification(userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user row so concurrent resends queue behind each other.
+	if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return err
+	}
+
+	var recent bool
+	err = tx.QueryRow(
+		`SELECT EXISTS (
+             SELECT 1 FROM email_verification_tokens
+             WHERE user_id = $1
+               AND used_at IS NULL
+               AND created_at > NOW() - INTERVAL '1 minute'
+         )`,
+		userID,
+	).Scan(&recent)
+	if err != nil {
+		return err
+	}
+	if recent {
+		return errVerificationRecentlySent
+	}
+
+	if _, err := tx.Exec(
+		`DELETE FROM email_verification_tokens WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at)
+         SELECT id, email, $2, $3 FROM users WHERE id = $1`,
+		userID,
+		tokenHash,
+		expiresAt,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// VerifyEmail redeems a verification token and marks the address it was
+// issued for as verified, returning the user. Tokens that are unknown,
+// used, expired or for an address the user no longer has yield
+// sql.ErrNoRows.
+func (s *Store) VerifyEmail(tokenHash string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID int
+	err = tx.QueryRow(
+		`SELECT t.id, t.user_id
+         FROM email_verification_tokens t
+         JOIN users u ON u.id = t.user_id AND u.email = t.email
+         WHERE t.token_hash = $1
+           AND t.used_at IS NULL
+           AND t.expires_at > NOW()
+         FOR UPDATE OF t`,
+		tokenHash,
+	).Scan(&tokenID, &userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE email_verification_tokens SET used_at = NOW() WHERE id = $1`,
+		tokenID,
+	); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1`,
+		userID,
+	); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (s *Store) GetTwoFactor(userID int) (*types.TwoFactor, error) {
+	var tf types.TwoFactor
+	err := s.db.QueryRow(
+		`SELECT user_id, secret, confirmed_at, last_used_step, failed_attempts, locked_until, created_at
+         FROM user_totp
+         WHERE user_id = $1`,
+		userID,
+	).Scan(
+		&tf.UserID,
+		&tf.Secret,
+		&tf.ConfirmedAt,
+		&tf.LastUsedStep,
+		&tf.FailedAttempts,
+		&tf.LockedUntil,
+		&tf.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tf, nil
+}
+
+// SaveTwoFactorSecret starts, or restarts, an unconfirmed enrolment. It
+// returns errTwoFactorEnabled when a confirmed one exists.
+func (s *Store) SaveTwoFactorSecret(userID int, sealedSecret string) error {
+	var saved int
+	err := s.db.QueryRow(
+		`INSERT INTO user_totp (user_id, secret)
+         VALUES ($1, $2)
+         ON CONFLICT (user_id) DO UPDATE
+             SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+             WHERE user_totp.confirmed_at IS NULL
+         RETURNING user_id`,
+		userID,
+		sealedSecret,
+	).Scan(&saved)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errTwoFactorEnabled
+	}
+	return err
+}
+
+// ConfirmTwoFactor turns a pending enrolment on, recording step as used and
+// replacing any recovery codes with recoveryCodeHashes.
+func (s *Store) ConfirmTwoFactor(userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE user_totp
+         SET confirmed_at = NOW(), last_used_step = $2
+         WHERE user_id = $1
+           AND confirmed_at IS NULL`,
+		userID,
+		step,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errTwoFactorNotPending
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(
+			`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID,
+			hash,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records step as spent. A step at or before the last one used
+// yields sql.ErrNoRows, so a code cannot be replayed.
+func (s *Store) UseTOTPStep(userID int, step int64) error {
+	res, err := s.db.Exec(
+		`UPDATE user_totp
+         SET last_used_step = $2
+         WHERE user_id = $1
+           AND confirmed_at IS NOT NULL
+           AND last_used_step < $2`,
+		userID,
+		step,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UseRecoveryCode spends one recovery code. Unknown or used codes yield
+// sql.ErrNoRows.
+func (s *Store) UseRecoveryCode(userID int, codeHash string) error {
+	res, err := s.db.Exec(
+		`UPDATE user_recovery_codes
+         SET used_at = NOW()
+         WHERE user_id = $1
+           AND code_hash = $2
+           AND used_at IS NULL`,
+		userID,
+		codeHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RecordTwoFactorFailure counts a wrong second-factor code. Every lockEvery
+// failures lock the second step, for a minute the first time and twice as
+// long each time after, up to a day. It returns the lock's end, if any.
+func (s *Store) RecordTwoFactorFailure(userID, lockEvery int) (*time.Time, error) {
+	var lockedUntil *time.Time
+	err := s.db.QueryRow(
+		`UPDATE user_totp
+         SET failed_attempts = failed_attempts + 1,
+             locked_until = CASE
+                 WHEN (failed_attempts + 1) % $2 = 0 THEN NOW() + LEAST(
+                     make_interval(mins => 1 << LEAST((failed_attempts + 1) / $2 - 1, 11)),
+                     INTERVAL '1 day'
+                 )
+                 ELSE locked_until
+             END
+         WHERE user_id = $1
+         RETURNING locked_until`,
+		userID,
+		lockEvery,
+	).Scan(&lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return lockedUntil, nil
+}
+
+// ResetTwoFactorFailures clears the failure count after an accepted code.
+func (s *Store) ResetTwoFactorFailures(userID int) error {
+	_, err := s.db.Exec(
+		`UPDATE user_totp SET failed_attempts = 0, locked_until = NULL WHERE user_id = $1`,
+		userID,
+	)
+	return err
+}
+
+func (s *Store) CountRecoveryCodes(userID int) (int, error) {
+	var n int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	).Scan(&n)
+	return n, err
+}
+
+func (s *Store) DisableTwoFactor(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// CreateOIDCLoginState remembers an outstanding provider redirect. Expired
+// states are cleared out on the way.
+func (s *Store) CreateOIDCLoginState(stateHash string, state types.OIDCLoginState, expiresAt time.Time) error {
+	if _, err := s.db.Exec(`DELETE FROM oidc_login_states WHERE expires_at <= NOW()`); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(
+		`INSERT INTO oidc_login_states (state_hash, provider, code_verifier, nonce, redirect_uri, link_user_id, expires_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		stateHash,
+		state.Provider,
+		state.CodeVerifier,
+		state.Nonce,
+		state.RedirectURI,
+		state.LinkUserID,
+		expiresAt,
+	)
+	return err
+}
+
+// ConsumeOIDCLoginState returns and deletes a state, so each one is good
+// for a single callback. Unknown or expired states yield sql.ErrNoRows.
+func (s *Store) ConsumeOIDCLoginState(stateHash string) (*types.OIDCLoginState, error) {
+	var state types.OIDCLoginState
+	err := s.db.QueryRow(
+		`DELETE FROM oidc_login_states
+         WHERE state_hash = $1
+           AND expires_at > NOW()
+         RETURNING provider, code_verifier, nonce, redirect_uri, link_user_id`,
+		stateHash,
+	).Scan(
+		&state.Provider,
+		&state.CodeVerifier,
+		&state.Nonce,
+		&state.RedirectURI,
+		&state.LinkUserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+const identityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func scanIdentity(row scanner) (*types.Identity, error) {
+	var identity types.Identity
+	if err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (s *Store) GetIdentity(provider, subject string) (*types.Identity, error) {
+	return scanIdentity(s.db.QueryRow(
+		`SELECT `+identityColumns+`
+         FROM user_identities
+         WHERE provider = $1 AND subject = $2`,
+		provider,
+		subject,
+	))
+}
+
+func (s *Store) ListIdentities(userID int) ([]types.Identity, error) {
+	rows, err := s.db.Query(
+		`SELECT `+identityColumns+`
+         FROM user_identities
+         WHERE user_id = $1
+         ORDER BY created_at ASC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []types.Identity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// LinkIdentity attaches an external account to identity.UserID. It returns
+// errIdentityLinked when that account, or another account at the same
+// provider, is already linked.
+func (s *Store) LinkIdentity(identity types.Identity) (*types.Identity, error) {
+	linked, err := scanIdentity(s.db.QueryRow(
+		`INSERT INTO user_identities (user_id, provider, subject, email)
+         VALUES ($1, $2, $3, $4)
+         ON CONFLICT DO NOTHING
+         RETURNING `+identityColumns,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errIdentityLinked
+	}
+	return linked, err
+}
+
+func (s *Store) RecordIdentityLogin(id int) error {
+	_, err := s.db.Exec(`UPDATE user_identities SET last_login_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (s *Store) UnlinkIdentity(userID, id int) error {
+	res, err := s.db.Exec(
+		`DELETE FROM user_identities WHERE id = $1 AND user_id = $2`,
+		id,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateUserWithIdentity registers a user who signed in through a provider.
+// Such users have no password until they set one with a reset link.
+func (s *Store) CreateUserWithIdentity(user types.User, identity types.Identity) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(
+		`INSERT INTO users (username, email, password, email_verified_at)
+         VALUES ($1, $2, $3, $4)
+         RETURNING id`,
+		user.Username,
+		user.Email,
+		user.Password,
+		user.EmailVerifiedAt,
+	).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+         VALUES ($1, $2, $3, $4, NOW())`,
+		userID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+	); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,477 @@
+package user
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"layer-api/types"
+	"layer-api/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	totpIssuer        = "Layer"
+	recoveryCodeCount = 10
+	// maxChallengeAttempts is how many wrong codes one challenge token
+	// survives before the user has to enter their password again.
+	maxChallengeAttempts = 5
+	// twoFactorLockEvery is how many wrong codes, across all challenges,
+	// lock the user's second step. The lock doubles each time.
+	twoFactorLockEvery = 10
+)
+
+var (
+	errInvalidCode     = errors.New("invalid two-factor code")
+	errTwoFactorLocked = errors.New("too many invalid two-factor codes; try again later")
+)
+
+var challengeAttempts = struct {
+	sync.Mutex
+	failures map[string]int
+	expires  map[string]time.Time
+}{failures: make(map[string]int), expires: make(map[string]time.Time)}
+
+// completeLogin finishes a successful password check. Users with two-factor
+// authentication get a challenge token to redeem at /login/2fa instead of a
+// session.
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, userID int) {
+	tf, err := h.twoFactor.GetTwoFactor(userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err == nil && tf.ConfirmedAt != nil {
+		challengeID, err := newOpaqueToken(16)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		challengeToken, err := utils.GenerateChallengeToken(userID, challengeID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, map[string]any{
+			"message":           "two-factor authentication required",
+			"twoFactorRequired": true,
+			"challengeToken":    challengeToken,
+		})
+		return
+	}
+
+	accessToken, refreshToken, err := h.startSession(r, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"message":      "login successfully",
+		"accessToken":  accessToken,
+		"refreshToken": refreshToken,
+	})
+}
+
+// HandleLoginTwoFactor is the second login step. It takes the challenge
+// token from HandleLogin with either a current TOTP code or a recovery code.
+func (h *Handler) HandleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var payload types.TwoFactorLoginPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	claims, err := utils.ParseToken(payload.ChallengeToken)
+	if err != nil || claims.TokenType != utils.TokenTypeChallenge || claims.ID == "" {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid or expired challenge token"))
+		return
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid or expired challenge token"))
+		return
+	}
+
+	if challengeExhausted(claims.ID) {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("too many attempts; log in again"))
+		return
+	}
+
+	tf, err := h.twoFactor.GetTwoFactor(userID)
+	if err == nil && tf.ConfirmedAt == nil {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid or expired challenge token"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if tf.LockedUntil != nil && tf.LockedUntil.After(time.Now()) {
+		writeTwoFactorLocked(w, *tf.LockedUntil)
+		return
+	}
+
+	if err := h.checkSecondFactor(tf, payload.Code); err != nil {
+		if errors.Is(err, errInvalidCode) {
+			recordChallengeFailure(claims.ID, claims.ExpiresAt.Time)
+			lockedUntil, lockErr := h.twoFactor.RecordTwoFactorFailure(userID, twoFactorLockEvery)
+			if lockErr != nil {
+				utils.WriteError(w, http.StatusInternalServerError, lockErr)
+				return
+			}
+			if lockedUntil != nil && lockedUntil.After(time.Now()) {
+				writeTwoFactorLocked(w, *lockedUntil)
+				return
+			}
+			utils.WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	forgetChallenge(claims.ID)
+
+	if tf.FailedAttempts > 0 {
+		if err := h.twoFactor.ResetTwoFactorFailures(userID); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	accessToken, refreshToken, err := h.startSession(r, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"message":      "login successfully",
+		"accessToken":  accessToken,
+		"refreshToken": refreshToken,
+	})
+}
+
+func (h *Handler) HandleTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	tf, err := h.twoFactor.GetTwoFactor(userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := map[string]any{"enabled": false, "pending": false}
+	if tf != nil {
+		status["enabled"] = tf.ConfirmedAt != nil
+		status["pending"] = tf.ConfirmedAt == nil
+	}
+	if tf != nil && tf.ConfirmedAt != nil {
+		remaining, err := h.twoFactor.CountRecoveryCodes(userID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		status["enabledAt"] = tf.ConfirmedAt
+		status["recoveryCodesRemaining"] = remaining
+	}
+
+	utils.WriteJSON(w, http.StatusOK, status)
+}
+
+// HandleEnrollTwoFactor generates a new secret and returns it with its
+// provisioning URI. Nothing changes for login until it is confirmed.
+func (h *Handler) HandleEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	u, err := h.store.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	sealed, err := utils.SealSecret(secret)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.twoFactor.SaveTwoFactorSecret(userID, sealed); err != nil {
+		if errors.Is(err, errTwoFactorEnabled) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"secret":          secret,
+		"provisioningUri": utils.TOTPProvisioningURI(totpIssuer, u.Email, secret),
+	})
+}
+
+// HandleConfirmTwoFactor turns a pending enrolment on once the user proves
+// their app produces codes, and returns recovery codes. They are only
+// shown this once.
+func (h *Handler) HandleConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	var payload types.TwoFactorCodePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tf, err := h.twoFactor.GetTwoFactor(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusBadRequest, errTwoFactorNotPending)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if tf.ConfirmedAt != nil {
+		utils.WriteError(w, http.StatusConflict, errTwoFactorEnabled)
+		return
+	}
+
+	secret, err := utils.OpenSecret(tf.Secret)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(secret, payload.Code, time.Now())
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, errInvalidCode)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.twoFactor.ConfirmTwoFactor(userID, step, hashes); err != nil {
+		if errors.Is(err, errTwoFactorNotPending) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"message":       "two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+// HandleDisableTwoFactor needs both the password and a second factor, so a
+// stolen access token alone cannot switch it off.
+func (h *Handler) HandleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	var payload types.DisableTwoFactorPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.store.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !utils.CheckPassword(u.Password, payload.Password) {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("password is incorrect"))
+		return
+	}
+
+	tf, err := h.twoFactor.GetTwoFactor(userID)
+	if err == nil && tf.ConfirmedAt == nil {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("two-factor authentication is not enabled"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.checkSecondFactor(tf, payload.Code); err != nil {
+		if errors.Is(err, errInvalidCode) {
+			utils.WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.twoFactor.DisableTwoFactor(userID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "two-factor authentication disabled"})
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code
+// and spends it. Anything else yields errInvalidCode.
+func (h *Handler) checkSecondFactor(tf *types.TwoFactor, code string) error {
+	code = strings.TrimSpace(code)
+
+	// Recovery codes are ten characters, so shorter numeric input is a TOTP
+	// code even if a recovery code happens to be all digits.
+	if _, err := strconv.Atoi(code); err == nil && len(code) < 10 {
+		secret, err := utils.OpenSecret(tf.Secret)
+		if err != nil {
+			return err
+		}
+
+		step, ok := utils.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return errInvalidCode
+		}
+		if err := h.twoFactor.UseTOTPStep(tf.UserID, step); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return errInvalidCode
+			}
+			return err
+		}
+		return nil
+	}
+
+	if err := h.twoFactor.UseRecoveryCode(tf.UserID, hashToken(normalizeRecoveryCode(code))); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errInvalidCode
+		}
+		return err
+	}
+	return nil
+}
+
+// newRecoveryCodes returns codes formatted for display, like
+// "k3m9x-p2q7r", together with the hashes to store.
+func newRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+
+		raw := strings.ToLower(encoding.EncodeToString(buf))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashToken(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func writeTwoFactorLocked(w http.ResponseWriter, until time.Time) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+	utils.WriteError(w, http.StatusTooManyRequests, errTwoFactorLocked)
+}
+
+func challengeExhausted(id string) bool {
+	challengeAttempts.Lock()
+	defer challengeAttempts.Unlock()
+
+	return challengeAttempts.failures[id] >= maxChallengeAttempts
+}
+
+func recordChallengeFailure(id string, expiresAt time.Time) {
+	challengeAttempts.Lock()
+	defer challengeAttempts.Unlock()
+
+	now := time.Now()
+	for other, t := range challengeAttempts.expires {
+		if t.Before(now) {
+			delete(challengeAttempts.expires, other)
+			delete(challengeAttempts.failures, other)
+		}
+	}
+
+	challengeAttempts.failures[id]++
+	challengeAttempts.expires[id] = expiresAt
+}
+
+// forgetChallenge retires a challenge after it has been redeemed, so the
+// same token cannot open a second session.
+func forgetChallenge(id string) {
+	challengeAttempts.Lock()
+	defer challengeAttempts.Unlock()
+
+	challengeAttempts.failures[id] = maxChallengeAttempts
+	challengeAttempts.expires[id] = time.Now().Add(utils.ChallengeTokenTTL)
+}
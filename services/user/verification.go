@@ -0,0 +1,105 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"layer-api/types"
+	"layer-api/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+const emailVerificationTTL = 48 * time.Hour
+
+// sendVerification issues a fresh verification token for u and mails the
+// link in the background.
+func (h *Handler) sendVerification(u *types.User) error {
+	token, err := newOpaqueToken(32)
+	if err != nil {
+		return err
+	}
+
+	if err := h.verifier.CreateEmailVerification(u.ID, hashToken(token), time.Now().Add(emailVerificationTTL)); err != nil {
+		return err
+	}
+
+	msg := types.EmailMessage{
+		To:      u.Email,
+		Subject: "Confirm your email for Layer",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm this is your email address by opening the link below "+
+				"within the next 48 hours:\n\n%s\n\n"+
+				"If you didn't create a Layer account, you can ignore this email.\n",
+			u.Username,
+			h.appLink("/verify-email", token),
+		),
+	}
+	go func() {
+		if err := h.mailer.Send(msg); err != nil {
+			log.Println("verification mail error:", err)
+		}
+	}()
+
+	return nil
+}
+
+// HandleVerifyEmail confirms the address a verification link was sent to.
+// It needs no access token since the link may be opened on another device.
+func (h *Handler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var payload types.VerifyEmailPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.verifier.VerifyEmail(hashToken(payload.Token)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid or expired verification token"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"message": "email verified"})
+}
+
+func (h *Handler) HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	u, err := h.store.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if u.EmailVerifiedAt != nil {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("email is already verified"))
+		return
+	}
+
+	if err := h.sendVerification(u); err != nil {
+		if errors.Is(err, errVerificationRecentlySent) {
+			utils.WriteError(w, http.StatusTooManyRequests, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, map[string]any{"message": "verification email sent"})
+}
@@ -0,0 +1,231 @@
+package workspace
+
+import (
+	"database/sql"
+	"errors"
+	"layer-api/types"
+	"layer-api/utils"
+	"net/http"
+	"strings"
+)
+
+func (h *Handler) handleInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	actor, ok := h.requireMember(w, id, userID, types.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var payload types.InviteWorkspaceMemberPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if (payload.Username == "") == (payload.Email == "") {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("provide exactly one of username or email"))
+		return
+	}
+
+	role := payload.Role
+	if role == "" {
+		role = types.WorkspaceRoleMember
+	}
+	if role.Rank() >= actor.Role.Rank() {
+		utils.WriteError(w, http.StatusForbidden, errRoleTooHigh)
+		return
+	}
+
+	inv := types.WorkspaceInvitation{
+		WorkspaceID: id,
+		InviterID:   userID,
+		Role:        role,
+	}
+
+	var invitee *types.User
+	if payload.Username != "" {
+		invitee, err = h.userStore.GetUserByUsername(payload.Username)
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+	} else {
+		email := strings.TrimSpace(payload.Email)
+		inv.InviteeEmail = strings.ToLower(email)
+		invitee, err = h.userStore.GetUserByEmail(email)
+		if errors.Is(err, sql.ErrNoRows) && email != inv.InviteeEmail {
+			invitee, err = h.userStore.GetUserByEmail(inv.InviteeEmail)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			invitee, err = nil, nil
+		}
+		// Until the account proves it owns the address, the invitation is
+		// held for the address and claimed on verification.
+		if err == nil && invitee != nil && invitee.EmailVerifiedAt == nil {
+			invitee = nil
+		}
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if invitee != nil {
+		if _, err := h.store.GetMember(id, invitee.ID); err == nil {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("user is already a member"))
+			return
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		inv.InviteeID = &invitee.ID
+	}
+
+	invitationID, err := h.store.CreateWorkspaceInvitation(inv)
+	if err != nil {
+		if errors.Is(err, errInvitationExists) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.store.GetWorkspaceInvitationByID(invitationID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, ok := h.requireMember(w, id, userID, types.WorkspaceRoleAdmin); !ok {
+		return
+	}
+
+	invitations, err := h.store.ListWorkspaceInvitations(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, invitations)
+}
+
+func (h *Handler) handleCancelInvitation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	invitationID, err := parseID(r, "invitationId")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, ok := h.requireMember(w, id, userID, types.WorkspaceRoleAdmin); !ok {
+		return
+	}
+
+	if err := h.store.CancelWorkspaceInvitation(id, invitationID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("invitation not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "invitation cancelled"})
+}
+
+func (h *Handler) handleListMyInvitations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	invitations, err := h.store.ListUserWorkspaceInvitations(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, invitations)
+}
+
+func (h *Handler) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	h.respondToInvitation(w, r, true)
+}
+
+func (h *Handler) handleDeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	h.respondToInvitation(w, r, false)
+}
+
+func (h *Handler) respondToInvitation(w http.ResponseWriter, r *http.Request, accept bool) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	invitationID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	inv, err := h.store.RespondToWorkspaceInvitation(invitationID, userID, accept)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("invitation not found"))
+			return
+		}
+		if errors.Is(err, errInvitationUnverified) {
+			utils.WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, inv)
+}
@@ -0,0 +1,495 @@
+package workspace
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"layer-api/authz"
+	"layer-api/types"
+	"layer-api/utils"
+	"layer-api/verification"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+var errRoleTooHigh = errors.New("cannot manage roles at or above your own level")
+
+type Handler struct {
+	store     types.WorkspaceStore
+	noteStore types.NoteStore
+	userStore types.UserStore
+	authz     *authz.Authorizer
+	verified  *verification.Policy
+}
+
+func NewHandler(
+	store types.WorkspaceStore,
+	noteStore types.NoteStore,
+	userStore types.UserStore,
+	authorizer *authz.Authorizer,
+	verified *verification.Policy,
+) *Handler {
+	return &Handler{
+		store:     store,
+		noteStore: noteStore,
+		userStore: userStore,
+		authz:     authorizer,
+		verified:  verified,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.Handle("/workspaces", utils.AuthMiddleware(http.HandlerFunc(h.handleCreate))).Methods("POST")
+	router.Handle("/workspaces", utils.AuthMiddleware(http.HandlerFunc(h.handleList))).Methods("GET")
+	router.Handle("/workspaces/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleGet))).Methods("GET")
+	router.Handle("/workspaces/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleUpdate))).Methods("PATCH")
+	router.Handle("/workspaces/{id}", utils.AuthMiddleware(http.HandlerFunc(h.handleDelete))).Methods("DELETE")
+	router.Handle("/workspaces/{id}/notes", utils.AuthMiddleware(http.HandlerFunc(h.handleListNotes))).Methods("GET")
+
+	router.Handle("/workspaces/{id}/members", utils.AuthMiddleware(http.HandlerFunc(h.handleListMembers))).Methods("GET")
+	router.Handle("/workspaces/{id}/members/{userId}", utils.AuthMiddleware(http.HandlerFunc(h.handleUpdateMember))).Methods("PATCH")
+	router.Handle("/workspaces/{id}/members/{userId}", utils.AuthMiddleware(http.HandlerFunc(h.handleRemoveMember))).Methods("DELETE")
+
+	router.Handle("/workspaces/{id}/invitations", utils.AuthMiddleware(h.verified.Require(verification.RestrictInvite, http.HandlerFunc(h.handleInvite)))).Methods("POST")
+	router.Handle("/workspaces/{id}/invitations", utils.AuthMiddleware(http.HandlerFunc(h.handleListInvitations))).Methods("GET")
+	router.Handle("/workspaces/{id}/invitations/{invitationId}", utils.AuthMiddleware(http.HandlerFunc(h.handleCancelInvitation))).Methods("DELETE")
+	router.Handle("/workspace-invitations", utils.AuthMiddleware(http.HandlerFunc(h.handleListMyInvitations))).Methods("GET")
+	router.Handle("/workspace-invitations/{id}/accept", utils.AuthMiddleware(http.HandlerFunc(h.handleAcceptInvitation))).Methods("POST")
+	router.Handle("/workspace-invitations/{id}/decline", utils.AuthMiddleware(http.HandlerFunc(h.handleDeclineInvitation))).Methods("POST")
+
+	router.Handle("/notes/{id}/workspace", utils.AuthMiddleware(http.HandlerFunc(h.handleSetNoteWorkspace))).Methods("PUT")
+}
+
+func (h *Handler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	var payload types.CreateWorkspacePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("name is required"))
+		return
+	}
+
+	id, err := h.store.CreateWorkspace(types.Workspace{
+		OwnerID:     userID,
+		Name:        name,
+		DefaultRole: payload.DefaultRole,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ws, err := h.store.GetWorkspaceByID(id, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, ws)
+}
+
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	workspaces, err := h.store.ListWorkspaces(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, workspaces)
+}
+
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, ok := h.requireMember(w, id, userID, types.WorkspaceRoleViewer); !ok {
+		return
+	}
+
+	ws, err := h.store.GetWorkspaceByID(id, userID)
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, ws)
+}
+
+func (h *Handler) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, ok := h.requireMember(w, id, userID, types.WorkspaceRoleAdmin); !ok {
+		return
+	}
+
+	var payload types.UpdateWorkspacePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ws, err := h.store.GetWorkspaceByID(id, userID)
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	if payload.Name != nil {
+		name := strings.TrimSpace(*payload.Name)
+		if name == "" {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("name is required"))
+			return
+		}
+		ws.Name = name
+	}
+	if payload.DefaultRole != nil {
+		ws.DefaultRole = *payload.DefaultRole
+	}
+
+	if err := h.store.UpdateWorkspace(*ws); err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	updated, err := h.store.GetWorkspaceByID(id, userID)
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, ok := h.requireMember(w, id, userID, types.WorkspaceRoleOwner); !ok {
+		return
+	}
+
+	if err := h.store.DeleteWorkspace(id); err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "workspace deleted"})
+}
+
+func (h *Handler) handleListNotes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, ok := h.requireMember(w, id, userID, types.WorkspaceRoleViewer); !ok {
+		return
+	}
+
+	notes, err := h.store.ListWorkspaceNotes(id, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, notes)
+}
+
+func (h *Handler) handleListMembers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, ok := h.requireMember(w, id, userID, types.WorkspaceRoleViewer); !ok {
+		return
+	}
+
+	members, err := h.store.ListMembers(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, members)
+}
+
+func (h *Handler) handleUpdateMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	targetID, err := parseID(r, "userId")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	actor, ok := h.requireMember(w, id, userID, types.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var payload types.UpdateWorkspaceMemberPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	target, ok := h.requireTarget(w, id, targetID, actor)
+	if !ok {
+		return
+	}
+
+	if payload.Role.Rank() >= actor.Role.Rank() {
+		utils.WriteError(w, http.StatusForbidden, errRoleTooHigh)
+		return
+	}
+
+	if err := h.store.UpdateMemberRole(id, targetID, payload.Role); err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+	target.Role = payload.Role
+
+	utils.WriteJSON(w, http.StatusOK, target)
+}
+
+// handleRemoveMember lets admins remove members below them and lets any
+// member other than the owner leave.
+func (h *Handler) handleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	id, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	targetID, err := parseID(r, "userId")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if targetID == userID {
+		actor, ok := h.requireMember(w, id, userID, types.WorkspaceRoleViewer)
+		if !ok {
+			return
+		}
+		if actor.Role == types.WorkspaceRoleOwner {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("owner cannot leave the workspace"))
+			return
+		}
+	} else {
+		actor, ok := h.requireMember(w, id, userID, types.WorkspaceRoleAdmin)
+		if !ok {
+			return
+		}
+		if _, ok := h.requireTarget(w, id, targetID, actor); !ok {
+			return
+		}
+	}
+
+	if err := h.store.RemoveMember(id, targetID); err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "member removed"})
+}
+
+func (h *Handler) handleSetNoteWorkspace(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserIDFromContext(r.Context())
+	if !ok || userID <= 0 {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	noteID, err := parseID(r, "id")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, _, err := h.authz.Authorize(r.Context(), noteID, userID, authz.ActionMove); err != nil {
+		authz.WriteError(w, err)
+		return
+	}
+
+	var payload types.SetNoteWorkspacePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.WorkspaceID != nil {
+		if _, ok := h.requireMember(w, *payload.WorkspaceID, userID, types.WorkspaceRoleMember); !ok {
+			return
+		}
+	} else if payload.MemberRole != "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("memberRole requires a workspace"))
+		return
+	}
+
+	if err := h.store.SetNoteWorkspace(noteID, payload.WorkspaceID, payload.MemberRole); err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	updated, err := h.noteStore.GetNoteByID(noteID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+// requireMember returns the caller's membership when it is at least min.
+// Non-members see the workspace as missing.
+func (h *Handler) requireMember(w http.ResponseWriter, workspaceID, userID int, min types.WorkspaceRole) (*types.WorkspaceMember, bool) {
+	m, err := h.store.GetMember(workspaceID, userID)
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return nil, false
+	}
+
+	if m.Role.Rank() < min.Rank() {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("requires %s role in this workspace", min))
+		return nil, false
+	}
+
+	return m, true
+}
+
+// requireTarget loads a member the actor outranks.
+func (h *Handler) requireTarget(w http.ResponseWriter, workspaceID, userID int, actor *types.WorkspaceMember) (*types.WorkspaceMember, bool) {
+	target, err := h.store.GetMember(workspaceID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("member not found"))
+			return nil, false
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if target.Role.Rank() >= actor.Role.Rank() {
+		utils.WriteError(w, http.StatusForbidden, errRoleTooHigh)
+		return nil, false
+	}
+
+	return target, true
+}
+
+func writeWorkspaceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, errors.New("workspace not found"))
+		return
+	}
+	utils.WriteError(w, http.StatusInternalServerError, err)
+}
+
+func parseID(r *http.Request, key string) (int, error) {
+	raw, ok := mux.Vars(r)[key]
+	if !ok || raw == "" {
+		return 0, fmt.Errorf("missing %s", key)
+	}
+
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid %s", key)
+	}
+
+	return id, nil
+}
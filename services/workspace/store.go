@@ -0,0 +1,478 @@
+package workspace
+
+import (
+	"database/sql"
+	"errors"
+	"layer-api/types"
+)
+
+var (
+	errInvitationExists     = errors.New("user already has a pending invitation")
+	errInvitationUnverified = errors.New("verify your email address to accept this invitation")
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+const workspaceSelect = `SELECT w.id, w.owner_id, w.name, w.default_role, COALESCE(m.role, ''),
+	(SELECT COUNT(*) FROM workspace_members c WHERE c.workspace_id = w.id),
+	w.created_at, w.updated_at
+	FROM workspaces w
+	LEFT JOIN workspace_members m ON m.workspace_id = w.id AND m.user_id = $1`
+
+func scanWorkspace(row scanner) (*types.Workspace, error) {
+	var ws types.Workspace
+	err := row.Scan(
+		&ws.ID,
+		&ws.OwnerID,
+		&ws.Name,
+		&ws.DefaultRole,
+		&ws.Role,
+		&ws.MemberCount,
+		&ws.CreatedAt,
+		&ws.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ws, nil
+}
+
+// CreateWorkspace inserts the workspace and its owner's membership together.
+func (s *Store) CreateWorkspace(ws types.Workspace) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(
+		`INSERT INTO workspaces (owner_id, name, default_role)
+         VALUES ($1, $2, COALESCE(NULLIF($3, ''), 'editor'))
+         RETURNING id`,
+		ws.OwnerID,
+		ws.Name,
+		ws.DefaultRole,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO workspace_members (workspace_id, user_id, role)
+         VALUES ($1, $2, 'owner')`,
+		id,
+		ws.OwnerID,
+	); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetWorkspaceByID(id, userID int) (*types.Workspace, error) {
+	return scanWorkspace(s.db.QueryRow(workspaceSelect+` WHERE w.id = $2`, userID, id))
+}
+
+func (s *Store) ListWorkspaces(userID int) ([]types.Workspace, error) {
+	rows, err := s.db.Query(
+		workspaceSelect+` WHERE m.user_id IS NOT NULL ORDER BY LOWER(w.name) ASC, w.id ASC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []types.Workspace{}
+	for rows.Next() {
+		ws, err := scanWorkspace(rows)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, *ws)
+	}
+
+	return workspaces, rows.Err()
+}
+
+func (s *Store) UpdateWorkspace(ws types.Workspace) error {
+	res, err := s.db.Exec(
+		`UPDATE workspaces
+         SET name = $2, default_role = $3, updated_at = NOW()
+         WHERE id = $1`,
+		ws.ID,
+		ws.Name,
+		ws.DefaultRole,
+	)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (s *Store) DeleteWorkspace(id int) error {
+	res, err := s.db.Exec(`DELETE FROM workspaces WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+const memberSelect = `SELECT m.workspace_id, m.user_id, u.username, m.role, m.created_at
+	FROM workspace_members m
+	JOIN users u ON u.id = m.user_id`
+
+func scanMember(row scanner) (*types.WorkspaceMember, error) {
+	var m types.WorkspaceMember
+	err := row.Scan(
+		&m.WorkspaceID,
+		&m.UserID,
+		&m.Username,
+		&m.Role,
+		&m.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func (s *Store) GetMember(workspaceID, userID int) (*types.WorkspaceMember, error) {
+	return scanMember(s.db.QueryRow(
+		memberSelect+` WHERE m.workspace_id = $1 AND m.user_id = $2`,
+		workspaceID,
+		userID,
+	))
+}
+
+func (s *Store) ListMembers(workspaceID int) ([]types.WorkspaceMember, error) {
+	rows, err := s.db.Query(
+		memberSelect+` WHERE m.workspace_id = $1 ORDER BY m.created_at ASC, m.user_id ASC`,
+		workspaceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []types.WorkspaceMember{}
+	for rows.Next() {
+		m, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *m)
+	}
+
+	return members, rows.Err()
+}
+
+func (s *Store) UpdateMemberRole(workspaceID, userID int, role types.WorkspaceRole) error {
+	res, err := s.db.Exec(
+		`UPDATE workspace_members
+         SET role = $3
+         WHERE workspace_id = $1
+           AND user_id = $2
+           AND role <> 'owner'`,
+		workspaceID,
+		userID,
+		role,
+	)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (s *Store) RemoveMember(workspaceID, userID int) error {
+	res, err := s.db.Exec(
+		`DELETE FROM workspace_members
+         WHERE workspace_id = $1
+           AND user_id = $2
+           AND role <> 'owner'`,
+		workspaceID,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+const invitationSelect = `SELECT i.id, i.workspace_id, w.name, i.inviter_id, inviter.username,
+	i.invitee_id, COALESCE(invitee.username, ''), COALESCE(i.invitee_email, ''),
+	i.role, i.status, i.created_at, i.responded_at
+	FROM workspace_invitations i
+	JOIN workspaces w ON w.id = i.workspace_id
+	JOIN users inviter ON inviter.id = i.inviter_id
+	LEFT JOIN users invitee ON invitee.id = i.invitee_id`
+
+func scanInvitation(row scanner) (*types.WorkspaceInvitation, error) {
+	var inv types.WorkspaceInvitation
+	var inviteeID sql.NullInt64
+	err := row.Scan(
+		&inv.ID,
+		&inv.WorkspaceID,
+		&inv.WorkspaceName,
+		&inv.InviterID,
+		&inv.InviterUsername,
+		&inviteeID,
+		&inv.InviteeUsername,
+		&inv.InviteeEmail,
+		&inv.Role,
+		&inv.Status,
+		&inv.CreatedAt,
+		&inv.RespondedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if inviteeID.Valid {
+		id := int(inviteeID.Int64)
+		inv.InviteeID = &id
+	}
+
+	return &inv, nil
+}
+
+func (s *Store) queryInvitations(query string, args ...any) ([]types.WorkspaceInvitation, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []types.WorkspaceInvitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+func (s *Store) CreateWorkspaceInvitation(inv types.WorkspaceInvitation) (int, error) {
+	var email sql.NullString
+	if inv.InviteeEmail != "" {
+		email = sql.NullString{String: inv.InviteeEmail, Valid: true}
+	}
+
+	var id int
+	err := s.db.QueryRow(
+		`INSERT INTO workspace_invitations (workspace_id, inviter_id, invitee_id, invitee_email, role)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT DO NOTHING
+         RETURNING id`,
+		inv.WorkspaceID,
+		inv.InviterID,
+		inv.InviteeID,
+		email,
+		inv.Role,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errInvitationExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetWorkspaceInvitationByID(id int) (*types.WorkspaceInvitation, error) {
+	return scanInvitation(s.db.QueryRow(invitationSelect+` WHERE i.id = $1`, id))
+}
+
+func (s *Store) ListWorkspaceInvitations(workspaceID int) ([]types.WorkspaceInvitation, error) {
+	return s.queryInvitations(
+		invitationSelect+` WHERE i.workspace_id = $1 AND i.status = 'pending'
+         ORDER BY i.created_at DESC, i.id DESC`,
+		workspaceID,
+	)
+}
+
+func (s *Store) ListUserWorkspaceInvitations(userID int) ([]types.WorkspaceInvitation, error) {
+	return s.queryInvitations(
+		invitationSelect+` WHERE i.invitee_id = $1 AND i.status = 'pending'
+         ORDER BY i.created_at DESC, i.id DESC`,
+		userID,
+	)
+}
+
+func (s *Store) CancelWorkspaceInvitation(workspaceID, id int) error {
+	res, err := s.db.Exec(
+		`UPDATE workspace_invitations
+         SET status = 'cancelled', responded_at = NOW()
+         WHERE id = $1
+           AND workspace_id = $2
+           AND status = 'pending'`,
+		id,
+		workspaceID,
+	)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// RespondToWorkspaceInvitation accepts or declines a pending invitation
+// addressed to userID. Accepting an invitation never lowers an existing
+// membership.
+func (s *Store) RespondToWorkspaceInvitation(id, userID int, accept bool) (*types.WorkspaceInvitation, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var workspaceID int
+	var role types.WorkspaceRole
+	var verified bool
+	err = tx.QueryRow(
+		`SELECT i.workspace_id, i.role,
+                i.invitee_email IS NULL
+                    OR (u.email_verified_at IS NOT NULL AND LOWER(u.email) = LOWER(i.invitee_email))
+         FROM workspace_invitations i
+         JOIN users u ON u.id = i.invitee_id
+         WHERE i.id = $1
+           AND i.invitee_id = $2
+           AND i.status = 'pending'
+         FOR UPDATE OF i`,
+		id,
+		userID,
+	).Scan(&workspaceID, &role, &verified)
+	if err != nil {
+		return nil, err
+	}
+
+	status := types.InvitationDeclined
+	if accept {
+		// Email invitations go to whoever proves they own the address, not
+		// whoever registered it first.
+		if !verified {
+			return nil, errInvitationUnverified
+		}
+		status = types.InvitationAccepted
+
+		if _, err := tx.Exec(
+			`INSERT INTO workspace_members (workspace_id, user_id, role)
+             VALUES ($1, $2, $3)
+             ON CONFLICT (workspace_id, user_id) DO NOTHING`,
+			workspaceID,
+			userID,
+			role,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE workspace_invitations
+         SET status = $2, responded_at = NOW()
+         WHERE id = $1`,
+		id,
+		status,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetWorkspaceInvitationByID(id)
+}
+
+// SetNoteWorkspace moves a note into a workspace, or out of it when
+// workspaceID is nil. memberRole overrides the workspace default for this
+// note; empty means inherit.
+func (s *Store) SetNoteWorkspace(noteID int, workspaceID *int, memberRole string) error {
+	res, err := s.db.Exec(
+		`UPDATE notes
+         SET workspace_id = $2, workspace_role = NULLIF($3, ''), version = version + 1, updated_at = NOW()
+         WHERE id = $1`,
+		noteID,
+		workspaceID,
+		memberRole,
+	)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// ListWorkspaceNotes returns the workspace's active notes that userID can
+// see, either as owner, direct collaborator or through their membership.
+func (s *Store) ListWorkspaceNotes(workspaceID, userID int) ([]types.Note, error) {
+	rows, err := s.db.Query(
+		`SELECT id, owner_id, folder_id, workspace_id, title, content, is_archived, version, created_at, updated_at
+         FROM notes n
+         WHERE workspace_id = $1
+           AND is_archived = FALSE
+           AND (owner_id = $2
+                OR EXISTS (SELECT 1 FROM note_collaborators c
+                           WHERE c.note_id = n.id AND c.user_id = $2
+                             AND (c.expires_at IS NULL OR c.expires_at > NOW()))
+                OR note_workspace_role(n.id, $2) IS NOT NULL)
+         ORDER BY updated_at DESC`,
+		workspaceID,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []types.Note{}
+	for rows.Next() {
+		var n types.Note
+		if err := rows.Scan(
+			&n.ID,
+			&n.OwnerID,
+			&n.FolderID,
+			&n.WorkspaceID,
+			&n.Title,
+			&n.Content,
+			&n.IsArchived,
+			&n.Version,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+
+	return notes, rows.Err()
+}
+
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -1,54 +1,720 @@
 package types
 
-import "time"
+import (
+	"io"
+	"time"
+)
 
 type User struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID              int        `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// Session is one signed-in device. Every refresh token minted for it shares
+// the session ID as its family.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"userId"`
+	UserAgent  string     `json:"userAgent"`
+	IPAddress  string     `json:"ipAddress"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt time.Time  `json:"lastUsedAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	Current    bool       `json:"current"`
+}
+
+// TwoFactor is a user's TOTP enrolment. Secret is sealed with
+// utils.SealSecret; enrolment only takes effect once ConfirmedAt is set.
+type TwoFactor struct {
+	UserID       int
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+	// FailedAttempts counts wrong codes since the last accepted one;
+	// LockedUntil is set when they reach a lockout threshold.
+	FailedAttempts int
+	LockedUntil    *time.Time
+	CreatedAt      time.Time
+}
+
+// Identity links a user to an account at an external OpenID Connect
+// provider, keyed by the provider's subject identifier.
+type Identity struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"userId"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+}
+
+// OIDCLoginState is what the server remembers between sending a user to a
+// provider and the callback, looked up by the hashed state parameter.
+type OIDCLoginState struct {
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	RedirectURI  string
+	LinkUserID   *int
 }
 
 type Note struct {
-	ID         int       `json:"id"`
-	OwnerID    int       `json:"ownerId"`
-	Title      string    `json:"title"`
-	Content    string    `json:"content"`
-	IsArchived bool      `json:"isArchived"`
-	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
+	ID          int       `json:"id"`
+	OwnerID     int       `json:"ownerId"`
+	FolderID    *int      `json:"folderId"`
+	WorkspaceID *int      `json:"workspaceId"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	IsArchived  bool      `json:"isArchived"`
+	IsPinned    bool      `json:"isPinned"`
+	Position    string    `json:"position,omitempty"`
+	Version     int64     `json:"version"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
 }
 
 type NoteCollaborator struct {
+	ID        int              `json:"id"`
+	NoteID    int              `json:"noteId"`
+	UserID    int              `json:"userId"`
+	Role      CollaboratorRole `json:"role"`
+	ExpiresAt *time.Time       `json:"expiresAt"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+// CollaboratorEntry is a collaborator as shown in a note's sharing list.
+// Email is only filled in for viewers allowed to manage collaborators.
+type CollaboratorEntry struct {
+	UserID          int              `json:"userId"`
+	Username        string           `json:"username"`
+	Email           string           `json:"email,omitempty"`
+	Role            CollaboratorRole `json:"role"`
+	AddedBy         *int             `json:"addedBy"`
+	AddedByUsername string           `json:"addedByUsername,omitempty"`
+	AddedAt         time.Time        `json:"addedAt"`
+	ExpiresAt       *time.Time       `json:"expiresAt"`
+	LastActiveAt    *time.Time       `json:"lastActiveAt"`
+}
+
+type CollaboratorPage struct {
+	Collaborators []CollaboratorEntry `json:"collaborators"`
+	Total         int                 `json:"total"`
+	Limit         int                 `json:"limit"`
+	Offset        int                 `json:"offset"`
+}
+
+// ExpiredGrant is a time-limited collaborator grant removed by the sweeper.
+type ExpiredGrant struct {
+	NoteID    int              `json:"noteId"`
+	NoteTitle string           `json:"noteTitle"`
+	OwnerID   int              `json:"ownerId"`
+	UserID    int              `json:"userId"`
+	Username  string           `json:"username"`
+	Role      CollaboratorRole `json:"role"`
+	ExpiredAt time.Time        `json:"expiredAt"`
+}
+
+const NotificationCollaboratorExpired = "collaborator_expired"
+
+type Notification struct {
+	ID        int            `json:"id"`
+	UserID    int            `json:"userId"`
+	Kind      string         `json:"kind"`
+	Payload   map[string]any `json:"payload"`
+	ReadAt    *time.Time     `json:"readAt"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+type CollaboratorRole string
+
+const (
+	RoleViewer    CollaboratorRole = "viewer"
+	RoleCommenter CollaboratorRole = "commenter"
+	RoleEditor    CollaboratorRole = "editor"
+	RoleManager   CollaboratorRole = "manager"
+)
+
+// Rank orders roles from least to most privileged; unknown roles rank 0.
+func (r CollaboratorRole) Rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleCommenter:
+		return 2
+	case RoleEditor:
+		return 3
+	case RoleManager:
+		return 4
+	default:
+		return 0
+	}
+}
+
+func (r CollaboratorRole) Valid() bool {
+	return r.Rank() > 0
+}
+
+func (r CollaboratorRole) CanEdit() bool {
+	return r.Rank() >= RoleEditor.Rank()
+}
+
+func (r CollaboratorRole) CanManage() bool {
+	return r == RoleManager
+}
+
+type Tag struct {
 	ID        int       `json:"id"`
+	OwnerID   int       `json:"ownerId"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	NoteCount int       `json:"noteCount"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type Folder struct {
+	ID        int       `json:"id"`
+	OwnerID   int       `json:"ownerId"`
+	ParentID  *int      `json:"parentId"`
+	Name      string    `json:"name"`
+	Children  []Folder  `json:"children,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type FolderContents struct {
+	Folder  Folder   `json:"folder"`
+	Folders []Folder `json:"folders"`
+	Notes   []Note   `json:"notes"`
+}
+
+type FolderCollaborator struct {
+	ID        int              `json:"id"`
+	FolderID  int              `json:"folderId"`
+	UserID    int              `json:"userId"`
+	Role      CollaboratorRole `json:"role"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+type NotePosition struct {
 	NoteID    int       `json:"noteId"`
 	UserID    int       `json:"userId"`
-	CanEdit   bool      `json:"canEdit"`
+	IsPinned  bool      `json:"isPinned"`
+	Position  string    `json:"position,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ImportItem struct {
+	Path       string
+	Title      string
+	Content    string
+	FolderPath string
+	Tags       []string
+	IsArchived bool
+	CreatedAt  *time.Time
+	UpdatedAt  *time.Time
+}
+
+const (
+	ImportStatusImported = "imported"
+	ImportStatusFailed   = "failed"
+
+	ImportJobPending   = "pending"
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+	ImportJobFailed    = "failed"
+)
+
+type ImportResult struct {
+	File   string `json:"file"`
+	Status string `json:"status"`
+	NoteID int    `json:"noteId,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportJob struct {
+	ID         int            `json:"id"`
+	OwnerID    int            `json:"ownerId"`
+	Source     string         `json:"source"`
+	Filename   string         `json:"filename"`
+	Status     string         `json:"status"`
+	Total      int            `json:"total"`
+	Imported   int            `json:"imported"`
+	Failed     int            `json:"failed"`
+	Results    []ImportResult `json:"results"`
+	Error      string         `json:"error,omitempty"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	UpdatedAt  time.Time      `json:"updatedAt"`
+	FinishedAt *time.Time     `json:"finishedAt"`
+}
+
+type Attachment struct {
+	ID              int                 `json:"id"`
+	NoteID          int                 `json:"noteId"`
+	UploaderID      *int                `json:"uploaderId"`
+	Filename        string              `json:"filename"`
+	ContentType     string              `json:"contentType"`
+	Size            int64               `json:"size"`
+	Checksum        string              `json:"checksum"`
+	StorageKey      string              `json:"-"`
+	ThumbnailStatus string              `json:"thumbnailStatus"`
+	Variants        []AttachmentVariant `json:"variants,omitempty"`
+	CreatedAt       time.Time           `json:"createdAt"`
+}
+
+const (
+	ThumbnailStatusNone    = "none"
+	ThumbnailStatusPending = "pending"
+	ThumbnailStatusRunning = "processing"
+	ThumbnailStatusReady   = "ready"
+	ThumbnailStatusFailed  = "failed"
+)
+
+type AttachmentVariant struct {
+	ID           int       `json:"-"`
+	AttachmentID int       `json:"-"`
+	Variant      string    `json:"variant"`
+	ContentType  string    `json:"contentType"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Size         int64     `json:"size"`
+	StorageKey   string    `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type BlobDeletion struct {
+	ID         int
+	StorageKey string
+	Attempts   int
+}
+
+type BlobObject interface {
+	io.ReadSeekCloser
+	Size() int64
+}
+
+type BlobStore interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Open(key string) (BlobObject, error)
+	Delete(key string) error
+}
+
+type EmailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg EmailMessage) error
+}
+
+type NoteRevision struct {
+	NoteID    int       `json:"noteId"`
+	Version   int64     `json:"version"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+type MergeConflict struct {
+	Field     string   `json:"field"`
+	BaseStart int      `json:"baseStartLine,omitempty"`
+	Base      []string `json:"base"`
+	Current   []string `json:"current"`
+	Incoming  []string `json:"incoming"`
+}
+
+type ShareLink struct {
+	ID           int        `json:"id"`
+	NoteID       int        `json:"noteId"`
+	CreatedBy    int        `json:"createdBy"`
+	Token        string     `json:"token"`
+	PasswordHash string     `json:"-"`
+	HasPassword  bool       `json:"hasPassword"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	ViewCount    int64      `json:"viewCount"`
+	LastViewedAt *time.Time `json:"lastViewedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+type SharedNote struct {
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type InviteLink struct {
+	ID          int                `json:"id"`
+	NoteID      int                `json:"noteId"`
+	CreatedBy   int                `json:"createdBy"`
+	Token       string             `json:"token"`
+	Role        CollaboratorRole   `json:"role"`
+	MaxUses     *int               `json:"maxUses"`
+	UseCount    int                `json:"useCount"`
+	ExpiresAt   *time.Time         `json:"expiresAt"`
+	RevokedAt   *time.Time         `json:"revokedAt"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	Redemptions []InviteRedemption `json:"redemptions"`
+}
+
+type InviteRedemption struct {
+	UserID     int       `json:"userId"`
+	Username   string    `json:"username"`
+	RedeemedAt time.Time `json:"redeemedAt"`
+}
+
+const (
+	InvitationPending   = "pending"
+	InvitationAccepted  = "accepted"
+	InvitationDeclined  = "declined"
+	InvitationCancelled = "cancelled"
+)
+
+type CollaboratorInvitation struct {
+	ID              int              `json:"id"`
+	NoteID          int              `json:"noteId"`
+	NoteTitle       string           `json:"noteTitle"`
+	InviterID       int              `json:"inviterId"`
+	InviterUsername string           `json:"inviterUsername"`
+	InviteeID       *int             `json:"inviteeId"`
+	InviteeUsername string           `json:"inviteeUsername,omitempty"`
+	InviteeEmail    string           `json:"inviteeEmail,omitempty"`
+	Role            CollaboratorRole `json:"role"`
+	Status          string           `json:"status"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	RespondedAt     *time.Time       `json:"respondedAt"`
+}
+
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+)
+
+type OwnershipTransfer struct {
+	ID           int        `json:"id"`
+	NoteID       int        `json:"noteId"`
+	NoteTitle    string     `json:"noteTitle"`
+	FromUserID   int        `json:"fromUserId"`
+	FromUsername string     `json:"fromUsername"`
+	ToUserID     int        `json:"toUserId"`
+	ToUsername   string     `json:"toUsername"`
+	KeepAccess   bool       `json:"keepAccess"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	RespondedAt  *time.Time `json:"respondedAt"`
+}
+
+const (
+	AccessRequestPending   = "pending"
+	AccessRequestApproved  = "approved"
+	AccessRequestDenied    = "denied"
+	AccessRequestCancelled = "cancelled"
+)
+
+type AccessRequest struct {
+	ID                int              `json:"id"`
+	NoteID            int              `json:"noteId"`
+	RequesterID       int              `json:"requesterId"`
+	RequesterUsername string           `json:"requesterUsername"`
+	Role              CollaboratorRole `json:"role"`
+	Message           string           `json:"message,omitempty"`
+	Status            string           `json:"status"`
+	ReviewerID        *int             `json:"reviewerId"`
+	CreatedAt         time.Time        `json:"createdAt"`
+	RespondedAt       *time.Time       `json:"respondedAt"`
+}
+
+type AuditEntry struct {
+	ID        int            `json:"id"`
+	NoteID    int            `json:"noteId"`
+	ActorID   *int           `json:"actorId"`
+	Action    string         `json:"action"`
+	Details   map[string]any `json:"details"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+type WorkspaceRole string
+
+const (
+	WorkspaceRoleViewer WorkspaceRole = "viewer"
+	WorkspaceRoleMember WorkspaceRole = "member"
+	WorkspaceRoleAdmin  WorkspaceRole = "admin"
+	WorkspaceRoleOwner  WorkspaceRole = "owner"
+)
+
+// Rank orders workspace roles from least to most privileged; unknown roles
+// rank 0.
+func (r WorkspaceRole) Rank() int {
+	switch r {
+	case WorkspaceRoleViewer:
+		return 1
+	case WorkspaceRoleMember:
+		return 2
+	case WorkspaceRoleAdmin:
+		return 3
+	case WorkspaceRoleOwner:
+		return 4
+	default:
+		return 0
+	}
+}
+
+func (r WorkspaceRole) CanManage() bool {
+	return r.Rank() >= WorkspaceRoleAdmin.Rank()
+}
+
+type Workspace struct {
+	ID          int           `json:"id"`
+	OwnerID     int           `json:"ownerId"`
+	Name        string        `json:"name"`
+	DefaultRole string        `json:"defaultRole"`
+	Role        WorkspaceRole `json:"role,omitempty"`
+	MemberCount int           `json:"memberCount"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	UpdatedAt   time.Time     `json:"updatedAt"`
+}
+
+type WorkspaceMember struct {
+	WorkspaceID int           `json:"workspaceId"`
+	UserID      int           `json:"userId"`
+	Username    string        `json:"username"`
+	Role        WorkspaceRole `json:"role"`
+	CreatedAt   time.Time     `json:"createdAt"`
+}
+
+type WorkspaceInvitation struct {
+	ID              int           `json:"id"`
+	WorkspaceID     int           `json:"workspaceId"`
+	WorkspaceName   string        `json:"workspaceName"`
+	InviterID       int           `json:"inviterId"`
+	InviterUsername string        `json:"inviterUsername"`
+	InviteeID       *int          `json:"inviteeId"`
+	InviteeUsername string        `json:"inviteeUsername,omitempty"`
+	InviteeEmail    string        `json:"inviteeEmail,omitempty"`
+	Role            WorkspaceRole `json:"role"`
+	Status          string        `json:"status"`
+	CreatedAt       time.Time     `json:"createdAt"`
+	RespondedAt     *time.Time    `json:"respondedAt"`
+}
+
+type NoteFilter struct {
+	Tags          []string
+	MatchAnyTag   bool
+	IncludeShared bool
+}
+
 type UserStore interface {
 	CreateUser(User) (int, error)
 	GetUserByEmail(email string) (*User, error)
 	GetUserByUsername(username string) (*User, error)
 	GetUserByID(id int) (*User, error)
+	UpdatePassword(userID int, passwordHash string) error
+}
+
+type PasswordResetStore interface {
+	CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error
+	ResetPassword(tokenHash, passwordHash string) (int, error)
+}
+
+type TwoFactorStore interface {
+	GetTwoFactor(userID int) (*TwoFactor, error)
+	SaveTwoFactorSecret(userID int, sealedSecret string) error
+	ConfirmTwoFactor(userID int, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(userID int, step int64) error
+	UseRecoveryCode(userID int, codeHash string) error
+	RecordTwoFactorFailure(userID, lockEvery int) (*time.Time, error)
+	ResetTwoFactorFailures(userID int) error
+	CountRecoveryCodes(userID int) (int, error)
+	DisableTwoFactor(userID int) error
+}
+
+type IdentityStore interface {
+	CreateOIDCLoginState(stateHash string, state OIDCLoginState, expiresAt time.Time) error
+	ConsumeOIDCLoginState(stateHash string) (*OIDCLoginState, error)
+	GetIdentity(provider, subject string) (*Identity, error)
+	ListIdentities(userID int) ([]Identity, error)
+	LinkIdentity(identity Identity) (*Identity, error)
+	RecordIdentityLogin(id int) error
+	UnlinkIdentity(userID, id int) error
+	CreateUserWithIdentity(user User, identity Identity) (int, error)
+}
+
+type EmailVerificationStore interface {
+	CreateEmailVerification(userID int, tokenHash string, expiresAt time.Time) error
+	VerifyEmail(tokenHash string) (int, error)
+}
+
+type SessionStore interface {
+	CreateSession(session Session, tokenHash string) error
+	RotateRefreshToken(tokenHash, newHash string, expiresAt time.Time) (*Session, error)
+	ListActiveSessions(userID int) ([]Session, error)
+	RevokeSession(userID int, sessionID string) (time.Time, error)
+	RevokeAllSessions(userID int, reason string) ([]Session, error)
+	ListRevokedSessions(since time.Time) ([]Session, error)
 }
 
 type NoteStore interface {
 	CreateNote(note Note) (int, error)
 	GetNoteByID(id int) (*Note, error)
-	ListNotesByOwner(ownerID int) ([]Note, error)
+	ListNotesByOwner(ownerID int, filter NoteFilter) ([]Note, error)
 	UpdateNote(note Note) error
 	ArchiveNote(id int, ownerID int) error
 	UpdateNoteContent(id int, content string) error
+	RecordCollaboratorActivity(noteID, userID int) error
+	GetNoteRevision(noteID int, version int64) (*NoteRevision, error)
+	GetNotePosition(noteID, userID int) (*NotePosition, error)
+	SetNotePinned(noteID, userID int, pinned bool) error
+	ReorderNote(noteID, userID int, afterID, beforeID *int) error
+	ForEachNoteByOwner(ownerID int, includeArchived bool, fn func(Note) error) error
 }
 
 type CollaboratorStore interface {
-	AddCollaborator(noteID, userID int, canEdit bool) error
+	AddCollaborator(noteID, userID, addedBy int, role CollaboratorRole, expiresAt *time.Time) error
+	ExtendCollaborator(noteID, userID int, expiresAt *time.Time) error
+	UpdateCollaboratorRole(noteID, userID int, role CollaboratorRole) error
 	RemoveCollaborator(noteID, userID int) error
 	ListCollaborators(noteID int) ([]NoteCollaborator, error)
+	ListCollaboratorEntries(noteID, limit, offset int) ([]CollaboratorEntry, int, error)
 	IsCollaborator(noteID, userID int) (bool, error)
+	GetCollaborator(noteID, userID int) (*NoteCollaborator, error)
+	GetEffectiveRole(noteID, userID int) (CollaboratorRole, *time.Time, error)
+	SweepExpiredGrants() ([]ExpiredGrant, error)
+}
+
+type NotificationStore interface {
+	CreateNotification(userID int, kind string, payload map[string]any) error
+	ListNotifications(userID int, unreadOnly bool, limit int) ([]Notification, error)
+	MarkNotificationRead(id, userID int) error
+	MarkAllNotificationsRead(userID int) error
+}
+
+type TagStore interface {
+	CreateTag(tag Tag) (int, error)
+	GetTagByID(id int) (*Tag, error)
+	GetTagByName(ownerID int, name string) (*Tag, error)
+	ListTagsByOwner(ownerID int) ([]Tag, error)
+	UpdateTag(tag Tag) error
+	DeleteTag(id int, ownerID int) error
+	MergeTags(ownerID int, sourceIDs []int, targetID int) error
+	AttachTag(noteID, tagID int) error
+	DetachTag(noteID, tagID int) error
+	ListTagsByNote(noteID, ownerID int) ([]Tag, error)
+}
+
+type FolderStore interface {
+	CreateFolder(folder Folder) (int, error)
+	GetFolderByID(id int) (*Folder, error)
+	ListFoldersByOwner(ownerID int) ([]Folder, error)
+	ListChildFolders(parentID int) ([]Folder, error)
+	ListNotesInFolder(folderID int) ([]Note, error)
+	RenameFolder(id, ownerID int, name string) error
+	MoveFolder(id, ownerID int, parentID *int) error
+	DeleteFolder(id, ownerID int, cascade bool) error
+	MoveNoteToFolder(noteID int, folderID *int) error
+	ShareFolder(folderID, userID int, role CollaboratorRole) error
+	UnshareFolder(folderID, userID int) error
+	ListFolderCollaborators(folderID int) ([]FolderCollaborator, error)
+}
+
+type ImportStore interface {
+	ImportNotes(ownerID int, rootFolder string, items []ImportItem) ([]ImportResult, error)
+	CreateImportJob(job ImportJob) (int, error)
+	GetImportJob(id int) (*ImportJob, error)
+	ListImportJobs(ownerID int) ([]ImportJob, error)
+	UpdateImportJobStatus(id int, status string) error
+	TouchImportJob(id int) error
+	FailStaleImportJobs(staleAfter time.Duration, errMsg string) (int64, error)
+	FinishImportJob(id int, status string, results []ImportResult, errMsg string) error
+}
+
+type AttachmentStore interface {
+	CreateAttachment(a Attachment) (int, error)
+	GetAttachmentByID(id int) (*Attachment, error)
+	ListAttachmentsByNote(noteID int) ([]Attachment, error)
+	DeleteAttachment(id int) error
+	ClaimPendingThumbnail(staleAfter time.Duration) (*Attachment, error)
+	SetThumbnailStatus(id int, status string) error
+	CreateAttachmentVariant(v AttachmentVariant) error
+	ListAttachmentVariants(attachmentID int) ([]AttachmentVariant, error)
+	GetAttachmentVariant(attachmentID int, variant string) (*AttachmentVariant, error)
+	ListPendingBlobDeletions(limit int) ([]BlobDeletion, error)
+	CompleteBlobDeletion(id int) error
+	FailBlobDeletion(id int) error
+}
+
+type ShareLinkStore interface {
+	CreateShareLink(link ShareLink) (int, error)
+	GetShareLinkByID(id int) (*ShareLink, error)
+	GetShareLinkByToken(token string) (*ShareLink, error)
+	ListShareLinks(noteID int) ([]ShareLink, error)
+	DeleteShareLink(noteID, id int) error
+	RecordShareLinkView(id int) error
+}
+
+type InviteLinkStore interface {
+	CreateInviteLink(link InviteLink) (int, error)
+	GetInviteLinkByID(id int) (*InviteLink, error)
+	ListInviteLinks(noteID int) ([]InviteLink, error)
+	RevokeInviteLink(noteID, id int) error
+	RedeemInviteLink(token string, userID int) (*InviteLink, error)
+}
+
+type InvitationStore interface {
+	CreateInvitation(inv CollaboratorInvitation) (int, error)
+	GetInvitationByID(id int) (*CollaboratorInvitation, error)
+	ListNoteInvitations(noteID int) ([]CollaboratorInvitation, error)
+	ListUserInvitations(userID int) ([]CollaboratorInvitation, error)
+	CancelInvitation(noteID, id int) error
+	RespondToInvitation(id, userID int, accept bool) (*CollaboratorInvitation, error)
+}
+
+type AccessRequestStore interface {
+	CreateAccessRequest(req AccessRequest) (int, error)
+	GetAccessRequestByID(id int) (*AccessRequest, error)
+	ListNoteAccessRequests(noteID int) ([]AccessRequest, error)
+	ListUserAccessRequests(userID int) ([]AccessRequest, error)
+	CancelAccessRequest(id, userID int) error
+	ResolveAccessRequest(noteID, id, reviewerID int, approve bool, role CollaboratorRole) (*AccessRequest, error)
+}
+
+type TransferStore interface {
+	CreateTransfer(t OwnershipTransfer) (int, error)
+	GetTransferByID(id int) (*OwnershipTransfer, error)
+	GetPendingTransfer(noteID int) (*OwnershipTransfer, error)
+	ListIncomingTransfers(userID int) ([]OwnershipTransfer, error)
+	CancelTransfer(noteID, actorID int) error
+	RespondToTransfer(id, userID int, accept bool) (*OwnershipTransfer, error)
+	ListAuditEntries(noteID, limit int) ([]AuditEntry, error)
+}
+
+type WorkspaceStore interface {
+	CreateWorkspace(ws Workspace) (int, error)
+	GetWorkspaceByID(id, userID int) (*Workspace, error)
+	ListWorkspaces(userID int) ([]Workspace, error)
+	UpdateWorkspace(ws Workspace) error
+	DeleteWorkspace(id int) error
+	GetMember(workspaceID, userID int) (*WorkspaceMember, error)
+	ListMembers(workspaceID int) ([]WorkspaceMember, error)
+	UpdateMemberRole(workspaceID, userID int, role WorkspaceRole) error
+	RemoveMember(workspaceID, userID int) error
+	CreateWorkspaceInvitation(inv WorkspaceInvitation) (int, error)
+	GetWorkspaceInvitationByID(id int) (*WorkspaceInvitation, error)
+	ListWorkspaceInvitations(workspaceID int) ([]WorkspaceInvitation, error)
+	ListUserWorkspaceInvitations(userID int) ([]WorkspaceInvitation, error)
+	CancelWorkspaceInvitation(workspaceID, id int) error
+	RespondToWorkspaceInvitation(id, userID int, accept bool) (*WorkspaceInvitation, error)
+	SetNoteWorkspace(noteID int, workspaceID *int, memberRole string) error
+	ListWorkspaceNotes(workspaceID, userID int) ([]Note, error)
 }
 
 type RegisterUserPayload struct {
@@ -62,23 +728,115 @@ type LoginPayload struct {
 	Password   string `json:"password" validate:"required"`
 }
 
+type OIDCCallbackPayload struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+type TwoFactorLoginPayload struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	Code           string `json:"code" validate:"required,max=32"`
+}
+
+type TwoFactorCodePayload struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type DisableTwoFactorPayload struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+}
+
 type RefreshPayload struct {
 	RefreshToken string `json:"refreshToken" validate:"required"`
 }
 
+type VerifyEmailPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,min=8,max=130"`
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordPayload struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"newPassword" validate:"required,min=8,max=130"`
+}
+
 type CreateNotePayload struct {
-	Title   string `json:"title" validate:"max=200"`
-	Content string `json:"content" validate:"max=100000"`
+	Title       string `json:"title" validate:"max=200"`
+	Content     string `json:"content" validate:"max=100000"`
+	FolderID    *int   `json:"folderId,omitempty" validate:"omitempty,gt=0"`
+	WorkspaceID *int   `json:"workspaceId,omitempty" validate:"omitempty,gt=0"`
 }
 
 type UpdateNotePayload struct {
-	Title   *string `json:"title,omitempty" validate:"omitempty,max=200"`
-	Content *string `json:"content,omitempty" validate:"omitempty,max=100000"`
+	Title       *string `json:"title,omitempty" validate:"omitempty,max=200"`
+	Content     *string `json:"content,omitempty" validate:"omitempty,max=100000"`
+	BaseVersion *int64  `json:"baseVersion,omitempty" validate:"omitempty,gt=0"`
 }
 
 type AddCollaboratorPayload struct {
-	UserID  int   `json:"userId" validate:"required"`
-	CanEdit *bool `json:"canEdit,omitempty"`
+	UserID    int              `json:"userId" validate:"required"`
+	Role      CollaboratorRole `json:"role,omitempty" validate:"omitempty,oneof=viewer commenter editor manager"`
+	ExpiresAt *time.Time       `json:"expiresAt,omitempty"`
+}
+
+// ExtendCollaboratorPayload moves a grant's expiry; a null expiresAt makes
+// the grant permanent.
+type ExtendCollaboratorPayload struct {
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type UpdateCollaboratorPayload struct {
+	Role CollaboratorRole `json:"role" validate:"required,oneof=viewer commenter editor manager"`
+}
+
+type CreateTagPayload struct {
+	Name  string `json:"name" validate:"required,min=1,max=50"`
+	Color string `json:"color" validate:"omitempty,hexcolor"`
+}
+
+type UpdateTagPayload struct {
+	Name  *string `json:"name,omitempty" validate:"omitempty,min=1,max=50"`
+	Color *string `json:"color,omitempty" validate:"omitempty,hexcolor"`
+}
+
+type MergeTagsPayload struct {
+	SourceIDs []int `json:"sourceIds" validate:"required,min=1,dive,gt=0"`
+	TargetID  int   `json:"targetId" validate:"required"`
+}
+
+type AttachTagPayload struct {
+	TagID int `json:"tagId" validate:"required"`
+}
+
+type ReorderNotePayload struct {
+	AfterID  *int `json:"afterId" validate:"omitempty,gt=0"`
+	BeforeID *int `json:"beforeId" validate:"omitempty,gt=0"`
+}
+
+type CreateFolderPayload struct {
+	Name     string `json:"name" validate:"required,min=1,max=100"`
+	ParentID *int   `json:"parentId,omitempty" validate:"omitempty,gt=0"`
+}
+
+type UpdateFolderPayload struct {
+	Name string `json:"name" validate:"required,min=1,max=100"`
+}
+
+type MoveFolderPayload struct {
+	ParentID *int `json:"parentId" validate:"omitempty,gt=0"`
+}
+
+type MoveNotePayload struct {
+	FolderID *int `json:"folderId" validate:"omitempty,gt=0"`
 }
 
 type RealtimeMessageType string
@@ -107,3 +865,63 @@ type RealtimeServerMessage struct {
 	UserID     int                 `json:"userId,omitempty"`
 	ActiveUser int                 `json:"activeUser,omitempty"`
 }
+
+type CreateShareLinkPayload struct {
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Password  *string    `json:"password,omitempty" validate:"omitempty,min=4,max=72"`
+}
+
+type OpenShareLinkPayload struct {
+	Password string `json:"password" validate:"max=72"`
+}
+
+type CreateInviteLinkPayload struct {
+	Role      CollaboratorRole `json:"role,omitempty" validate:"omitempty,oneof=viewer commenter editor manager"`
+	MaxUses   *int             `json:"maxUses,omitempty" validate:"omitempty,min=1,max=10000"`
+	ExpiresAt *time.Time       `json:"expiresAt,omitempty"`
+}
+
+type InviteCollaboratorPayload struct {
+	Username string           `json:"username,omitempty" validate:"omitempty,min=3,max=30"`
+	Email    string           `json:"email,omitempty" validate:"omitempty,email,max=255"`
+	Role     CollaboratorRole `json:"role,omitempty" validate:"omitempty,oneof=viewer commenter editor manager"`
+}
+
+type ProposeTransferPayload struct {
+	UserID     int   `json:"userId" validate:"required"`
+	KeepAccess *bool `json:"keepAccess,omitempty"`
+}
+
+type RequestAccessPayload struct {
+	Role    CollaboratorRole `json:"role,omitempty" validate:"omitempty,oneof=viewer commenter editor manager"`
+	Message string           `json:"message,omitempty" validate:"max=500"`
+}
+
+type ReviewAccessRequestPayload struct {
+	Role CollaboratorRole `json:"role,omitempty" validate:"omitempty,oneof=viewer commenter editor manager"`
+}
+
+type CreateWorkspacePayload struct {
+	Name        string `json:"name" validate:"required,min=1,max=100"`
+	DefaultRole string `json:"defaultRole,omitempty" validate:"omitempty,oneof=none viewer commenter editor manager"`
+}
+
+type UpdateWorkspacePayload struct {
+	Name        *string `json:"name,omitempty" validate:"omitempty,min=1,max=100"`
+	DefaultRole *string `json:"defaultRole,omitempty" validate:"omitempty,oneof=none viewer commenter editor manager"`
+}
+
+type UpdateWorkspaceMemberPayload struct {
+	Role WorkspaceRole `json:"role" validate:"required,oneof=admin member viewer"`
+}
+
+type InviteWorkspaceMemberPayload struct {
+	Username string        `json:"username,omitempty" validate:"omitempty,min=3,max=30"`
+	Email    string        `json:"email,omitempty" validate:"omitempty,email,max=255"`
+	Role     WorkspaceRole `json:"role,omitempty" validate:"omitempty,oneof=admin member viewer"`
+}
+
+type SetNoteWorkspacePayload struct {
+	WorkspaceID *int   `json:"workspaceId" validate:"omitempty,gt=0"`
+	MemberRole  string `json:"memberRole,omitempty" validate:"omitempty,oneof=none viewer commenter editor manager"`
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+const fractionalDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var ErrInvalidKeyRange = errors.New("invalid fractional key range")
+
+// KeyBetween returns a key that sorts strictly between a and b. An empty a
+// means the start of the list and an empty b means the end, so new keys can
+// be generated without renumbering their neighbours.
+func KeyBetween(a, b string) (string, error) {
+	if !validKey(a) || !validKey(b) {
+		return "", ErrInvalidKeyRange
+	}
+	if b != "" && a >= b {
+		return "", ErrInvalidKeyRange
+	}
+
+	return midpoint(a, b), nil
+}
+
+func midpoint(a, b string) string {
+	if b != "" {
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + midpoint(rest, b[n:])
+		}
+	}
+
+	lo := 0
+	if a != "" {
+		lo = strings.IndexByte(fractionalDigits, a[0])
+	}
+	hi := len(fractionalDigits)
+	if b != "" {
+		hi = strings.IndexByte(fractionalDigits, b[0])
+	}
+
+	if hi-lo > 1 {
+		return string(fractionalDigits[(lo+hi)/2])
+	}
+
+	if len(b) > 1 {
+		return b[:1]
+	}
+
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(fractionalDigits[lo]) + midpoint(rest, "")
+}
+
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return fractionalDigits[0]
+}
+
+func validKey(k string) bool {
+	if k == "" {
+		return true
+	}
+	if k[len(k)-1] == fractionalDigits[0] {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		if strings.IndexByte(fractionalDigits, k[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -12,23 +12,40 @@ import (
 
 type CustomClaims struct {
 	TokenType string `json:"typ"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateAccessToken(userID int) (string, error) {
-	return generateToken(userID, time.Duration(12)*time.Hour, "access")
+const AccessTokenTTL = 12 * time.Hour
+
+// RefreshTokenTTL is how long a session survives without being refreshed.
+// Refresh tokens themselves are opaque and stored server-side.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// ChallengeTokenTTL bounds how long a user has to enter their second factor
+// after the password step of a login.
+const ChallengeTokenTTL = 5 * time.Minute
+
+const TokenTypeChallenge = "2fa_challenge"
+
+func GenerateAccessToken(userID int, sessionID string) (string, error) {
+	return generateToken(userID, sessionID, "", AccessTokenTTL, "access")
 }
 
-func GenerateRefreshToken(userID int) (string, error) {
-	return generateToken(userID, time.Duration(43200)*time.Minute, "refresh")
+// GenerateChallengeToken proves a user passed the password step. It cannot
+// be used as an access token; challengeID identifies it for attempt limits.
+func GenerateChallengeToken(userID int, challengeID string) (string, error) {
+	return generateToken(userID, "", challengeID, ChallengeTokenTTL, TokenTypeChallenge)
 }
 
-func generateToken(userID int, ttl time.Duration, tokenType string) (string, error) {
+func generateToken(userID int, sessionID, tokenID string, ttl time.Duration, tokenType string) (string, error) {
 	now := time.Now().UTC()
 
 	claims := CustomClaims{
 		TokenType: tokenType,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			Subject:   strconv.Itoa(userID),
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
@@ -10,7 +10,10 @@ import (
 
 type contextKey string
 
-const contextKeyUserID contextKey = "userID"
+const (
+	contextKeyUserID    contextKey = "userID"
+	contextKeySessionID contextKey = "sessionID"
+)
 
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -39,7 +42,13 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if claims.SessionID != "" && IsSessionRevoked(claims.SessionID) {
+			WriteError(w, http.StatusUnauthorized, errors.New("session has been revoked"))
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), contextKeyUserID, userID)
+		ctx = context.WithValue(ctx, contextKeySessionID, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -57,3 +66,10 @@ func GetUserIDFromContext(ctx context.Context) (int, bool) {
 
 	return userID, true
 }
+
+// GetSessionIDFromContext returns the session the request's access token
+// belongs to. Tokens issued before sessions existed carry none.
+func GetSessionIDFromContext(ctx context.Context) (string, bool) {
+	sessionID, ok := ctx.Value(contextKeySessionID).(string)
+	return sessionID, ok && sessionID != ""
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// revokedSessions remembers revoked session IDs for as long as an access
+// token minted for them could still be presented, so AuthMiddleware can
+// reject them without a database lookup.
+var revokedSessions = struct {
+	sync.RWMutex
+	until map[string]time.Time
+}{until: make(map[string]time.Time)}
+
+// RevokeSession makes AuthMiddleware reject access tokens for sessionID.
+func RevokeSession(sessionID string, revokedAt time.Time) {
+	until := revokedAt.Add(AccessTokenTTL)
+	now := time.Now()
+
+	revokedSessions.Lock()
+	defer revokedSessions.Unlock()
+
+	for id, t := range revokedSessions.until {
+		if t.Before(now) {
+			delete(revokedSessions.until, id)
+		}
+	}
+	if until.After(now) {
+		revokedSessions.until[sessionID] = until
+	}
+}
+
+func IsSessionRevoked(sessionID string) bool {
+	revokedSessions.RLock()
+	defer revokedSessions.RUnlock()
+
+	until, ok := revokedSessions.until[sessionID]
+	return ok && until.After(time.Now())
+}
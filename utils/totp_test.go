@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Key is the SHA-1 seed from RFC 6238 appendix B.
+var rfc6238Key = []byte("12345678901234567890")
+
+// rfc6238Vectors are the appendix B SHA-1 results, cut to the last six of
+// their eight digits as six-digit authenticators display them.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		if got := totpCode(rfc6238Key, v.unix/totpPeriod); got != v.code {
+			t.Errorf("totpCode at %d = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTPRFC6238(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Key)
+
+	for _, v := range rfc6238Vectors {
+		now := time.Unix(v.unix, 0)
+		step, ok := ValidateTOTP(secret, v.code, now)
+		if !ok {
+			t.Errorf("ValidateTOTP rejected %s at %d", v.code, v.unix)
+			continue
+		}
+		if step != v.unix/totpPeriod {
+			t.Errorf("ValidateTOTP at %d matched step %d, want %d", v.unix, step, v.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Key)
+	const at = 1111111111
+	code := totpCode(rfc6238Key, at/totpPeriod)
+	base := time.Unix(at, 0)
+
+	cases := []struct {
+		name string
+		now  time.Time
+		code string
+		want bool
+	}{
+		{"same step", base, code, true},
+		{"one step later", base.Add(totpPeriod * time.Second), code, true},
+		{"one step earlier", base.Add(-totpPeriod * time.Second), code, true},
+		{"two steps later", base.Add(2 * totpPeriod * time.Second), code, false},
+		{"two steps earlier", base.Add(-2 * totpPeriod * time.Second), code, false},
+		{"spaces are ignored", base, code[:3] + " " + code[3:], true},
+		{"wrong code", base, "000000", code == "000000"},
+		{"too short", base, code[:5], false},
+		{"eight digits", base, "14050471", false},
+		{"empty", base, "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(secret, tc.code, tc.now); ok != tc.want {
+				t.Fatalf("ValidateTOTP(%q) = %v, want %v", tc.code, ok, tc.want)
+			}
+		})
+	}
+
+	if _, ok := ValidateTOTP(strings.ToLower(secret), code, base); !ok {
+		t.Fatal("lower-case secret rejected")
+	}
+	if _, ok := ValidateTOTP("not base32!", code, base); ok {
+		t.Fatal("malformed secret accepted")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	a, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(a)
+	if err != nil {
+		t.Fatalf("secret %q is not unpadded base32: %v", a, err)
+	}
+	if len(key) != 20 {
+		t.Fatalf("secret decodes to %d bytes, want 20", len(key))
+	}
+
+	b, _ := GenerateTOTPSecret()
+	if a == b {
+		t.Fatal("GenerateTOTPSecret returned the same secret twice")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	raw := TOTPProvisioningURI("Layer", "ada@example.com", "JBSWY3DPEHPK3PXP")
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", raw, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Layer:ada@example.com" {
+		t.Fatalf("URI = %s", raw)
+	}
+
+	want := map[string]string{
+		"secret":    "JBSWY3DPEHPK3PXP",
+		"issuer":    "Layer",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	for k, v := range want {
+		if got := u.Query().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
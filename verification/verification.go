@@ -0,0 +1,94 @@
+// Package verification decides what accounts without a confirmed email
+// address are allowed to do.
+package verification
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"layer-api/types"
+	"layer-api/utils"
+	"net/http"
+	"strings"
+)
+
+type Restriction string
+
+const (
+	// RestrictInvite covers every way of giving other people access:
+	// collaborators, invitations, invite links, approved access requests,
+	// folder and workspace invites.
+	RestrictInvite Restriction = "invite"
+	// RestrictShare covers public share links.
+	RestrictShare Restriction = "share"
+)
+
+var descriptions = map[Restriction]string{
+	RestrictInvite: "inviting people",
+	RestrictShare:  "creating share links",
+}
+
+type Policy struct {
+	users      types.UserStore
+	restricted map[Restriction]bool
+}
+
+// NewPolicy parses a comma separated list of restrictions, such as
+// "invite,share". "none" turns the policy off and "all" enables every
+// restriction.
+func NewPolicy(users types.UserStore, spec string) (*Policy, error) {
+	p := &Policy{users: users, restricted: map[Restriction]bool{}}
+
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		switch name {
+		case "", "none":
+		case "all":
+			for r := range descriptions {
+				p.restricted[r] = true
+			}
+		default:
+			r := Restriction(name)
+			if _, ok := descriptions[r]; !ok {
+				return nil, fmt.Errorf("unknown email verification restriction %q", name)
+			}
+			p.restricted[r] = true
+		}
+	}
+
+	return p, nil
+}
+
+// Require wraps an authenticated handler so it is refused with 403 when r
+// is restricted and the caller's email address is not verified. It must run
+// inside utils.AuthMiddleware.
+func (p *Policy) Require(r Restriction, next http.Handler) http.Handler {
+	if p == nil || !p.restricted[r] {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		userID, ok := utils.GetUserIDFromContext(req.Context())
+		if !ok || userID <= 0 {
+			utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+			return
+		}
+
+		u, err := p.users.GetUserByID(userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				utils.WriteError(w, http.StatusUnauthorized, errors.New("user not found"))
+				return
+			}
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if u.EmailVerifiedAt == nil {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("verify your email address before %s", descriptions[r]))
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}